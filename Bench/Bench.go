@@ -0,0 +1,168 @@
+package Bench
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"time"
+
+	"github.com/trueabc/lox/Lox"
+)
+
+// Runner 在当前进程中多次运行 benchmark 脚本, 统计耗时、内存分配和 GC
+// 脚本的输出会被丢弃, 每次运行都使用新的虚拟机, 互不影响
+type Runner struct {
+	Runs int
+	// 使用字节码虚拟机, 否则使用树遍历解释器
+	Bytecode bool
+}
+
+// FileResult 单个脚本 Runs 次运行的统计, 时间单位都是纳秒
+type FileResult struct {
+	File string `json:"file"`
+	// 每次运行的墙上时间
+	WallNs []int64 `json:"wall_ns"`
+	MinNs  int64   `json:"min_ns"`
+	MeanNs int64   `json:"mean_ns"`
+	MaxNs  int64   `json:"max_ns"`
+	// 平均每次运行分配的对象个数和字节数
+	AllocsPerRun uint64 `json:"allocs_per_run"`
+	BytesPerRun  uint64 `json:"bytes_per_run"`
+	// 所有运行期间的 GC 次数和暂停时间
+	NumGC        uint32 `json:"num_gc"`
+	GCPauseNs    uint64 `json:"gc_pause_ns"`
+	MaxGCPauseNs uint64 `json:"max_gc_pause_ns"`
+	// 脚本报错时记录错误, 统计只包含出错之前的运行
+	Error string `json:"error,omitempty"`
+}
+
+// Report 一次 bench 的结果, 直接序列化为 JSON
+type Report struct {
+	Backend   string        `json:"backend"`
+	Runs      int           `json:"runs"`
+	GoVersion string        `json:"go_version"`
+	GOOS      string        `json:"goos"`
+	GOARCH    string        `json:"goarch"`
+	Results   []*FileResult `json:"results"`
+}
+
+func NewRunner(runs int, bytecode bool) *Runner {
+	if runs < 1 {
+		runs = 1
+	}
+	return &Runner{Runs: runs, Bytecode: bytecode}
+}
+
+// Run 运行 dir 目录下所有的 .lox 文件, 不递归子目录
+func (r *Runner) Run(dir string) (*Report, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.lox"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	report := &Report{
+		Backend:   "tree-walk",
+		Runs:      r.Runs,
+		GoVersion: runtime.Version(),
+		GOOS:      runtime.GOOS,
+		GOARCH:    runtime.GOARCH,
+		Results:   make([]*FileResult, 0, len(paths)),
+	}
+	if r.Bytecode {
+		report.Backend = "bytecode"
+	}
+	for _, path := range paths {
+		result, err := r.RunFile(path)
+		if err != nil {
+			return nil, err
+		}
+		report.Results = append(report.Results, result)
+	}
+	return report, nil
+}
+
+// RunFile 运行单个脚本, 只有读取文件失败才返回错误, 脚本自身的错误记录在结果中
+func (r *Runner) RunFile(path string) (*FileResult, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(abs); err != nil {
+		return nil, err
+	}
+
+	result := &FileResult{File: filepath.Base(path), WallNs: make([]int64, 0, r.Runs)}
+	// 先做一次 GC, 避免把之前的垃圾算到这个文件上
+	runtime.GC()
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	for i := 0; i < r.Runs; i++ {
+		vm := r.newVM()
+		start := time.Now()
+		err := vm.RunFile(abs)
+		result.WallNs = append(result.WallNs, time.Since(start).Nanoseconds())
+		if err != nil {
+			result.Error = err.Error()
+			break
+		}
+	}
+	runtime.ReadMemStats(&after)
+
+	runs := uint64(len(result.WallNs))
+	result.AllocsPerRun = (after.Mallocs - before.Mallocs) / runs
+	result.BytesPerRun = (after.TotalAlloc - before.TotalAlloc) / runs
+	result.NumGC = after.NumGC - before.NumGC
+	result.GCPauseNs = after.PauseTotalNs - before.PauseTotalNs
+	result.MaxGCPauseNs = maxPause(&before, &after)
+	result.summarize()
+	return result, nil
+}
+
+func (r *Runner) newVM() *Lox.VM {
+	if r.Bytecode {
+		return Lox.NewBytecodeVM(io.Discard, io.Discard)
+	}
+	return Lox.NewVM(io.Discard, io.Discard)
+}
+
+func (f *FileResult) summarize() {
+	var total int64
+	f.MinNs = f.WallNs[0]
+	for _, ns := range f.WallNs {
+		total += ns
+		if ns < f.MinNs {
+			f.MinNs = ns
+		}
+		if ns > f.MaxNs {
+			f.MaxNs = ns
+		}
+	}
+	f.MeanNs = total / int64(len(f.WallNs))
+}
+
+// maxPause 两次采样之间最长的一次 GC 暂停, PauseNs 是最近 256 次 GC 的环形缓冲
+func maxPause(before, after *runtime.MemStats) uint64 {
+	var pause uint64
+	count := after.NumGC - before.NumGC
+	if count > uint32(len(after.PauseNs)) {
+		count = uint32(len(after.PauseNs))
+	}
+	for i := uint32(0); i < count; i++ {
+		ns := after.PauseNs[(after.NumGC-i+255)%256]
+		if ns > pause {
+			pause = ns
+		}
+	}
+	return pause
+}
+
+// WriteJSON 以缩进格式输出报告
+func (rp *Report) WriteJSON(out io.Writer) error {
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(rp)
+}
@@ -0,0 +1,93 @@
+package Bench
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// scripts 在临时目录中写入 benchmark 脚本, 返回目录
+func scripts(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, source := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(source), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// 两个后端都按文件名排序输出每个脚本的统计, 出错的脚本在第一次运行后停止
+func TestRun(t *testing.T) {
+	dir := scripts(t, map[string]string{
+		"fib.lox":    "fun fib(n) { if (n < 2) return n; return fib(n - 1) + fib(n - 2); }\nprint fib(10);\n",
+		"error.lox":  "print undefined;\n",
+		"readme.txt": "not a script",
+	})
+	for _, bytecode := range []bool{false, true} {
+		report, err := NewRunner(3, bytecode).Run(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		backend := map[bool]string{false: "tree-walk", true: "bytecode"}[bytecode]
+		if report.Backend != backend || report.Runs != 3 {
+			t.Errorf("%s: got backend %q with %d runs", backend, report.Backend, report.Runs)
+		}
+		if len(report.Results) != 2 || report.Results[0].File != "error.lox" || report.Results[1].File != "fib.lox" {
+			t.Fatalf("%s: expected results for error.lox and fib.lox, got %+v", backend, report.Results)
+		}
+
+		failed := report.Results[0]
+		if failed.Error == "" || len(failed.WallNs) != 1 {
+			t.Errorf("%s: expected one run with an error for error.lox, got %+v", backend, failed)
+		}
+		fib := report.Results[1]
+		if fib.Error != "" || len(fib.WallNs) != 3 {
+			t.Errorf("%s: expected three runs of fib.lox, got %+v", backend, fib)
+		}
+		if fib.MinNs <= 0 || fib.MinNs > fib.MeanNs || fib.MeanNs > fib.MaxNs || fib.AllocsPerRun == 0 {
+			t.Errorf("%s: inconsistent statistics for fib.lox: %+v", backend, fib)
+		}
+	}
+}
+
+// JSON 报告的字段名是稳定的, 用来比较不同版本之间的性能
+func TestWriteJSON(t *testing.T) {
+	dir := scripts(t, map[string]string{"loop.lox": "var i = 0;\nwhile (i < 100) i = i + 1;\n"})
+	report, err := NewRunner(2, false).Run(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := report.WriteJSON(&out); err != nil {
+		t.Fatal(err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+		t.Fatalf("%s: %v", out.String(), err)
+	}
+	for _, key := range []string{"backend", "runs", "go_version", "goos", "goarch", "results"} {
+		if _, ok := decoded[key]; !ok {
+			t.Errorf("report has no %q in:\n%s", key, out.String())
+		}
+	}
+	results := decoded["results"].([]interface{})
+	if len(results) != 1 {
+		t.Fatalf("expected one result in:\n%s", out.String())
+	}
+	result := results[0].(map[string]interface{})
+	for _, key := range []string{"file", "wall_ns", "min_ns", "mean_ns", "max_ns", "allocs_per_run",
+		"bytes_per_run", "num_gc", "gc_pause_ns", "max_gc_pause_ns"} {
+		if _, ok := result[key]; !ok {
+			t.Errorf("result has no %q in:\n%s", key, out.String())
+		}
+	}
+	if _, ok := result["error"]; ok {
+		t.Errorf("error should be omitted for a script that succeeds:\n%s", out.String())
+	}
+	if wall := result["wall_ns"].([]interface{}); len(wall) != 2 {
+		t.Errorf("expected two wall times, got %v", wall)
+	}
+}
@@ -0,0 +1,192 @@
+package Conformance
+
+import (
+	"bufio"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// 测试文件中的注释标注, 与 craftinginterpreters 的 test.py 保持一致
+var (
+	expectedOutputPattern       = regexp.MustCompile(`// expect: ?(.*)`)
+	expectedErrorPattern        = regexp.MustCompile(`// (Error.*)`)
+	errorLinePattern            = regexp.MustCompile(`// \[((java|c) )?line (\d+)\] (Error.*)`)
+	expectedRuntimeErrorPattern = regexp.MustCompile(`// expect runtime error: (.+)`)
+	syntaxErrorPattern          = regexp.MustCompile(`\[.*line (\d+)\] (Error.+)`)
+	stackTracePattern           = regexp.MustCompile(`\[line (\d+)\]`)
+	nonTestPattern              = regexp.MustCompile(`// nontest`)
+)
+
+// 与 sysexits.h 一致的退出码
+const (
+	ExitOK           = 0
+	ExitCompileError = 65
+	ExitRuntimeError = 70
+)
+
+// Expectation 一个 .lox 文件期望的输出
+type Expectation struct {
+	Path string
+
+	Output        []OutputLine
+	CompileErrors []string // "[line N] Error ..." 格式
+
+	RuntimeError     string
+	RuntimeErrorLine int
+
+	ExitCode int
+}
+
+type OutputLine struct {
+	Line  int
+	Value string
+}
+
+// ParseExpectation 读取文件中的 expect 注释, nontest 文件返回 nil
+func ParseExpectation(path string) (*Expectation, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	exp := &Expectation{Path: path, CompileErrors: make([]string, 0)}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := scanner.Text()
+		if nonTestPattern.MatchString(text) {
+			return nil, nil
+		}
+
+		if m := expectedOutputPattern.FindStringSubmatch(text); m != nil {
+			exp.Output = append(exp.Output, OutputLine{line, m[1]})
+			continue
+		}
+		if m := expectedErrorPattern.FindStringSubmatch(text); m != nil {
+			exp.CompileErrors = append(exp.CompileErrors,
+				"[line "+strconv.Itoa(line)+"] "+m[1])
+			exp.ExitCode = ExitCompileError
+			continue
+		}
+		if m := errorLinePattern.FindStringSubmatch(text); m != nil {
+			// c line 只针对 clox, 这里实现的是 jlox 的语义
+			if m[2] != "c" {
+				exp.CompileErrors = append(exp.CompileErrors,
+					"[line "+m[3]+"] "+m[4])
+				exp.ExitCode = ExitCompileError
+			}
+			continue
+		}
+		if m := expectedRuntimeErrorPattern.FindStringSubmatch(text); m != nil {
+			exp.RuntimeError = m[1]
+			exp.RuntimeErrorLine = line
+			exp.ExitCode = ExitRuntimeError
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return exp, nil
+}
+
+// Verify 对比实际的输出和期望, 返回所有不一致的地方
+func (e *Expectation) Verify(stdout, stderr string, exitCode int) []string {
+	failures := make([]string, 0)
+
+	errLines := splitLines(stderr)
+	if e.RuntimeError != "" {
+		failures = append(failures, e.verifyRuntimeError(errLines)...)
+	} else {
+		failures = append(failures, e.verifyCompileErrors(errLines)...)
+	}
+
+	if exitCode != e.ExitCode {
+		failures = append(failures, "Expected return code "+strconv.Itoa(e.ExitCode)+
+			" and got "+strconv.Itoa(exitCode)+".")
+	}
+
+	outLines := splitLines(stdout)
+	for id, line := range outLines {
+		if id >= len(e.Output) {
+			failures = append(failures, "Got output '"+line+"' when none was expected.")
+			continue
+		}
+		expected := e.Output[id]
+		if expected.Value != line {
+			failures = append(failures, "Expected output '"+expected.Value+
+				"' on line "+strconv.Itoa(expected.Line)+" and got '"+line+"'.")
+		}
+	}
+	for id := len(outLines); id < len(e.Output); id++ {
+		failures = append(failures, "Missing expected output '"+e.Output[id].Value+
+			"' on line "+strconv.Itoa(e.Output[id].Line)+".")
+	}
+	return failures
+}
+
+func (e *Expectation) verifyRuntimeError(errLines []string) []string {
+	if len(errLines) < 2 {
+		return []string{"Expected runtime error '" + e.RuntimeError + "' and got none."}
+	}
+	if errLines[0] != e.RuntimeError {
+		return []string{"Expected runtime error '" + e.RuntimeError +
+			"' and got '" + errLines[0] + "'."}
+	}
+	// 错误信息之后是调用栈, 其中需要有报错的行号
+	for _, line := range errLines[1:] {
+		if m := stackTracePattern.FindStringSubmatch(line); m != nil {
+			if m[1] == strconv.Itoa(e.RuntimeErrorLine) {
+				return nil
+			}
+			return []string{"Expected runtime error on line " +
+				strconv.Itoa(e.RuntimeErrorLine) + " but was on line " + m[1] + "."}
+		}
+	}
+	return []string{"Expected stack trace and got: " + strings.Join(errLines[1:], " | ")}
+}
+
+func (e *Expectation) verifyCompileErrors(errLines []string) []string {
+	failures := make([]string, 0)
+	found := make(map[string]bool)
+	// 只关心错误行, 源码片段等其他辅助输出忽略
+	for _, line := range errLines {
+		m := syntaxErrorPattern.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		actual := "[line " + m[1] + "] " + m[2]
+		found[actual] = true
+		if !contains(e.CompileErrors, actual) {
+			failures = append(failures, "Unexpected error: "+line)
+		}
+	}
+	for _, expected := range e.CompileErrors {
+		if !found[expected] {
+			failures = append(failures, "Missing expected error: "+expected)
+		}
+	}
+	return failures
+}
+
+func splitLines(s string) []string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	s = strings.TrimSuffix(s, "\n")
+	if s == "" {
+		return []string{}
+	}
+	return strings.Split(s, "\n")
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
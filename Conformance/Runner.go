@@ -0,0 +1,179 @@
+package Conformance
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Runner 使用解释器的可执行文件逐个运行 .lox 测试文件
+// 用子进程运行, 这样退出码和 stderr 都可以被检查, 栈溢出之类的崩溃也不会影响其他用例
+type Runner struct {
+	// 解释器命令, 测试文件路径追加在最后
+	Command []string
+	// 已知不一致的用例, 相对于测试根目录的路径, 目录会匹配其下所有文件
+	Skip    map[string]string
+	Timeout time.Duration
+}
+
+// Result 单个文件的运行结果
+type Result struct {
+	Path     string // 相对于测试根目录
+	Skipped  bool
+	Failures []string
+}
+
+func (r *Result) Passed() bool {
+	return !r.Skipped && len(r.Failures) == 0
+}
+
+// Report 一次运行的所有结果
+type Report struct {
+	Results []*Result
+}
+
+func NewRunner(command ...string) *Runner {
+	return &Runner{Command: command, Skip: KnownFailures, Timeout: 30 * time.Second}
+}
+
+// NewVMRunner 使用 --vm 运行字节码后端
+func NewVMRunner(binary string) *Runner {
+	return &Runner{Command: []string{binary, "--vm"}, Skip: KnownVMFailures, Timeout: 30 * time.Second}
+}
+
+// Run 运行 root 目录下所有的 .lox 文件
+func (r *Runner) Run(root string) (*Report, error) {
+	paths := make([]string, 0)
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && filepath.Ext(path) == ".lox" {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	report := &Report{Results: make([]*Result, 0, len(paths))}
+	for _, path := range paths {
+		rel, _ := filepath.Rel(root, path)
+		rel = filepath.ToSlash(rel)
+		if r.skipped(rel) {
+			report.Results = append(report.Results, &Result{Path: rel, Skipped: true})
+			continue
+		}
+		exp, err := ParseExpectation(path)
+		if err != nil {
+			return nil, err
+		}
+		if exp == nil {
+			continue
+		}
+		report.Results = append(report.Results, &Result{Path: rel, Failures: r.runFile(exp)})
+	}
+	return report, nil
+}
+
+func (r *Runner) skipped(rel string) bool {
+	for prefix := range r.Skip {
+		if rel == prefix || strings.HasPrefix(rel, strings.TrimSuffix(prefix, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Runner) runFile(exp *Expectation) []string {
+	ctx := context.Background()
+	if r.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.Timeout)
+		defer cancel()
+	}
+
+	args := append(append([]string{}, r.Command[1:]...), exp.Path)
+	cmd := exec.CommandContext(ctx, r.Command[0], args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return []string{fmt.Sprintf("Timed out after %v.", r.Timeout)}
+	}
+	exitCode := 0
+	if err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return []string{"Could not run interpreter: " + err.Error()}
+		}
+		exitCode = exitErr.ExitCode()
+	}
+	return exp.Verify(stdout.String(), stderr.String(), exitCode)
+}
+
+// Failed 没有被跳过但是失败的用例
+func (rp *Report) Failed() []*Result {
+	failed := make([]*Result, 0)
+	for _, item := range rp.Results {
+		if !item.Skipped && !item.Passed() {
+			failed = append(failed, item)
+		}
+	}
+	return failed
+}
+
+// Print 按目录汇总 pass/fail/skip, verbose 时输出每个失败用例的原因
+func (rp *Report) Print(out io.Writer, verbose bool) {
+	type summary struct{ pass, fail, skip int }
+	dirs := make(map[string]*summary)
+	names := make([]string, 0)
+	total := &summary{}
+	for _, item := range rp.Results {
+		dir := filepath.ToSlash(filepath.Dir(item.Path))
+		s, ok := dirs[dir]
+		if !ok {
+			s = &summary{}
+			dirs[dir] = s
+			names = append(names, dir)
+		}
+		switch {
+		case item.Skipped:
+			s.skip++
+			total.skip++
+		case item.Passed():
+			s.pass++
+			total.pass++
+		default:
+			s.fail++
+			total.fail++
+		}
+	}
+	sort.Strings(names)
+
+	if verbose {
+		for _, item := range rp.Failed() {
+			fmt.Fprintf(out, "FAIL %s\n", item.Path)
+			for _, failure := range item.Failures {
+				fmt.Fprintf(out, "     %s\n", failure)
+			}
+		}
+	}
+	for _, name := range names {
+		s := dirs[name]
+		fmt.Fprintf(out, "%-20s pass %3d  fail %3d  skip %3d\n", name, s.pass, s.fail, s.skip)
+	}
+	fmt.Fprintf(out, "%-20s pass %3d  fail %3d  skip %3d\n", "total", total.pass, total.fail, total.skip)
+}
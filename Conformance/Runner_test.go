@@ -0,0 +1,205 @@
+package Conformance
+
+import (
+	"github.com/trueabc/lox/Syntax"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// 编译解释器后运行 lox-sample/test 下的全部用例
+func TestConformance(t *testing.T) {
+	runConformance(t, "../lox-sample/test", func(binary string) *Runner { return NewRunner(binary) })
+}
+
+// 字节码后端运行同样的用例
+func TestConformanceVM(t *testing.T) {
+	runConformance(t, "../lox-sample/test", NewVMRunner)
+}
+
+// testdata 下本仓库自己的用例, 覆盖 lox-sample 中没有的语法, 两个后端都不允许跳过
+func TestFixtures(t *testing.T) {
+	runConformance(t, "testdata", func(binary string) *Runner {
+		runner := NewRunner(binary)
+		runner.Skip = nil
+		return runner
+	})
+}
+
+func TestFixturesVM(t *testing.T) {
+	runConformance(t, "testdata", func(binary string) *Runner {
+		runner := NewVMRunner(binary)
+		runner.Skip = nil
+		return runner
+	})
+}
+
+func runConformance(t *testing.T, root string, newRunner func(binary string) *Runner) {
+	if testing.Short() {
+		t.Skip("conformance suite skipped in short mode")
+	}
+	report, err := newRunner(buildInterpreter(t)).Run(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var summary strings.Builder
+	report.Print(&summary, false)
+	t.Log("\n" + summary.String())
+
+	for _, item := range report.Failed() {
+		t.Errorf("%s:\n\t%s", item.Path, strings.Join(item.Failures, "\n\t"))
+	}
+}
+
+func buildInterpreter(t *testing.T) string {
+	binary := filepath.Join(t.TempDir(), "go-lox")
+	build := exec.Command("go", "build", "-o", binary, "github.com/trueabc/lox")
+	if out, err := build.CombinedOutput(); err != nil {
+		t.Fatalf("build interpreter: %v\n%s", err, out)
+	}
+	return binary
+}
+
+// 每个用例经过 --emit-ast=json 和 --load-ast 之后, 两个后端的输出仍然符合 expect 注释
+// JSON 解码之后再编码, 得到的内容不变
+func TestASTRoundTrip(t *testing.T) {
+	if testing.Short() {
+		t.Skip("conformance suite skipped in short mode")
+	}
+	binary := buildInterpreter(t)
+	runners := []*Runner{NewRunner(binary, "--load-ast"), NewVMRunner(binary)}
+	runners[1].Command = append(runners[1].Command, "--load-ast")
+
+	root := "../lox-sample/test"
+	dir := t.TempDir()
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || filepath.Ext(path) != ".lox" {
+			return err
+		}
+		rel, _ := filepath.Rel(root, path)
+		rel = filepath.ToSlash(rel)
+		exp, err := ParseExpectation(path)
+		if err != nil || exp == nil || runners[0].skipped(rel) {
+			return err
+		}
+
+		out, err := exec.Command(binary, "--emit-ast=json", path).Output()
+		if err != nil {
+			// 词法和语法错误时没有语法树, Resolver 的错误在 --load-ast 时报告
+			if exp.ExitCode != ExitCompileError {
+				t.Errorf("%s: emit ast: %v", rel, err)
+			}
+			return nil
+		}
+		stmts, err := Syntax.UnmarshalAST(out)
+		if err != nil {
+			t.Errorf("%s: load ast: %v", rel, err)
+			return nil
+		}
+		data, err := Syntax.MarshalAST(stmts)
+		if err != nil {
+			t.Errorf("%s: emit loaded ast: %v", rel, err)
+			return nil
+		}
+		if strings.TrimSpace(string(out)) != string(data) {
+			t.Errorf("%s: ast changed after a round trip through json", rel)
+		}
+
+		loaded := *exp
+		loaded.Path = filepath.Join(dir, strings.ReplaceAll(rel, "/", "_")+".json")
+		if err := os.WriteFile(loaded.Path, out, 0666); err != nil {
+			return err
+		}
+		for _, runner := range runners {
+			if runner.skipped(rel) {
+				continue
+			}
+			if failures := runner.runFile(&loaded); len(failures) != 0 {
+				t.Errorf("%s %v:\n\t%s", rel, runner.Command[1:], strings.Join(failures, "\n\t"))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// --dump-ast 只解析不执行, 两种格式都输出语法树, 语法错误时以 65 退出
+func TestDumpAST(t *testing.T) {
+	if testing.Short() {
+		t.Skip("conformance suite skipped in short mode")
+	}
+	binary := buildInterpreter(t)
+	path := "../lox-sample/test/precedence.lox"
+	out, err := exec.Command(binary, "--dump-ast", path).Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(string(out), "\n")
+	if lines[0] != "(print (+ 2 (* 3 4)))" || lines[1] != "(print (- 20 (* 3 4)))" {
+		t.Errorf("unexpected S-expressions for %s:\n%s", path, out)
+	}
+
+	out, err = exec.Command(binary, "--dump-ast", "--ast-style", "tree", path).Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "print\n  +\n    2\n    *\n      3\n      4\n"; !strings.HasPrefix(string(out), want) {
+		t.Errorf("unexpected tree for %s:\n%s", path, out)
+	}
+
+	cmd := exec.Command(binary, "--dump-ast", "--ast-style", "json", path)
+	if err := cmd.Run(); cmd.ProcessState.ExitCode() != 64 {
+		t.Errorf("expected exit code 64 for an unknown style, got %v", err)
+	}
+	invalid := filepath.Join(t.TempDir(), "invalid.lox")
+	if err := os.WriteFile(invalid, []byte("print (1;\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	cmd = exec.Command(binary, "--dump-ast", invalid)
+	if err := cmd.Run(); cmd.ProcessState.ExitCode() != ExitCompileError {
+		t.Errorf("expected exit code %d for a syntax error, got %v", ExitCompileError, err)
+	}
+}
+
+func TestParseExpectation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sample.lox")
+	source := `print 1; // expect: 1
+foo(a | b); // [line 2] Error: Unexpected character.
+// [java line 3] Error at 'b': Expect ')' after arguments.
+// [c line 4] Error at end: Expect '}' after block.
+nil(); // expect runtime error: Can only call functions and classes.
+`
+	if err := os.WriteFile(path, []byte(source), 0666); err != nil {
+		t.Fatal(err)
+	}
+	exp, err := ParseExpectation(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(exp.Output) != 1 || exp.Output[0].Value != "1" {
+		t.Errorf("unexpected output %v", exp.Output)
+	}
+	want := []string{
+		"[line 2] Error: Unexpected character.",
+		"[line 3] Error at 'b': Expect ')' after arguments.",
+	}
+	if strings.Join(exp.CompileErrors, "\n") != strings.Join(want, "\n") {
+		t.Errorf("unexpected compile errors %v", exp.CompileErrors)
+	}
+	if exp.RuntimeErrorLine != 5 || exp.ExitCode != ExitRuntimeError {
+		t.Errorf("unexpected runtime error %q line %d", exp.RuntimeError, exp.RuntimeErrorLine)
+	}
+
+	failures := exp.Verify("1\n", "Can only call functions and classes.\n[line 5] in script\n", ExitRuntimeError)
+	if len(failures) != 0 {
+		t.Errorf("unexpected failures %v", failures)
+	}
+	failures = exp.Verify("2\n", "", 0)
+	if len(failures) != 3 {
+		t.Errorf("expected 3 failures, got %v", failures)
+	}
+}
@@ -0,0 +1,42 @@
+package Conformance
+
+// KnownFailures 已知与参考实现不一致的用例, key 为相对 lox-sample/test 的路径, value 为原因
+// 修复之后从这里删除, 用来跟踪一致性的进度
+var KnownFailures = map[string]string{
+	// 参考实现中也不属于 jlox 的测试
+	"benchmark":                    "benchmarks are run separately, not conformance cases",
+	"expressions":                  "chapter 7 expression-only tests, not full programs",
+	"scanning":                     "chapter 4 scanner-only tests, not full programs",
+	"limit/loop_too_large.lox":     "clox-only limit",
+	"limit/no_reuse_constants.lox": "clox-only limit",
+	"limit/too_many_constants.lox": "clox-only limit",
+	"limit/too_many_locals.lox":    "clox-only limit",
+	"limit/too_many_upvalues.lox":  "clox-only limit",
+
+	// { 在表达式中是字典字面量, 这些用例期望它是语法错误
+	"for/statement_condition.lox":   "'{' starts a map literal in expressions",
+	"for/statement_increment.lox":   "'{' starts a map literal in expressions",
+	"for/statement_initializer.lox": "'{' starts a map literal in expressions",
+
+	// 除以 0 是运行时错误, 不再得到 NaN; | 是按位或运算符, -- 是自减运算符
+	"number/nan_equality.lox":  "division by zero is a runtime error",
+	"operator/negate.lox":      "'--' is the decrement operator",
+	"unexpected_character.lox": "'|' is the bitwise or operator",
+}
+
+// KnownVMFailures 字节码后端已知不一致的用例
+var KnownVMFailures = map[string]string{
+	"benchmark":   "benchmarks are run separately, not conformance cases",
+	"expressions": "chapter 7 expression-only tests, not full programs",
+	"scanning":    "chapter 4 scanner-only tests, not full programs",
+
+	// { 在表达式中是字典字面量, 这些用例期望它是语法错误
+	"for/statement_condition.lox":   "'{' starts a map literal in expressions",
+	"for/statement_increment.lox":   "'{' starts a map literal in expressions",
+	"for/statement_initializer.lox": "'{' starts a map literal in expressions",
+
+	// 除以 0 是运行时错误, 不再得到 NaN; | 是按位或运算符, -- 是自减运算符
+	"number/nan_equality.lox":  "division by zero is a runtime error",
+	"operator/negate.lox":      "'--' is the decrement operator",
+	"unexpected_character.lox": "'|' is the bitwise or operator",
+}
@@ -0,0 +1,262 @@
+package Debug
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/trueabc/lox/Syntax"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// stepMode 继续执行到什么位置再暂停
+type stepMode int
+
+const (
+	modeContinue stepMode = iota // 只在断点暂停
+	modeStepIn                   // 下一个语句, 包括被调用函数中的语句
+	modeStepOver                 // 当前函数或者外层函数中的下一个语句
+	modeStepOut                  // 返回到调用方之后的下一个语句
+)
+
+// Debugger 命令行调试器, Hook 作为 Syntax.DebugHook 在每个语句执行之前调用
+// 程序开始时暂停在第一个语句, 之后根据命令继续执行
+type Debugger struct {
+	in     *bufio.Scanner
+	out    io.Writer
+	source []string
+
+	breakpoints map[int]bool
+	mode        stepMode
+	// 开始单步执行时的调用深度
+	depth int
+	// 上一次调用 Hook 时的位置, 同一行的多个语句只暂停一次
+	lastLine, lastDepth int
+	// 到达这个位置之后执行过的语句, 再次执行其中的语句说明写在一行中的循环开始了新的一次迭代
+	visited map[Syntax.Stmt]bool
+	// 程序开始时已经存在的全局变量, globals 命令不显示它们
+	builtins map[string]bool
+	// 空行重复上一个命令
+	lastCommand string
+}
+
+func New(source string, in io.Reader, out io.Writer) *Debugger {
+	return &Debugger{in: bufio.NewScanner(in), out: out, source: strings.Split(source, "\n"),
+		breakpoints: make(map[int]bool), mode: modeStepIn}
+}
+
+// Hook 判断是否需要在 line 暂停, 暂停时读取并执行命令, 返回 false 表示退出调试
+func (d *Debugger) Hook(i *Syntax.Interpreter, stmt Syntax.Stmt, line int) bool {
+	if d.builtins == nil {
+		d.builtins = make(map[string]bool)
+		for name := range i.GlobalEnvironment().VarValues {
+			d.builtins[name] = true
+		}
+	}
+	depth := i.Depth()
+	moved := line != d.lastLine || depth != d.lastDepth || d.visited[stmt]
+	if moved {
+		d.visited = make(map[Syntax.Stmt]bool)
+	}
+	d.visited[stmt] = true
+	d.lastLine, d.lastDepth = line, depth
+	if !moved || !d.shouldStop(line, depth) {
+		return true
+	}
+
+	d.where(i, line, 1)
+	d.show(line)
+	for {
+		fmt.Fprint(d.out, "(lox) ")
+		if !d.in.Scan() {
+			fmt.Fprintln(d.out)
+			return false
+		}
+		command := strings.TrimSpace(d.in.Text())
+		if command == "" {
+			command = d.lastCommand
+		}
+		d.lastCommand = command
+		resume, ok := d.command(i, line, command)
+		if !ok {
+			return false
+		}
+		if resume {
+			d.depth = depth
+			return true
+		}
+	}
+}
+
+func (d *Debugger) shouldStop(line, depth int) bool {
+	if d.breakpoints[line] {
+		return true
+	}
+	switch d.mode {
+	case modeStepIn:
+		return true
+	case modeStepOver:
+		return depth <= d.depth
+	case modeStepOut:
+		return depth < d.depth
+	}
+	return false
+}
+
+// command 执行一个命令, resume 表示继续执行程序, ok 为 false 表示退出
+func (d *Debugger) command(i *Syntax.Interpreter, line int, command string) (resume, ok bool) {
+	name, arg := command, ""
+	if index := strings.IndexByte(command, ' '); index >= 0 {
+		name, arg = command[:index], strings.TrimSpace(command[index+1:])
+	}
+	switch name {
+	case "":
+	case "break", "b":
+		if arg == "" {
+			d.breakpoints[line] = true
+			fmt.Fprintf(d.out, "Breakpoint at line %d.\n", line)
+		} else if n, err := strconv.Atoi(arg); err != nil || n < 1 || n > len(d.source) {
+			fmt.Fprintf(d.out, "Invalid line '%s'.\n", arg)
+		} else {
+			d.breakpoints[n] = true
+			fmt.Fprintf(d.out, "Breakpoint at line %d.\n", n)
+		}
+	case "delete", "d":
+		if n, err := strconv.Atoi(arg); err == nil && d.breakpoints[n] {
+			delete(d.breakpoints, n)
+			fmt.Fprintf(d.out, "Deleted breakpoint at line %d.\n", n)
+		} else {
+			fmt.Fprintf(d.out, "No breakpoint at line '%s'.\n", arg)
+		}
+	case "breakpoints", "info":
+		d.listBreakpoints()
+	case "continue", "c":
+		d.mode = modeContinue
+		return true, true
+	case "step", "s":
+		d.mode = modeStepIn
+		return true, true
+	case "next", "n":
+		d.mode = modeStepOver
+		return true, true
+	case "out", "finish", "o":
+		d.mode = modeStepOut
+		return true, true
+	case "locals", "env":
+		d.locals(i)
+	case "globals":
+		d.globals(i)
+	case "print", "p":
+		value, err := i.EvaluateInFrame(arg)
+		if err != nil {
+			fmt.Fprintln(d.out, err)
+		} else {
+			fmt.Fprintln(d.out, Syntax.Stringify(value))
+		}
+	case "where", "bt":
+		d.where(i, line, -1)
+	case "list", "l":
+		for n := line - 5; n <= line+5; n++ {
+			d.show(n)
+		}
+	case "help", "h":
+		fmt.Fprint(d.out, help)
+	case "quit", "q":
+		return false, false
+	default:
+		fmt.Fprintf(d.out, "Unknown command '%s', type help for a list of commands.\n", name)
+	}
+	return false, true
+}
+
+const help = `break|b [line]     set a breakpoint, default to the current line
+delete|d line      delete a breakpoint
+breakpoints        list breakpoints
+continue|c         run until the next breakpoint
+step|s             step into the next statement, entering calls
+next|n             step over calls to the next statement
+out|finish|o       run until the current function returns
+locals|env         print the scopes from the innermost outwards
+globals            print the globals defined by the script
+print|p expr       evaluate an expression in the paused frame
+where|bt           print the call stack
+list|l             print the source around the current line
+quit|q             stop the program
+`
+
+// show 输出源码中的第 n 行, 当前行用 > 标记, 断点用 * 标记
+func (d *Debugger) show(n int) {
+	if n < 1 || n > len(d.source) {
+		return
+	}
+	mark := " "
+	if d.breakpoints[n] {
+		mark = "*"
+	}
+	if n == d.lastLine {
+		mark = ">"
+	}
+	fmt.Fprintf(d.out, "%s%4d | %s\n", mark, n, d.source[n-1])
+}
+
+// where 输出调用栈的前 limit 层, limit 为负数时输出全部
+func (d *Debugger) where(i *Syntax.Interpreter, line, limit int) {
+	trace := i.Backtrace(line)
+	if limit >= 0 && limit < len(trace) {
+		trace = trace[:limit]
+	}
+	for _, item := range trace {
+		fmt.Fprintln(d.out, item)
+	}
+}
+
+func (d *Debugger) listBreakpoints() {
+	lines := make([]int, 0, len(d.breakpoints))
+	for line := range d.breakpoints {
+		lines = append(lines, line)
+	}
+	if len(lines) == 0 {
+		fmt.Fprintln(d.out, "No breakpoints.")
+		return
+	}
+	sort.Ints(lines)
+	for _, line := range lines {
+		d.show(line)
+	}
+}
+
+// locals 从内到外输出作用域链, 包括方法中的 this 和闭包捕获的变量, 不包括全局作用域
+func (d *Debugger) locals(i *Syntax.Interpreter) {
+	global := i.GlobalEnvironment()
+	level := 0
+	for env := i.Environment(); env != nil && env != global && env.Enclosing != nil; env = env.Enclosing {
+		fmt.Fprintf(d.out, "scope %d:\n", level)
+		d.variables(env.VarValues, nil)
+		level++
+	}
+	if level == 0 {
+		fmt.Fprintln(d.out, "No local scopes, use globals.")
+	}
+}
+
+func (d *Debugger) globals(i *Syntax.Interpreter) {
+	d.variables(i.GlobalEnvironment().VarValues, d.builtins)
+}
+
+// variables 按名字排序输出变量, 跳过 skip 中的名字
+func (d *Debugger) variables(values map[string]interface{}, skip map[string]bool) {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		if !skip[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	if len(names) == 0 {
+		fmt.Fprintln(d.out, "  (empty)")
+	}
+	for _, name := range names {
+		fmt.Fprintf(d.out, "  %s = %s\n", name, Syntax.Stringify(values[name]))
+	}
+}
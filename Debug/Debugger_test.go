@@ -0,0 +1,164 @@
+package Debug
+
+import (
+	"github.com/trueabc/lox/Lox"
+	"github.com/trueabc/lox/Syntax"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const source = `fun square(n) {
+  var result = n * n;
+  return result;
+}
+var a = 1;
+var b = square(a + 2);
+print b;
+print a + b;
+`
+
+// debug 用 commands 作为输入调试 source, 程序和调试器的输出写到同一个地方, 方便检查顺序
+func debug(t *testing.T, commands ...string) (string, error) {
+	return debugSource(t, source, commands...)
+}
+
+func debugSource(t *testing.T, source string, commands ...string) (string, error) {
+	path := filepath.Join(t.TempDir(), "debug.lox")
+	if err := os.WriteFile(path, []byte(source), 0666); err != nil {
+		t.Fatal(err)
+	}
+	var out strings.Builder
+	debugger := New(source, strings.NewReader(strings.Join(commands, "\n")+"\n"), &out)
+	err := Lox.NewVM(&out, io.Discard).DebugFile(path, debugger.Hook)
+	return out.String(), err
+}
+
+func expectTranscript(t *testing.T, got, want string) {
+	if got != want {
+		t.Errorf("got transcript:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestBreakpointAndStack(t *testing.T) {
+	out, err := debug(t, "break 3", "breakpoints", "continue", "where", "locals", "print result + 1", "continue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectTranscript(t, out, `[line 1] in script
+>   1 | fun square(n) {
+(lox) Breakpoint at line 3.
+(lox) *   3 |   return result;
+(lox) [line 3] in square()
+>   3 |   return result;
+(lox) [line 3] in square()
+[line 6] in script
+(lox) scope 0:
+  n = 3
+  result = 9
+(lox) 10
+(lox) 9
+10
+`)
+}
+
+func TestStep(t *testing.T) {
+	out, err := debug(t, "step", "step", "step", "step", "quit")
+	if err != Syntax.ErrDebugStopped {
+		t.Fatalf("expected the program to be stopped, got %v", err)
+	}
+	// step 进入被调用的函数
+	expectTranscript(t, out, `[line 1] in script
+>   1 | fun square(n) {
+(lox) [line 5] in script
+>   5 | var a = 1;
+(lox) [line 6] in script
+>   6 | var b = square(a + 2);
+(lox) [line 2] in square()
+>   2 |   var result = n * n;
+(lox) [line 3] in square()
+>   3 |   return result;
+(lox) `)
+}
+
+func TestNext(t *testing.T) {
+	// next 跳过函数调用
+	out, err := debug(t, "next", "next", "next", "globals", "continue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectTranscript(t, out, `[line 1] in script
+>   1 | fun square(n) {
+(lox) [line 5] in script
+>   5 | var a = 1;
+(lox) [line 6] in script
+>   6 | var b = square(a + 2);
+(lox) [line 7] in script
+>   7 | print b;
+(lox)   a = 1
+  b = 9
+  square = <fn square>
+(lox) 9
+10
+`)
+}
+
+func TestOut(t *testing.T) {
+	// 空行重复上一个命令, out 返回调用方之后的下一个语句
+	out, err := debug(t, "step", "", "", "out", "where", "continue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectTranscript(t, out, `[line 1] in script
+>   1 | fun square(n) {
+(lox) [line 5] in script
+>   5 | var a = 1;
+(lox) [line 6] in script
+>   6 | var b = square(a + 2);
+(lox) [line 2] in square()
+>   2 |   var result = n * n;
+(lox) [line 7] in script
+>   7 | print b;
+(lox) [line 7] in script
+(lox) 9
+10
+`)
+}
+
+// 输入结束时停止程序
+func TestEndOfInput(t *testing.T) {
+	out, err := debug(t, "step")
+	if err != Syntax.ErrDebugStopped {
+		t.Fatalf("expected the program to be stopped, got %v", err)
+	}
+	expectTranscript(t, out, `[line 1] in script
+>   1 | fun square(n) {
+(lox) [line 5] in script
+>   5 | var a = 1;
+(lox) 
+`)
+}
+
+// 写在一行中的循环每次迭代都会在断点处暂停
+func TestBreakpointInOneLineLoop(t *testing.T) {
+	loop := "var i = 0;\nwhile (i < 3) { i = i + 1; print i; }\n"
+	out, err := debugSource(t, loop, "break 2", "continue", "continue", "continue", "continue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectTranscript(t, out, `[line 1] in script
+>   1 | var i = 0;
+(lox) Breakpoint at line 2.
+(lox) [line 2] in script
+>   2 | while (i < 3) { i = i + 1; print i; }
+(lox) 1
+[line 2] in script
+>   2 | while (i < 3) { i = i + 1; print i; }
+(lox) 2
+[line 2] in script
+>   2 | while (i < 3) { i = i + 1; print i; }
+(lox) 3
+`)
+}
@@ -0,0 +1,143 @@
+package Diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// 每个修改前后保留的上下文行数, 与 diff -u 相同
+const contextLines = 3
+
+// edit 一行的修改, kind 为 ' ' (相同), '-' (删除) 或者 '+' (增加)
+type edit struct {
+	kind byte
+	text string
+}
+
+// Unified 比较 a 和 b, 输出 diff -u 格式的结果, 内容相同时返回空字符串
+func Unified(oldName, newName, a, b string) string {
+	if a == b {
+		return ""
+	}
+	edits := lineEdits(splitLines(a), splitLines(b))
+
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "--- %s\n+++ %s\n", oldName, newName)
+	for start := 0; start < len(edits); {
+		// 找到下一个修改, 和之后间隔不超过 2*contextLines 的修改合并为一个 hunk
+		for start < len(edits) && edits[start].kind == ' ' {
+			start++
+		}
+		if start == len(edits) {
+			break
+		}
+		end := start
+		for id := start; id < len(edits); id++ {
+			if edits[id].kind != ' ' {
+				end = id + 1
+			} else if id-end >= 2*contextLines {
+				break
+			}
+		}
+		from := start - contextLines
+		if from < 0 {
+			from = 0
+		}
+		to := end + contextLines
+		if to > len(edits) {
+			to = len(edits)
+		}
+		writeHunk(&builder, edits, from, to)
+		start = to
+	}
+	return builder.String()
+}
+
+func writeHunk(builder *strings.Builder, edits []edit, from, to int) {
+	// 计算 hunk 在两个文件中的起始行和行数
+	oldStart, newStart := 1, 1
+	for _, item := range edits[:from] {
+		if item.kind != '+' {
+			oldStart++
+		}
+		if item.kind != '-' {
+			newStart++
+		}
+	}
+	oldCount, newCount := 0, 0
+	for _, item := range edits[from:to] {
+		if item.kind != '+' {
+			oldCount++
+		}
+		if item.kind != '-' {
+			newCount++
+		}
+	}
+	fmt.Fprintf(builder, "@@ -%s +%s @@\n", hunkRange(oldStart, oldCount), hunkRange(newStart, newCount))
+	for _, item := range edits[from:to] {
+		builder.WriteByte(item.kind)
+		builder.WriteString(item.text + "\n")
+	}
+}
+
+// hunkRange 行数为 1 时省略, 为 0 时起始行是前一行
+func hunkRange(start, count int) string {
+	switch count {
+	case 0:
+		return fmt.Sprintf("%d,0", start-1)
+	case 1:
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+func splitLines(text string) []string {
+	lines := strings.Split(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// lineEdits 基于最长公共子序列的逐行比较, 格式化前后的文件不大, O(n*m) 足够
+func lineEdits(a, b []string) []edit {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	edits := make([]edit, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			edits = append(edits, edit{' ', a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			edits = append(edits, edit{'-', a[i]})
+			i++
+		default:
+			edits = append(edits, edit{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		edits = append(edits, edit{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		edits = append(edits, edit{'+', b[j]})
+	}
+	return edits
+}
@@ -0,0 +1,179 @@
+package Errors
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+type Severity int
+
+const (
+	SeverityError Severity = iota + 1
+	SeverityWarning
+)
+
+func (s Severity) String() string {
+	if s == SeverityWarning {
+		return "Warning"
+	}
+	return "Error"
+}
+
+// Span 源码中的一段区间, 字节偏移 [Start, End)
+type Span struct {
+	Start int
+	End   int
+}
+
+// Diagnostic 编译阶段的诊断信息, 带有位置和出错的源码行
+type Diagnostic struct {
+	File     string
+	Line     int
+	Column   int // 从1开始
+	Span     Span
+	Severity Severity
+	Where    string // 例如 " at 'x'", " at end"
+	Message  string
+	Code     string // lint 警告的代码, 可以用 // lox:ignore CODE 忽略
+
+	SourceLine string // 出错位置所在的整行源码
+}
+
+// Error 单行的描述, 与 jlox 的格式保持一致
+func (d *Diagnostic) Error() string {
+	if d.Code != "" {
+		return fmt.Sprintf("[line %d] %v[%s]%v: %v", d.Line, d.Severity, d.Code, d.Where, d.Message)
+	}
+	return fmt.Sprintf("[line %d] %v%v: %v", d.Line, d.Severity, d.Where, d.Message)
+}
+
+// Render 描述加上带下划线的源码片段, 类似 rustc 和 clang 的输出
+//
+//	[line 3] Error at '+': Operands must be two numbers or strings.
+//	 --> script.lox:3:13
+//	   |
+//	 3 | print a + b + c;
+//	   |             ^
+func (d *Diagnostic) Render() string {
+	return d.Error() + "\n" + d.Excerpt()
+}
+
+// Excerpt 只有位置和源码片段的部分
+func (d *Diagnostic) Excerpt() string {
+	file := d.File
+	if file == "" {
+		file = "script"
+	}
+	lineNo := strconv.Itoa(d.Line)
+	gutter := strings.Repeat(" ", len(lineNo))
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s--> %s:%d:%d\n", gutter, file, d.Line, d.Column)
+	// 没有源码时 (例如 --load-ast) 只有位置
+	if d.SourceLine == "" {
+		return b.String()
+	}
+	fmt.Fprintf(&b, "%s |\n", gutter)
+	fmt.Fprintf(&b, "%s | %s\n", lineNo, d.SourceLine)
+	fmt.Fprintf(&b, "%s | %s%s\n", gutter, d.padding(), d.underline())
+	return b.String()
+}
+
+// 保留源码中的 tab, 保证 ^ 和出错的位置对齐, Column 按字符计数, 宽字符占两列
+func (d *Diagnostic) padding() string {
+	var b strings.Builder
+	for _, r := range d.SourceLine[:d.columnIndex()] {
+		switch {
+		case r == '\t':
+			b.WriteByte('\t')
+		case isWide(r):
+			b.WriteString("  ")
+		default:
+			b.WriteByte(' ')
+		}
+	}
+	return b.String()
+}
+
+func (d *Diagnostic) underline() string {
+	start := d.columnIndex()
+	end := start + d.Span.End - d.Span.Start
+	// 跨行的 token 只标注第一行
+	if end > len(d.SourceLine) {
+		end = len(d.SourceLine)
+	}
+	width := displayWidth(d.SourceLine[start:end])
+	if width < 1 {
+		width = 1
+	}
+	return "^" + strings.Repeat("~", width-1)
+}
+
+// columnIndex 第 Column 个字符在 SourceLine 中的字节偏移
+func (d *Diagnostic) columnIndex() int {
+	index := 0
+	for column := 1; column < d.Column && index < len(d.SourceLine); column++ {
+		_, size := utf8.DecodeRuneInString(d.SourceLine[index:])
+		index += size
+	}
+	return index
+}
+
+// displayWidth 字符串在终端中占的列数
+func displayWidth(text string) int {
+	width := 0
+	for _, r := range text {
+		if isWide(r) {
+			width += 2
+		} else {
+			width++
+		}
+	}
+	return width
+}
+
+// isWide 东亚宽字符和 emoji 在终端中占两列
+func isWide(r rune) bool {
+	return r >= 0x1100 && r <= 0x115F || // 谚文字母
+		r >= 0x2E80 && r <= 0x303E || // CJK 部首和标点
+		r >= 0x3041 && r <= 0x33FF || // 假名和 CJK 符号
+		r >= 0x3400 && r <= 0x4DBF || // CJK 扩展 A
+		r >= 0x4E00 && r <= 0x9FFF || // CJK 统一汉字
+		r >= 0xA000 && r <= 0xA4CF || // 彝文
+		r >= 0xAC00 && r <= 0xD7A3 || // 谚文音节
+		r >= 0xF900 && r <= 0xFAFF || // CJK 兼容汉字
+		r >= 0xFE30 && r <= 0xFE4F || // CJK 兼容形式
+		r >= 0xFF00 && r <= 0xFF60 || // 全角字符
+		r >= 0xFFE0 && r <= 0xFFE6 ||
+		r >= 0x1F300 && r <= 0x1F64F || // emoji
+		r >= 0x1F900 && r <= 0x1F9FF ||
+		r >= 0x20000 && r <= 0x3FFFD // CJK 扩展 B 之后
+}
+
+// Diagnostics 一次编译中出现的所有诊断信息
+type Diagnostics []*Diagnostic
+
+func (ds Diagnostics) Error() string {
+	lines := make([]string, 0, len(ds))
+	for _, item := range ds {
+		lines = append(lines, item.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// sourceLine 找到 offset 所在的整行
+func sourceLine(source string, offset int) string {
+	if offset > len(source) {
+		offset = len(source)
+	}
+	start := strings.LastIndexByte(source[:offset], '\n') + 1
+	end := strings.IndexByte(source[offset:], '\n')
+	if end < 0 {
+		end = len(source)
+	} else {
+		end += offset
+	}
+	return strings.TrimRight(source[start:end], "\r")
+}
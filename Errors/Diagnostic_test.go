@@ -0,0 +1,70 @@
+package Errors
+
+import (
+	"github.com/trueabc/lox/Token"
+	"testing"
+)
+
+// diagnostic 在 source 中第一个 lexeme 相同的 token 处创建诊断信息
+func diagnostic(t *testing.T, source, lexeme string) *Diagnostic {
+	reporter := NewReporter("test.lox", source)
+	for _, token := range Token.NewScanner(source, reporter).ScanTokens() {
+		if token.Lexeme == lexeme {
+			return reporter.NewDiagnostic(token, SeverityError, " at '"+lexeme+"'", "Message.")
+		}
+	}
+	t.Fatalf("no token %q in %q", lexeme, source)
+	return nil
+}
+
+func TestExcerpt(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  string
+		lexeme  string
+		excerpt string
+	}{
+		{"ascii", "print a + b;", "+",
+			" --> test.lox:1:9\n  |\n1 | print a + b;\n  |         ^\n"},
+		{"tabs are kept", "\tprint a\t+ b;", "+",
+			" --> test.lox:1:10\n  |\n1 | \tprint a\t+ b;\n  | \t       \t^\n"},
+		{"wide characters before the token", "print \"你好\" + 1;", "+",
+			" --> test.lox:1:12\n  |\n1 | print \"你好\" + 1;\n  |              ^\n"},
+		{"wide token", "print \"你好\" + 1;", "\"你好\"",
+			" --> test.lox:1:7\n  |\n1 | print \"你好\" + 1;\n  |       ^~~~~~\n"},
+		{"emoji", "print \"😀\" + 1;", "+",
+			" --> test.lox:1:11\n  |\n1 | print \"😀\" + 1;\n  |            ^\n"},
+		{"fullwidth", "print \"ＡＢ\"; x", "x",
+			" --> test.lox:1:13\n  |\n1 | print \"ＡＢ\"; x\n  |               ^\n"},
+		{"multi-line token", "print 1;\nprint \"ab\ncd\";", "\"ab\ncd\"",
+			" --> test.lox:2:7\n  |\n2 | print \"ab\n  |       ^~~\n"},
+		{"end of input", "print 1", "",
+			" --> test.lox:1:8\n  |\n1 | print 1\n  |        ^\n"},
+		{"gutter", "\n\n\n\n\n\n\n\n\nprint a;", "a",
+			"  --> test.lox:10:7\n   |\n10 | print a;\n   |       ^\n"},
+	}
+	for _, test := range tests {
+		if got := diagnostic(t, test.source, test.lexeme).Excerpt(); got != test.excerpt {
+			t.Errorf("%s: got\n%s\nwant\n%s", test.name, got, test.excerpt)
+		}
+	}
+}
+
+// 没有源码时只输出位置
+func TestExcerptWithoutSource(t *testing.T) {
+	d := &Diagnostic{Line: 3, Column: 5, Severity: SeverityError, Message: "Message."}
+	want := "[line 3] Error: Message.\n --> script:3:5\n"
+	if got := d.Render(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestRender(t *testing.T) {
+	d := diagnostic(t, "var a = 1;\nprint a + b + c;", "c")
+	d.Severity, d.Code, d.Where, d.Message = SeverityWarning, "undefined-global", " at 'c'", "Undefined variable 'c'."
+	want := "[line 2] Warning[undefined-global] at 'c': Undefined variable 'c'.\n" +
+		" --> test.lox:2:15\n  |\n2 | print a + b + c;\n  |               ^\n"
+	if got := d.Render(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
@@ -1,32 +1,79 @@
 package Errors
 
 import (
-	"fmt"
-	"github.com/trueabc/lox/Logger"
 	"github.com/trueabc/lox/Token"
+	"sort"
 )
 
-var HadError = false
-var HadRunTimeError = false
+// Reporter 收集一次编译中的诊断信息, 代替原来的全局 HadError
+type Reporter struct {
+	File   string
+	Source string
 
-func report(line int, where, message string) string {
-	HadError = true
-	data := fmt.Sprintf("[line %d ] Error %v : %v", line, where, message)
-	Logger.Errorf(data)
-	return data
+	Diagnostics Diagnostics
 }
 
-func LoxError(token *Token.Token, mess string) string {
+func NewReporter(file, source string) *Reporter {
+	return &Reporter{File: file, Source: source, Diagnostics: make(Diagnostics, 0)}
+}
+
+func (r *Reporter) HadError() bool {
+	for _, item := range r.Diagnostics {
+		if item.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// NewDiagnostic 根据 token 的位置创建诊断信息
+func (r *Reporter) NewDiagnostic(token *Token.Token, severity Severity, where, message string) *Diagnostic {
+	return &Diagnostic{
+		File:       r.File,
+		Line:       token.Line,
+		Column:     token.Column,
+		Span:       Span{token.Offset, token.End()},
+		Severity:   severity,
+		Where:      where,
+		Message:    message,
+		SourceLine: sourceLine(r.Source, token.Offset),
+	}
+}
+
+func (r *Reporter) report(token *Token.Token, where, message string) *Diagnostic {
+	d := r.NewDiagnostic(token, SeverityError, where, message)
+	r.add(d)
+	return d
+}
+
+// add 按照在源码中的位置插入, 词法错误先于语法错误产生, 但是输出时按照出现的顺序
+// 位置相同时保留报告的顺序
+func (r *Reporter) add(d *Diagnostic) {
+	index := sort.Search(len(r.Diagnostics), func(i int) bool {
+		return r.Diagnostics[i].Span.Start > d.Span.Start
+	})
+	r.Diagnostics = append(r.Diagnostics, nil)
+	copy(r.Diagnostics[index+1:], r.Diagnostics[index:])
+	r.Diagnostics[index] = d
+}
+
+func (r *Reporter) LoxError(token *Token.Token, mess string) *Diagnostic {
 	if token.TType == Token.EOF {
-		return report(token.Line, " at end", mess)
+		return r.report(token, " at end", mess)
 	} else {
-		return report(token.Line, "at '"+token.Lexeme+"'", mess)
+		return r.report(token, " at '"+token.Lexeme+"'", mess)
 	}
 }
 
-func LoxRuntimeError(token *Token.Token, mess string) {
-	HadRunTimeError = true
-	// todo need to be panic
-	report(token.Line, "at '"+token.Lexeme+"'",
-		mess)
+// ScanError 词法错误没有对应的 token, 直接使用扫描到的位置
+func (r *Reporter) ScanError(line, column, offset, length int, message string) {
+	r.add(&Diagnostic{
+		File:       r.File,
+		Line:       line,
+		Column:     column,
+		Span:       Span{offset, offset + length},
+		Severity:   SeverityError,
+		Message:    message,
+		SourceLine: sourceLine(r.Source, offset),
+	})
 }
@@ -0,0 +1,226 @@
+package Lox
+
+import (
+	"github.com/trueabc/lox/Errors"
+	"github.com/trueabc/lox/Syntax"
+	"github.com/trueabc/lox/Token"
+	"io"
+	"os"
+	"strings"
+)
+
+// VM 可以嵌入到其他程序中的解释器, 每个 VM 拥有独立的全局变量和错误状态
+// 多个 VM 可以在同一个进程中同时运行
+type VM struct {
+	interpreter *Syntax.Interpreter
+	// 非 nil 时使用字节码后端, interpreter 只用于 Resolver 的检查
+	machine *Syntax.VM
+}
+
+// NewVM 使用树遍历解释器, stdout 接收 print 的输出, stderr 给 native 函数使用
+func NewVM(stdout, stderr io.Writer) *VM {
+	return &VM{interpreter: Syntax.NewInterpreter(stdout, stderr)}
+}
+
+// NewBytecodeVM 把语法树编译为字节码, 在栈虚拟机上执行
+// interpreter 只用于 Resolver 的检查, 以及作为 native 函数的参数
+func NewBytecodeVM(stdout, stderr io.Writer) *VM {
+	interpreter := Syntax.NewInterpreter(stdout, stderr)
+	return &VM{interpreter: interpreter, machine: Syntax.NewVM(interpreter)}
+}
+
+// Run 执行一段源码, 编译错误返回 Errors.Diagnostics, 运行时错误返回 *Syntax.RuntimeError
+// 同一个 VM 多次 Run 共享全局变量
+func (vm *VM) Run(source string) error {
+	return vm.run(source, "")
+}
+
+func (vm *VM) run(source, file string) error {
+	stmts, _, reporter, err := vm.parse(source, file)
+	if err != nil {
+		return err
+	}
+	return vm.execute(stmts, reporter)
+}
+
+// Parse 只做词法分析和语法分析, 不执行 Resolver 的检查, 语法错误返回 Errors.Diagnostics
+// 有语法错误时仍然返回能解析的语句, 所有错误按照在源码中的位置排列
+// file 只用于错误信息
+func Parse(source, file string) ([]Syntax.Stmt, error) {
+	stmts, _, _, err := parse(source, file)
+	return stmts, err
+}
+
+// parse 同时返回 parser, 调试器需要其中每个语句所在的行
+func parse(source, file string) ([]Syntax.Stmt, *Syntax.Parser, *Errors.Reporter, error) {
+	reporter := Errors.NewReporter(file, source)
+	scanner := Token.NewScanner(source, reporter)
+	tokens := scanner.ScanTokens()
+
+	parser := Syntax.NewParser(tokens, reporter)
+	stmts := parser.Parse()
+	if reporter.HadError() {
+		return stmts, parser, reporter, reporter.Diagnostics
+	}
+	return stmts, parser, reporter, nil
+}
+
+// parse 词法分析, 语法分析和 Resolver 的检查, 编译错误返回 Errors.Diagnostics
+func (vm *VM) parse(source, file string) ([]Syntax.Stmt, *Syntax.Parser, *Errors.Reporter, error) {
+	stmts, parser, reporter, err := parse(source, file)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if err := vm.resolve(stmts, reporter, file); err != nil {
+		return nil, nil, nil, err
+	}
+	return stmts, parser, reporter, nil
+}
+
+// resolve Resolver 的检查, 错误返回 Errors.Diagnostics
+func (vm *VM) resolve(stmts []Syntax.Stmt, reporter *Errors.Reporter, file string) error {
+	vm.interpreter.SetFile(file)
+	vm.interpreter.SetReporter(reporter)
+	resolver := Syntax.NewResolver(vm.interpreter, reporter)
+	resolver.ResolveStmts(stmts)
+	if reporter.HadError() {
+		return reporter.Diagnostics
+	}
+	return nil
+}
+
+func (vm *VM) execute(stmts []Syntax.Stmt, reporter *Errors.Reporter) error {
+	var err error
+	if vm.machine != nil {
+		function := Syntax.NewCompiler(reporter).Compile(stmts)
+		if reporter.HadError() {
+			return reporter.Diagnostics
+		}
+		err = vm.machine.Interpret(function)
+	} else {
+		err = vm.interpreter.Interpret(stmts)
+	}
+	return locate(err, reporter)
+}
+
+// locate 给运行时错误补充源码位置, import 的模块中的错误已经带有模块的位置信息
+func locate(err error, reporter *Errors.Reporter) error {
+	if runtimeErr, ok := err.(*Syntax.RuntimeError); ok && runtimeErr.Diagnostic == nil {
+		runtimeErr.Diagnostic = reporter.NewDiagnostic(runtimeErr.Token,
+			Errors.SeverityError, "", runtimeErr.Content)
+		return runtimeErr
+	}
+	return err
+}
+
+// Eval 用于 REPL, source 只有一个表达式语句时返回它的值和 true, 表达式末尾的分号可以省略
+// 其他情况与 Run 一样执行
+func (vm *VM) Eval(source string) (interface{}, bool, error) {
+	stmts, _, reporter, err := vm.parse(source, "")
+	if err != nil {
+		trimmed := strings.TrimSpace(source)
+		if strings.HasSuffix(trimmed, ";") || strings.HasSuffix(trimmed, "}") {
+			return nil, false, err
+		}
+		// 换行避免分号被行尾的注释吞掉
+		stmts, _, reporter, err = vm.parse(source+"\n;", "")
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
+	var expr Syntax.Expr
+	if len(stmts) == 1 {
+		expr, _ = Syntax.ExpressionOf(stmts[0])
+	}
+	if expr == nil {
+		return nil, false, vm.execute(stmts, reporter)
+	}
+
+	var value interface{}
+	if vm.machine != nil {
+		function := Syntax.NewCompiler(reporter).CompileExpression(expr)
+		if reporter.HadError() {
+			return nil, false, reporter.Diagnostics
+		}
+		value, err = vm.machine.Evaluate(function)
+	} else {
+		value, err = vm.interpreter.Evaluate(expr)
+	}
+	return value, true, locate(err, reporter)
+}
+
+// RunFile 读取文件并执行, 读取失败时返回对应的 os 错误
+func (vm *VM) RunFile(path string) error {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return vm.run(string(source), path)
+}
+
+// DebugFile 使用树遍历解释器执行文件, 每个语句执行之前调用 hook, 见 Syntax.DebugHook
+// hook 返回 false 时中止执行并返回 Syntax.ErrDebugStopped
+func (vm *VM) DebugFile(path string, hook Syntax.DebugHook) error {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	stmts, parser, reporter, err := vm.parse(string(source), path)
+	if err != nil {
+		return err
+	}
+	vm.interpreter.SetDebugHook(parser.Lines(), hook)
+	defer vm.interpreter.SetDebugHook(nil, nil)
+	return locate(vm.interpreter.Interpret(stmts), reporter)
+}
+
+// RunAST 执行由 Syntax.UnmarshalAST 得到的语法树, 没有源码, 错误信息中只有位置
+// file 作为 import 的相对路径的起点
+func (vm *VM) RunAST(stmts []Syntax.Stmt, file string) error {
+	reporter := Errors.NewReporter(file, "")
+	if err := vm.resolve(stmts, reporter, file); err != nil {
+		return err
+	}
+	return vm.execute(stmts, reporter)
+}
+
+// SetStdin 设置 io.readLine 读取的输入, 默认为 os.Stdin
+func (vm *VM) SetStdin(stdin io.Reader) {
+	vm.interpreter.SetStdin(stdin)
+}
+
+// Define 向全局作用域注入一个值
+func (vm *VM) Define(name string, value interface{}) {
+	if vm.machine != nil {
+		vm.machine.Define(name, value)
+		return
+	}
+	vm.interpreter.Define(name, value)
+}
+
+// RegisterNative 向这个 VM 注册一个 native 函数, arity 为 Syntax.Variadic 时接受任意个数的参数
+// 返回的 error 会成为 lox 的运行时错误
+func (vm *VM) RegisterNative(name string, arity int, function Syntax.NativeFunc) {
+	if vm.machine != nil {
+		vm.machine.RegisterNative(name, arity, function)
+		return
+	}
+	vm.interpreter.RegisterNative(name, arity, function)
+}
+
+// Globals 所有全局变量的副本, 包括 native 函数和模块
+func (vm *VM) Globals() map[string]interface{} {
+	if vm.machine != nil {
+		return vm.machine.Globals()
+	}
+	return vm.interpreter.Globals()
+}
+
+// Global 读取全局变量的值
+func (vm *VM) Global(name string) (interface{}, bool) {
+	if vm.machine != nil {
+		return vm.machine.Global(name)
+	}
+	return vm.interpreter.Global(name)
+}
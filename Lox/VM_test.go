@@ -0,0 +1,191 @@
+package Lox
+
+import (
+	"errors"
+	"github.com/trueabc/lox/Errors"
+	"github.com/trueabc/lox/Syntax"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// backends 两个后端分别运行同样的测试
+var backends = map[string]func(stdout, stderr io.Writer) *VM{
+	"interpreter": NewVM,
+	"bytecode":    NewBytecodeVM,
+}
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, source := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(source), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// import 的函数中的运行时错误, 位置信息来自定义函数的文件, 而不是入口文件
+func TestImportedFunctionErrorLocation(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"lib.lox":  "// 模块\nfun fail(x) {\n  return x + nil;\n}\n",
+		"main.lox": "import lib from \"lib.lox\";\nprint \"start\";\nlib.fail(1);\n",
+		"rethrow.lox": "import lib from \"lib.lox\";\nfun again() {\n  try {\n    lib.fail(1);\n" +
+			"  } catch (e) {\n    throw e;\n  }\n}\nagain();\n",
+	})
+	lib := filepath.Join(dir, "lib.lox")
+	for name, newVM := range backends {
+		for _, entry := range []string{"main.lox", "rethrow.lox"} {
+			err := newVM(io.Discard, io.Discard).RunFile(filepath.Join(dir, entry))
+			runtimeErr, ok := err.(*Syntax.RuntimeError)
+			if !ok || runtimeErr.Diagnostic == nil {
+				t.Fatalf("%s %s: expected a runtime error with a location, got %v", name, entry, err)
+			}
+			d := runtimeErr.Diagnostic
+			if d.File != lib || d.Line != 3 || d.SourceLine != "  return x + nil;" || d.Column != 12 {
+				t.Errorf("%s %s: error located at %s:%d:%d %q", name, entry, d.File, d.Line, d.Column, d.SourceLine)
+			}
+		}
+	}
+}
+
+// 两个 VM 的全局变量互不影响, 同一个 VM 多次 Run 共享全局变量
+func TestSeparateGlobals(t *testing.T) {
+	for name, newVM := range backends {
+		var out1, out2 strings.Builder
+		vm1, vm2 := newVM(&out1, io.Discard), newVM(&out2, io.Discard)
+		if err := vm1.Run("var x = 1; fun get() { return x; }"); err != nil {
+			t.Fatal(err)
+		}
+		if err := vm2.Run("var x = \"two\";"); err != nil {
+			t.Fatal(err)
+		}
+		if err := vm1.Run("x = x + 1; print get();"); err != nil {
+			t.Fatal(err)
+		}
+		if err := vm2.Run("print x;"); err != nil {
+			t.Fatal(err)
+		}
+		if out1.String() != "2\n" || out2.String() != "two\n" {
+			t.Errorf("%s: got outputs %q and %q", name, out1.String(), out2.String())
+		}
+		if x, ok := vm1.Global("x"); !ok || x != 2.0 {
+			t.Errorf("%s: vm1 x = %v", name, x)
+		}
+		if _, ok := vm2.Global("get"); ok {
+			t.Errorf("%s: function defined in vm1 is visible in vm2", name)
+		}
+
+		// Define 只影响一个 VM
+		vm2.Define("answer", 42.0)
+		if err := vm1.Run("print answer;"); err == nil {
+			t.Errorf("%s: expected answer to be undefined in vm1", name)
+		}
+		out2.Reset()
+		if err := vm2.Run("print answer;"); err != nil || out2.String() != "42\n" {
+			t.Errorf("%s: got %q, %v", name, out2.String(), err)
+		}
+	}
+}
+
+// 每个 VM 从自己的输入读取, 同时运行的两个 VM 互不影响
+func TestSeparateStdin(t *testing.T) {
+	for name, newVM := range backends {
+		var out1, out2 strings.Builder
+		vm1, vm2 := newVM(&out1, io.Discard), newVM(&out2, io.Discard)
+		vm1.SetStdin(strings.NewReader("a\nb\n"))
+		vm2.SetStdin(strings.NewReader("c\n"))
+		script := "var line = io.readLine();\nwhile (line != nil) {\n  print line;\n  line = io.readLine();\n}\n"
+		done := make(chan error)
+		go func() { done <- vm1.Run(script) }()
+		go func() { done <- vm2.Run(script) }()
+		for k := 0; k < 2; k++ {
+			if err := <-done; err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+		}
+		if out1.String() != "a\nb\n" || out2.String() != "c\n" {
+			t.Errorf("%s: got outputs %q and %q", name, out1.String(), out2.String())
+		}
+	}
+}
+
+// RegisterNative 的函数可以在 lox 中调用, 返回的 error 成为运行时错误
+func TestRegisterNative(t *testing.T) {
+	for name, newVM := range backends {
+		var out strings.Builder
+		vm := newVM(&out, io.Discard)
+		calls := 0
+		vm.RegisterNative("twice", 1, func(interpreter *Syntax.Interpreter, args []interface{}) (interface{}, error) {
+			calls++
+			n, ok := args[0].(float64)
+			if !ok {
+				return nil, errors.New("twice() expects a number.")
+			}
+			return n * 2, nil
+		})
+		vm.RegisterNative("count", Syntax.Variadic, func(interpreter *Syntax.Interpreter, args []interface{}) (interface{}, error) {
+			return float64(len(args)), nil
+		})
+
+		if err := vm.Run("print twice(21);\nprint count();\nprint count(1, 2, 3);\nvar f = twice;\nprint f(f(1));"); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if out.String() != "42\n0\n3\n4\n" || calls != 3 {
+			t.Errorf("%s: got %q after %d calls", name, out.String(), calls)
+		}
+
+		err := vm.Run("print 1;\nprint twice(\"a\");")
+		runtimeErr, ok := err.(*Syntax.RuntimeError)
+		if !ok || runtimeErr.Content != "twice() expects a number." || runtimeErr.Diagnostic == nil ||
+			runtimeErr.Diagnostic.Line != 2 {
+			t.Errorf("%s: expected a runtime error on line 2, got %v", name, err)
+		}
+		if err := vm.Run("twice(1, 2);"); err == nil || err.(*Syntax.RuntimeError).Content != "Expected 1 arguments but got 2." {
+			t.Errorf("%s: expected an arity error, got %v", name, err)
+		}
+
+		// 只注册到这个 VM
+		if err := newVM(io.Discard, io.Discard).Run("twice(1);"); err == nil {
+			t.Errorf("%s: twice is defined in a new VM", name)
+		}
+	}
+}
+
+// 一个文件中的多个语法错误都会报告, 按照在源码中的位置排列, 同时返回能解析的语句
+func TestParseReportsAllErrors(t *testing.T) {
+	source := "print 1;\nvar = 2;\nprint 3;\nprint (4;\nvar s = \"ok\" @;\nfun f( {}\nprint 5;\n"
+	stmts, err := Parse(source, "errors.lox")
+	diagnostics, ok := err.(Errors.Diagnostics)
+	if !ok {
+		t.Fatalf("expected diagnostics, got %v", err)
+	}
+	want := []string{
+		"[line 2] Error at '=': Expect variable name.",
+		"[line 4] Error at ';': Expect ')' after expression.",
+		"[line 5] Error: Unexpected character.",
+		"[line 6] Error at '{': Expect parameter name.",
+	}
+	got := make([]string, 0, len(diagnostics))
+	for _, d := range diagnostics {
+		got = append(got, d.Error())
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got errors:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	// print 1, print 3, var s 和 print 5
+	if len(stmts) != 4 {
+		t.Errorf("expected 4 statements, got %d: %s", len(stmts), Syntax.NewAstPrinter().PrintStmts(stmts))
+	}
+
+	// 执行时返回同样的错误, 不执行任何语句
+	for name, newVM := range backends {
+		var out strings.Builder
+		err := newVM(&out, io.Discard).Run(source)
+		if err == nil || err.Error() != diagnostics.Error() || out.Len() != 0 {
+			t.Errorf("%s: got output %q and error %v", name, out.String(), err)
+		}
+	}
+}
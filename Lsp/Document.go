@@ -0,0 +1,70 @@
+package Lsp
+
+import (
+	"github.com/trueabc/lox/Syntax"
+	"github.com/trueabc/lox/Token"
+	"sort"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// document 打开的文件, 每次修改之后重新分析
+type document struct {
+	uri      string
+	text     string
+	lines    []int // 每一行开始的字节偏移
+	analysis *Syntax.Analysis
+}
+
+func newDocument(uri, text string) *document {
+	d := &document{uri: uri, text: text, lines: []int{0}}
+	for id := 0; id < len(text); id++ {
+		if text[id] == '\n' {
+			d.lines = append(d.lines, id+1)
+		}
+	}
+	d.analysis = Syntax.Analyze(text, uri)
+	return d
+}
+
+// position 字节偏移转换为 LSP 的位置, character 以 UTF-16 编码单元计算
+func (d *document) position(offset int) Position {
+	if offset > len(d.text) {
+		offset = len(d.text)
+	}
+	line := sort.Search(len(d.lines), func(id int) bool { return d.lines[id] > offset }) - 1
+	character := 0
+	for _, r := range d.text[d.lines[line]:offset] {
+		character += len(utf16.Encode([]rune{r}))
+	}
+	return Position{Line: line, Character: character}
+}
+
+// offset LSP 的位置转换为字节偏移, 超出行尾时返回行尾, 负数的位置返回行首或者文档的开头
+func (d *document) offset(position Position) int {
+	if position.Line < 0 {
+		return 0
+	}
+	if position.Line >= len(d.lines) {
+		return len(d.text)
+	}
+	offset := d.lines[position.Line]
+	for character := 0; character < position.Character && offset < len(d.text) && d.text[offset] != '\n'; {
+		r, size := utf8.DecodeRuneInString(d.text[offset:])
+		character += len(utf16.Encode([]rune{r}))
+		offset += size
+	}
+	return offset
+}
+
+func (d *document) span(start, end int) Range {
+	return Range{Start: d.position(start), End: d.position(end)}
+}
+
+func (d *document) tokenRange(token *Token.Token) Range {
+	return d.span(token.Offset, token.End())
+}
+
+func (d *document) location(token *Token.Token) Location {
+	return Location{URI: d.uri, Range: d.tokenRange(token)}
+}
@@ -0,0 +1,296 @@
+package Lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/trueabc/lox/Errors"
+	"github.com/trueabc/lox/Syntax"
+	"github.com/trueabc/lox/Token"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Server 通过 stdio 与编辑器通信的语言服务器
+// 文档使用全量同步, 每次修改之后重新分析并发布诊断信息和 lint 的警告
+type Server struct {
+	in        *bufio.Reader
+	out       io.Writer
+	documents map[string]*document
+	shutdown  bool
+}
+
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{in: bufio.NewReader(in), out: out, documents: make(map[string]*document)}
+}
+
+// Serve 处理消息直到收到 exit, 没有先收到 shutdown 时返回错误
+func (s *Server) Serve() error {
+	for {
+		body, err := readMessage(s.in)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var req request
+		if err := json.Unmarshal(body, &req); err != nil {
+			s.replyError(nil, codeParseError, err.Error())
+			continue
+		}
+		if req.Method == "exit" {
+			if !s.shutdown {
+				return fmt.Errorf("exit without shutdown")
+			}
+			return nil
+		}
+		result, rpcErr := s.call(req.Method, req.Params)
+		// 通知不需要响应
+		if req.ID == nil {
+			continue
+		}
+		if rpcErr != nil {
+			s.replyError(req.ID, rpcErr.Code, rpcErr.Message)
+		} else {
+			writeMessage(s.out, &response{JSONRPC: "2.0", ID: req.ID, Result: result})
+		}
+	}
+}
+
+// call 处理一个消息, 其中的 panic 作为内部错误返回, 一个出错的请求不会结束整个会话
+func (s *Server) call(method string, params json.RawMessage) (result interface{}, rpcErr *responseError) {
+	defer func() {
+		if r := recover(); r != nil {
+			result, rpcErr = nil, &responseError{Code: codeInternalError, Message: fmt.Sprintf("internal error: %v", r)}
+		}
+	}()
+	return s.handle(method, params)
+}
+
+func (s *Server) replyError(id *json.RawMessage, code int, message string) {
+	writeMessage(s.out, &errorResponse{JSONRPC: "2.0", ID: id,
+		Error: &responseError{Code: code, Message: message}})
+}
+
+func (s *Server) handle(method string, raw json.RawMessage) (interface{}, *responseError) {
+	decode := func(params interface{}) *responseError {
+		if err := json.Unmarshal(raw, params); err != nil {
+			return &responseError{Code: codeInvalidParams, Message: err.Error()}
+		}
+		return nil
+	}
+
+	switch method {
+	case "initialize":
+		return map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"textDocumentSync":   1,
+				"definitionProvider": true,
+				"referencesProvider": true,
+				"hoverProvider":      true,
+				"completionProvider": map[string]interface{}{"triggerCharacters": []string{}},
+			},
+			"serverInfo": map[string]string{"name": "go-lox"},
+		}, nil
+	case "initialized":
+		return nil, nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+	case "textDocument/didOpen":
+		var params DidOpenTextDocumentParams
+		if err := decode(&params); err != nil {
+			return nil, err
+		}
+		s.update(params.TextDocument.URI, params.TextDocument.Text)
+		return nil, nil
+	case "textDocument/didChange":
+		var params DidChangeTextDocumentParams
+		if err := decode(&params); err != nil {
+			return nil, err
+		}
+		if len(params.ContentChanges) != 0 {
+			s.update(params.TextDocument.URI, params.ContentChanges[len(params.ContentChanges)-1].Text)
+		}
+		return nil, nil
+	case "textDocument/didClose":
+		var params DidCloseTextDocumentParams
+		if err := decode(&params); err != nil {
+			return nil, err
+		}
+		delete(s.documents, params.TextDocument.URI)
+		s.notify("textDocument/publishDiagnostics",
+			&PublishDiagnosticsParams{URI: params.TextDocument.URI, Diagnostics: []Diagnostic{}})
+		return nil, nil
+	case "textDocument/definition":
+		var params TextDocumentPositionParams
+		if err := decode(&params); err != nil {
+			return nil, err
+		}
+		return s.definition(params), nil
+	case "textDocument/references":
+		var params ReferenceParams
+		if err := decode(&params); err != nil {
+			return nil, err
+		}
+		return s.references(params), nil
+	case "textDocument/hover":
+		var params TextDocumentPositionParams
+		if err := decode(&params); err != nil {
+			return nil, err
+		}
+		return s.hover(params), nil
+	case "textDocument/completion":
+		var params TextDocumentPositionParams
+		if err := decode(&params); err != nil {
+			return nil, err
+		}
+		return s.completion(params), nil
+	}
+	// 不支持的通知直接忽略, 例如 $/cancelRequest
+	return nil, &responseError{Code: codeMethodNotFound, Message: "method not found: " + method}
+}
+
+func (s *Server) notify(method string, params interface{}) {
+	writeMessage(s.out, &notification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+// update 重新分析文档并发布诊断信息
+func (s *Server) update(uri, text string) {
+	doc := newDocument(uri, text)
+	s.documents[uri] = doc
+	diagnostics := make([]Diagnostic, 0, len(doc.analysis.Diagnostics))
+	for _, item := range doc.analysis.Diagnostics {
+		diagnostics = append(diagnostics, s.diagnostic(doc, item))
+	}
+	// 有语法错误时语法树不完整, lint 的结果没有意义
+	if len(doc.analysis.Diagnostics) == 0 {
+		for _, item := range doc.analysis.Lint() {
+			diagnostics = append(diagnostics, s.diagnostic(doc, item))
+		}
+	}
+	s.notify("textDocument/publishDiagnostics", &PublishDiagnosticsParams{URI: uri, Diagnostics: diagnostics})
+}
+
+func (s *Server) diagnostic(doc *document, item *Errors.Diagnostic) Diagnostic {
+	end := item.Span.End
+	if end <= item.Span.Start {
+		end = item.Span.Start + 1
+	}
+	// Errors.Severity 的取值与 LSP 的 DiagnosticSeverity 相同
+	return Diagnostic{Range: doc.span(item.Span.Start, end), Severity: int(item.Severity),
+		Code: item.Code, Source: "lox", Message: item.Message}
+}
+
+// symbolAt 光标所在的 token 和它对应的符号
+func (s *Server) symbolAt(params TextDocumentPositionParams) (*document, *Token.Token, *Syntax.Symbol) {
+	doc, ok := s.documents[params.TextDocument.URI]
+	if !ok {
+		return nil, nil, nil
+	}
+	token := doc.analysis.TokenAt(doc.offset(params.Position))
+	if token == nil {
+		return doc, nil, nil
+	}
+	return doc, token, doc.analysis.SymbolOf(token)
+}
+
+func (s *Server) definition(params TextDocumentPositionParams) interface{} {
+	doc, _, symbol := s.symbolAt(params)
+	if symbol == nil {
+		return nil
+	}
+	return doc.location(symbol.Name)
+}
+
+func (s *Server) references(params ReferenceParams) []Location {
+	doc, _, symbol := s.symbolAt(params.TextDocumentPositionParams)
+	locations := make([]Location, 0)
+	if symbol == nil {
+		return locations
+	}
+	if params.Context.IncludeDeclaration {
+		locations = append(locations, doc.location(symbol.Name))
+	}
+	for _, tokens := range [][]*Token.Token{symbol.References, symbol.Writes} {
+		for _, token := range tokens {
+			locations = append(locations, doc.location(token))
+		}
+	}
+	return locations
+}
+
+func (s *Server) hover(params TextDocumentPositionParams) interface{} {
+	doc, token, symbol := s.symbolAt(params)
+	if symbol == nil {
+		return nil
+	}
+	return &Hover{Contents: MarkupContent{Kind: "markdown", Value: "```lox\n" + signature(symbol) + "\n```"},
+		Range: doc.tokenRange(token)}
+}
+
+// signature hover 中显示的声明, 类会列出所有方法
+func signature(symbol *Syntax.Symbol) string {
+	name := symbol.Name.Lexeme
+	switch symbol.Kind {
+	case Syntax.SymbolFunction:
+		return "fun " + name + params(symbol)
+	case Syntax.SymbolMethod:
+		return symbol.Class.Name.Lexeme + "." + name + params(symbol)
+	case Syntax.SymbolClass:
+		lines := []string{"class " + name}
+		if symbol.SuperClass != nil {
+			lines[0] += " < " + symbol.SuperClass.Lexeme
+		}
+		for _, method := range symbol.Methods {
+			lines = append(lines, "  "+method.Name.Lexeme+params(method))
+		}
+		return strings.Join(lines, "\n")
+	case Syntax.SymbolParameter:
+		return "(parameter) " + name
+	case Syntax.SymbolImport:
+		return "import " + name + " from \"" + symbol.Path + "\""
+	}
+	return "var " + name
+}
+
+func params(symbol *Syntax.Symbol) string {
+	names := make([]string, len(symbol.Params))
+	for id, param := range symbol.Params {
+		names[id] = param.Lexeme
+	}
+	return "(" + strings.Join(names, ", ") + ")"
+}
+
+func (s *Server) completion(params TextDocumentPositionParams) []CompletionItem {
+	items := make([]CompletionItem, 0)
+	doc, ok := s.documents[params.TextDocument.URI]
+	if !ok {
+		return items
+	}
+	for _, symbol := range doc.analysis.Visible(doc.offset(params.Position)) {
+		item := CompletionItem{Label: symbol.Name.Lexeme, Kind: completionVariable, Detail: symbol.Kind.String()}
+		switch symbol.Kind {
+		case Syntax.SymbolFunction:
+			item.Kind, item.Detail = completionFunction, signature(symbol)
+		case Syntax.SymbolClass:
+			item.Kind, item.Detail = completionClass, "class "+symbol.Name.Lexeme
+		case Syntax.SymbolImport:
+			item.Kind = completionModule
+		case Syntax.SymbolNative:
+			item.Kind = completionFunction
+		}
+		items = append(items, item)
+	}
+	keywords := make([]string, 0, len(Token.KEY_WORDS))
+	for keyword := range Token.KEY_WORDS {
+		keywords = append(keywords, keyword)
+	}
+	sort.Strings(keywords)
+	for _, keyword := range keywords {
+		items = append(items, CompletionItem{Label: keyword, Kind: completionKeyword})
+	}
+	return items
+}
@@ -0,0 +1,230 @@
+package Lsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+)
+
+// message 服务器发出的响应和通知
+type message struct {
+	ID     *int            `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Result json.RawMessage `json:"result"`
+	Error  *responseError  `json:"error"`
+}
+
+// session 依次发送 messages, 最后发送 shutdown 和 exit, 返回服务器的所有输出
+func session(t *testing.T, messages ...interface{}) []message {
+	return serverSession(t, nil, messages...)
+}
+
+// serverSession 和 session 相同, setup 不为 nil 时在开始之前修改服务器
+func serverSession(t *testing.T, setup func(*Server), messages ...interface{}) []message {
+	var in bytes.Buffer
+	messages = append(messages, map[string]interface{}{"jsonrpc": "2.0", "id": 1000, "method": "shutdown"},
+		map[string]interface{}{"jsonrpc": "2.0", "method": "exit"})
+	for _, msg := range messages {
+		if err := writeMessage(&in, msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var out bytes.Buffer
+	server := NewServer(&in, &out)
+	if setup != nil {
+		setup(server)
+	}
+	if err := server.Serve(); err != nil {
+		t.Fatal(err)
+	}
+
+	replies := make([]message, 0)
+	reader := bufio.NewReader(&out)
+	for {
+		body, err := readMessage(reader)
+		if err == io.EOF {
+			return replies
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		var reply message
+		if err := json.Unmarshal(body, &reply); err != nil {
+			t.Fatal(err)
+		}
+		replies = append(replies, reply)
+	}
+}
+
+func didOpen(uri, text string) interface{} {
+	return map[string]interface{}{"jsonrpc": "2.0", "method": "textDocument/didOpen",
+		"params": map[string]interface{}{
+			"textDocument": map[string]interface{}{"uri": uri, "languageId": "lox", "version": 1, "text": text}}}
+}
+
+func positionRequest(id int, method, uri string, line, character int) interface{} {
+	return map[string]interface{}{"jsonrpc": "2.0", "id": id, "method": method,
+		"params": TextDocumentPositionParams{TextDocument: TextDocumentIdentifier{URI: uri},
+			Position: Position{Line: line, Character: character}}}
+}
+
+// reply id 对应的响应
+func reply(t *testing.T, replies []message, id int) message {
+	for _, item := range replies {
+		if item.ID != nil && *item.ID == id {
+			return item
+		}
+	}
+	t.Fatalf("no reply for request %d in %v", id, replies)
+	return message{}
+}
+
+func decode(t *testing.T, raw json.RawMessage, value interface{}) {
+	if err := json.Unmarshal(raw, value); err != nil {
+		t.Fatalf("%s: %v", raw, err)
+	}
+}
+
+const source = `fun add(a, b) {
+  return a + b;
+}
+var x = add(1, 2);
+print y;
+`
+
+func TestDiagnostics(t *testing.T) {
+	replies := session(t, didOpen("file:///a.lox", source), didOpen("file:///b.lox", "var = 1;\n"))
+	published := make(map[string][]Diagnostic)
+	for _, item := range replies {
+		if item.Method == "textDocument/publishDiagnostics" {
+			var params PublishDiagnosticsParams
+			decode(t, item.Params, &params)
+			published[params.URI] = params.Diagnostics
+		}
+	}
+
+	// 没有语法错误时发布 lint 的警告
+	want := Diagnostic{Range: Range{Start: Position{4, 6}, End: Position{4, 7}}, Severity: 2,
+		Code: "undefined-global", Source: "lox", Message: "Undefined variable 'y'."}
+	if got := published["file:///a.lox"]; len(got) != 1 || got[0] != want {
+		t.Errorf("a.lox: got diagnostics %+v, want %+v", got, want)
+	}
+	want = Diagnostic{Range: Range{Start: Position{0, 4}, End: Position{0, 5}}, Severity: 1,
+		Source: "lox", Message: "Expect variable name."}
+	if got := published["file:///b.lox"]; len(got) != 1 || got[0] != want {
+		t.Errorf("b.lox: got diagnostics %+v, want %+v", got, want)
+	}
+}
+
+func TestDefinition(t *testing.T) {
+	replies := session(t, didOpen("file:///a.lox", source),
+		positionRequest(1, "textDocument/definition", "file:///a.lox", 3, 9),
+		positionRequest(2, "textDocument/definition", "file:///a.lox", 1, 13),
+		positionRequest(3, "textDocument/definition", "file:///a.lox", 4, 6))
+
+	// add 的调用跳转到函数声明
+	var location Location
+	decode(t, reply(t, replies, 1).Result, &location)
+	want := Location{URI: "file:///a.lox", Range: Range{Start: Position{0, 4}, End: Position{0, 7}}}
+	if location != want {
+		t.Errorf("definition of add: got %+v, want %+v", location, want)
+	}
+	// 参数 b 跳转到参数列表
+	decode(t, reply(t, replies, 2).Result, &location)
+	want = Location{URI: "file:///a.lox", Range: Range{Start: Position{0, 11}, End: Position{0, 12}}}
+	if location != want {
+		t.Errorf("definition of b: got %+v, want %+v", location, want)
+	}
+	// 没有声明的变量返回 null
+	if result := string(reply(t, replies, 3).Result); result != "null" {
+		t.Errorf("definition of y: got %s, want null", result)
+	}
+}
+
+func TestHover(t *testing.T) {
+	replies := session(t, didOpen("file:///a.lox", source),
+		positionRequest(1, "textDocument/hover", "file:///a.lox", 3, 10),
+		positionRequest(2, "textDocument/hover", "file:///a.lox", 1, 9),
+		positionRequest(3, "textDocument/hover", "file:///a.lox", 3, 4))
+
+	tests := []struct {
+		id    int
+		value string
+		rng   Range
+	}{
+		{1, "```lox\nfun add(a, b)\n```", Range{Start: Position{3, 8}, End: Position{3, 11}}},
+		{2, "```lox\n(parameter) a\n```", Range{Start: Position{1, 9}, End: Position{1, 10}}},
+		{3, "```lox\nvar x\n```", Range{Start: Position{3, 4}, End: Position{3, 5}}},
+	}
+	for _, test := range tests {
+		var hover Hover
+		decode(t, reply(t, replies, test.id).Result, &hover)
+		if hover.Contents.Kind != "markdown" || hover.Contents.Value != test.value || hover.Range != test.rng {
+			t.Errorf("hover %d: got %+v, want %q at %+v", test.id, hover, test.value, test.rng)
+		}
+	}
+}
+
+// 不支持的请求返回错误, exit 之前没有 shutdown 时 Serve 返回错误
+func TestProtocolErrors(t *testing.T) {
+	replies := session(t, map[string]interface{}{"jsonrpc": "2.0", "id": 1, "method": "textDocument/rename"})
+	if err := reply(t, replies, 1).Error; err == nil || err.Code != codeMethodNotFound {
+		t.Errorf("expected method not found, got %+v", err)
+	}
+
+	var in, out bytes.Buffer
+	writeMessage(&in, map[string]interface{}{"jsonrpc": "2.0", "method": "exit"})
+	if err := NewServer(&in, &out).Serve(); err == nil {
+		t.Error("expected an error for exit without shutdown")
+	}
+}
+
+// Content-Length 是负数或者超过上限时 Serve 返回错误, 不会 panic 或者分配过多的内存
+func TestInvalidContentLength(t *testing.T) {
+	for _, length := range []string{"-1", "abc", "1099511627776"} {
+		in := bytes.NewBufferString("Content-Length: " + length + "\r\n\r\n{}")
+		var out bytes.Buffer
+		err := NewServer(in, &out).Serve()
+		if err == nil || !strings.Contains(err.Error(), "invalid Content-Length") {
+			t.Errorf("Content-Length %s: got %v, want an invalid Content-Length error", length, err)
+		}
+	}
+}
+
+// 负数或者超出文档的位置不会让服务器 panic
+func TestOutOfRangePosition(t *testing.T) {
+	positions := []Position{{-1, 0}, {0, -1}, {-5, -5}, {100, 0}, {0, 100}}
+	methods := []string{"textDocument/hover", "textDocument/definition", "textDocument/completion"}
+	messages := []interface{}{didOpen("file:///a.lox", source)}
+	for k, position := range positions {
+		for j, method := range methods {
+			messages = append(messages, positionRequest(k*len(methods)+j, method, "file:///a.lox",
+				position.Line, position.Character))
+		}
+	}
+	replies := session(t, messages...)
+	for k, position := range positions {
+		for j, method := range methods {
+			if err := reply(t, replies, k*len(methods)+j).Error; err != nil {
+				t.Errorf("%s at %+v: got error %+v", method, position, err)
+			}
+		}
+	}
+}
+
+// 处理请求时的 panic 作为内部错误返回, 服务器继续处理之后的消息
+func TestInternalError(t *testing.T) {
+	request := didOpen("file:///a.lox", source).(map[string]interface{})
+	request["id"] = 1
+	replies := serverSession(t, func(server *Server) { server.documents = nil }, request)
+	if err := reply(t, replies, 1).Error; err == nil || err.Code != codeInternalError {
+		t.Errorf("expected an internal error, got %+v", err)
+	}
+	if err := reply(t, replies, 1000).Error; err != nil {
+		t.Errorf("expected shutdown to succeed after the internal error, got %+v", err)
+	}
+}
@@ -0,0 +1,83 @@
+package Repl
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// 历史记录最多保留的行数
+const maxHistory = 1000
+
+// History 输入过的行, 保存在文件中以便下次启动时使用
+// 多行的输入按行保存, 和在终端中编辑时一致
+type History struct {
+	path    string
+	entries []string
+}
+
+// DefaultHistoryPath 优先使用 LOX_HISTORY 环境变量, 否则为 ~/.lox_history
+func DefaultHistoryPath() string {
+	if path := os.Getenv("LOX_HISTORY"); path != "" {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".lox_history")
+}
+
+// LoadHistory 读取历史文件, path 为空时只在内存中保存
+// 文件不存在或者无法读取时从空的历史开始
+func LoadHistory(path string) *History {
+	h := &History{path: path, entries: make([]string, 0)}
+	if path == "" {
+		return h
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return h
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if scanner.Text() != "" {
+			h.entries = append(h.entries, scanner.Text())
+		}
+	}
+	if len(h.entries) > maxHistory {
+		h.entries = h.entries[len(h.entries)-maxHistory:]
+		h.rewrite()
+	}
+	return h
+}
+
+func (h *History) Entries() []string {
+	return h.entries
+}
+
+// Add 记录一行输入并追加到文件中, 空行和与上一行相同的输入不记录
+func (h *History) Add(line string) {
+	if strings.TrimSpace(line) == "" || (len(h.entries) != 0 && h.entries[len(h.entries)-1] == line) {
+		return
+	}
+	h.entries = append(h.entries, line)
+	if len(h.entries) > maxHistory {
+		h.entries = h.entries[1:]
+	}
+	if h.path == "" {
+		return
+	}
+	file, err := os.OpenFile(h.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	file.WriteString(line + "\n")
+}
+
+func (h *History) rewrite() {
+	os.WriteFile(h.path, []byte(strings.Join(h.entries, "\n")+"\n"), 0600)
+}
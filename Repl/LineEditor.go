@@ -0,0 +1,194 @@
+package Repl
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+)
+
+// lineEditor 终端中的行编辑, 支持光标移动和历史记录
+// 只在读取一行的过程中把终端切换到 raw 模式, 执行代码时终端保持原来的状态
+type lineEditor struct {
+	fd      int
+	in      *bufio.Reader
+	out     io.Writer
+	history *History
+}
+
+func newLineEditor(in *os.File, out io.Writer, history *History) *lineEditor {
+	return &lineEditor{fd: int(in.Fd()), in: bufio.NewReader(in), out: out, history: history}
+}
+
+// 控制字符
+const (
+	keyCtrlA     = 1
+	keyCtrlB     = 2
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyCtrlE     = 5
+	keyCtrlF     = 6
+	keyBackspace = 8
+	keyTab       = 9
+	keyLineFeed  = 10
+	keyCtrlK     = 11
+	keyEnter     = 13
+	keyCtrlN     = 14
+	keyCtrlP     = 16
+	keyCtrlU     = 21
+	keyEscape    = 27
+	keyDelete    = 127
+)
+
+func (e *lineEditor) ReadLine(prompt string) (string, error) {
+	restore, err := makeRaw(e.fd)
+	if err != nil {
+		// 无法切换到 raw 模式时退化为按行读取
+		return (&plainReader{in: e.in, out: e.out}).ReadLine(prompt)
+	}
+	defer restore()
+
+	line := make([]rune, 0)
+	pos := 0
+	// 浏览历史时的位置, 等于 len(entries) 表示正在编辑的新行
+	entries := e.history.Entries()
+	index := len(entries)
+	editing := line
+
+	refresh := func() {
+		fmt.Fprintf(e.out, "\r%s%s\x1b[K", prompt, string(line))
+		if back := len(line) - pos; back > 0 {
+			fmt.Fprintf(e.out, "\x1b[%dD", back)
+		}
+	}
+	recall := func(to int) {
+		if to < 0 || to > len(entries) {
+			return
+		}
+		if index == len(entries) {
+			editing = line
+		}
+		index = to
+		if index == len(entries) {
+			line = editing
+		} else {
+			line = []rune(entries[index])
+		}
+		pos = len(line)
+		refresh()
+	}
+
+	refresh()
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			return "", err
+		}
+		switch r {
+		case keyEnter, keyLineFeed:
+			fmt.Fprint(e.out, "\r\n")
+			return string(line), nil
+		case keyCtrlC:
+			fmt.Fprint(e.out, "^C\r\n")
+			return "", errInterrupt
+		case keyCtrlD:
+			if len(line) == 0 {
+				return "", io.EOF
+			}
+			if pos < len(line) {
+				line = append(line[:pos], line[pos+1:]...)
+			}
+		case keyBackspace, keyDelete:
+			if pos > 0 {
+				line = append(line[:pos-1], line[pos:]...)
+				pos--
+			}
+		case keyCtrlA:
+			pos = 0
+		case keyCtrlE:
+			pos = len(line)
+		case keyCtrlB:
+			if pos > 0 {
+				pos--
+			}
+		case keyCtrlF:
+			if pos < len(line) {
+				pos++
+			}
+		case keyCtrlK:
+			line = line[:pos]
+		case keyCtrlU:
+			line = append([]rune{}, line[pos:]...)
+			pos = 0
+		case keyCtrlP:
+			recall(index - 1)
+			continue
+		case keyCtrlN:
+			recall(index + 1)
+			continue
+		case keyTab:
+			line = append(line[:pos], append([]rune("  "), line[pos:]...)...)
+			pos += 2
+		case keyEscape:
+			switch e.escape() {
+			case 'A':
+				recall(index - 1)
+				continue
+			case 'B':
+				recall(index + 1)
+				continue
+			case 'C':
+				if pos < len(line) {
+					pos++
+				}
+			case 'D':
+				if pos > 0 {
+					pos--
+				}
+			case 'H':
+				pos = 0
+			case 'F':
+				pos = len(line)
+			case '~':
+				if pos < len(line) {
+					line = append(line[:pos], line[pos+1:]...)
+				}
+			}
+		default:
+			if r < ' ' {
+				continue
+			}
+			line = append(line[:pos], append([]rune{r}, line[pos:]...)...)
+			pos++
+		}
+		refresh()
+	}
+}
+
+// escape 读取 ESC 之后的序列, 返回 A B C D H F 表示方向键和 Home End, '~' 表示 Delete
+func (e *lineEditor) escape() byte {
+	prefix, err := e.in.ReadByte()
+	if err != nil || (prefix != '[' && prefix != 'O') {
+		return 0
+	}
+	code, err := e.in.ReadByte()
+	if err != nil {
+		return 0
+	}
+	if code < '0' || code > '9' {
+		return code
+	}
+	// ESC [ n ~ 形式的按键
+	if next, err := e.in.ReadByte(); err != nil || next != '~' {
+		return 0
+	}
+	switch code {
+	case '1', '7':
+		return 'H'
+	case '4', '8':
+		return 'F'
+	case '3':
+		return '~'
+	}
+	return 0
+}
@@ -0,0 +1,241 @@
+package Repl
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/trueabc/lox/Errors"
+	"github.com/trueabc/lox/Lox"
+	"github.com/trueabc/lox/Syntax"
+	"github.com/trueabc/lox/Token"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Repl 交互式的解释器
+// 括号没有闭合时继续读取下一行, 单独的表达式直接输出它的值, 以 : 开头的是 REPL 自己的命令
+type Repl struct {
+	// 创建新的虚拟机, :reset 时重新调用
+	newVM func() *Lox.VM
+	// 输出编译错误和运行时错误
+	report  func(err error)
+	history *History
+
+	vm *Lox.VM
+	// 创建虚拟机时已经存在的全局变量, :env 不显示它们
+	builtins map[string]bool
+	out      io.Writer
+}
+
+// 用户按下 Ctrl-C, 丢弃当前的输入
+var errInterrupt = errors.New("interrupt")
+
+// lineReader 读取一行输入, 不包含换行符, 输入结束时返回 io.EOF
+type lineReader interface {
+	ReadLine(prompt string) (string, error)
+}
+
+func New(newVM func() *Lox.VM, report func(err error), history *History) *Repl {
+	r := &Repl{newVM: newVM, report: report, history: history}
+	r.reset()
+	return r
+}
+
+// Run 读取 in 直到输入结束, in 是终端时支持行编辑和历史记录
+func (r *Repl) Run(in *os.File, out io.Writer) error {
+	r.out = out
+	var reader lineReader = &plainReader{in: bufio.NewReader(in), out: out}
+	if isTerminal(int(in.Fd())) {
+		reader = newLineEditor(in, out, r.history)
+	}
+
+	buffer := ""
+	for {
+		prompt := "> "
+		if buffer != "" {
+			prompt = "... "
+		}
+		line, err := reader.ReadLine(prompt)
+		if err == errInterrupt {
+			buffer = ""
+			continue
+		}
+		if err == io.EOF {
+			fmt.Fprintln(out)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		r.history.Add(line)
+
+		if buffer == "" && strings.HasPrefix(strings.TrimSpace(line), ":") {
+			if quit := r.command(strings.TrimSpace(line)); quit {
+				return nil
+			}
+			continue
+		}
+		buffer += line + "\n"
+		if !balanced(buffer) {
+			continue
+		}
+		source := buffer
+		buffer = ""
+		if strings.TrimSpace(source) != "" {
+			r.eval(source)
+		}
+	}
+}
+
+func (r *Repl) reset() {
+	r.vm = r.newVM()
+	r.builtins = make(map[string]bool)
+	for name := range r.vm.Globals() {
+		r.builtins[name] = true
+	}
+}
+
+func (r *Repl) eval(source string) {
+	value, isExpr, err := r.vm.Eval(source)
+	if err != nil {
+		r.report(err)
+		return
+	}
+	// 和大多数 REPL 一样, nil 不回显, 例如没有返回值的函数调用
+	if isExpr && value != nil {
+		fmt.Fprintln(r.out, Syntax.Stringify(value))
+	}
+}
+
+const help = `:env          list the global variables defined in this session
+:reset        discard all definitions and start over
+:load <file>  run a file in this session
+:ast <expr>   print the syntax tree of an expression
+:help         show this message
+:quit         leave the REPL`
+
+// command 执行 REPL 命令, 返回 true 表示退出
+func (r *Repl) command(line string) bool {
+	name, arg := line, ""
+	if index := strings.IndexAny(line, " \t"); index >= 0 {
+		name, arg = line[:index], strings.TrimSpace(line[index+1:])
+	}
+	switch name {
+	case ":env":
+		r.env()
+	case ":reset":
+		r.reset()
+	case ":load":
+		if arg == "" {
+			fmt.Fprintln(r.out, "Usage: :load <file>")
+			break
+		}
+		path, err := filepath.Abs(arg)
+		if err == nil {
+			err = r.vm.RunFile(path)
+		}
+		if err != nil {
+			r.report(err)
+		}
+	case ":ast":
+		r.ast(arg)
+	case ":help":
+		fmt.Fprintln(r.out, help)
+	case ":quit", ":exit":
+		return true
+	default:
+		fmt.Fprintf(r.out, "Unknown command '%s'. Type :help for a list of commands.\n", name)
+	}
+	return false
+}
+
+// env 按名字排序输出本次会话定义的全局变量
+func (r *Repl) env() {
+	globals := r.vm.Globals()
+	names := make([]string, 0, len(globals))
+	for name := range globals {
+		if !r.builtins[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(r.out, "%s = %s\n", name, Syntax.Stringify(globals[name]))
+	}
+}
+
+func (r *Repl) ast(source string) {
+	reporter := Errors.NewReporter("", source)
+	tokens := Token.NewScanner(source, reporter).ScanTokens()
+	expr := Syntax.NewParser(tokens, reporter).ParseExpression()
+	if reporter.HadError() {
+		r.report(reporter.Diagnostics)
+		return
+	}
+	fmt.Fprintln(r.out, Syntax.NewAstPrinter().Print(expr))
+}
+
+// balanced 括号是否都已经闭合, 字符串和注释中的括号不计算
+// 字符串中 \ 之后的字符被转义, ${ 开始插值, 和 Token.Scanner 一样记录插值的嵌套
+// 多余的右括号也当作输入结束, 交给解析器报告错误
+func balanced(source string) bool {
+	depth := 0
+	inString := false
+	// 每一层没有结束的插值中, 还没有匹配的 { 的个数
+	interpolations := make([]int, 0)
+	for i := 0; i < len(source); i++ {
+		c := source[i]
+		switch {
+		case inString:
+			switch {
+			case c == '\\':
+				i++
+			case c == '"':
+				inString = false
+			case c == '$' && i+1 < len(source) && source[i+1] == '{':
+				i++
+				inString = false
+				interpolations = append(interpolations, 0)
+			}
+		case c == '"':
+			inString = true
+		case c == '/' && i+1 < len(source) && source[i+1] == '/':
+			for i < len(source) && source[i] != '\n' {
+				i++
+			}
+		case c == '}' && len(interpolations) != 0 && interpolations[len(interpolations)-1] == 0:
+			// 和 ${ 匹配的 } 之后继续是字符串
+			interpolations = interpolations[:len(interpolations)-1]
+			inString = true
+		case c == '(' || c == '{' || c == '[':
+			if c == '{' && len(interpolations) != 0 {
+				interpolations[len(interpolations)-1]++
+			}
+			depth++
+		case c == ')' || c == '}' || c == ']':
+			if c == '}' && len(interpolations) != 0 {
+				interpolations[len(interpolations)-1]--
+			}
+			depth--
+		}
+	}
+	return !inString && len(interpolations) == 0 && depth <= 0
+}
+
+// plainReader 输入不是终端时按行读取, 例如通过管道输入
+type plainReader struct {
+	in  *bufio.Reader
+	out io.Writer
+}
+
+func (p *plainReader) ReadLine(prompt string) (string, error) {
+	fmt.Fprint(p.out, prompt)
+	line, err := p.in.ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil
+	}
+	return strings.TrimRight(line, "\r\n"), err
+}
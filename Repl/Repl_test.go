@@ -0,0 +1,98 @@
+package Repl
+
+import (
+	"github.com/trueabc/lox/Lox"
+	"github.com/trueabc/lox/Syntax"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var backends = map[string]func(stdout, stderr io.Writer) *Lox.VM{
+	"interpreter": Lox.NewVM,
+	"bytecode":    Lox.NewBytecodeVM,
+}
+
+// runRepl 把 input 作为标准输入运行 REPL, 返回输出和报告的错误
+func runRepl(t *testing.T, newVM func(stdout, stderr io.Writer) *Lox.VM, input string) (string, []error) {
+	path := filepath.Join(t.TempDir(), "input")
+	if err := os.WriteFile(path, []byte(input), 0666); err != nil {
+		t.Fatal(err)
+	}
+	in, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+
+	var out strings.Builder
+	errs := make([]error, 0)
+	repl := New(func() *Lox.VM { return newVM(&out, io.Discard) },
+		func(err error) { errs = append(errs, err) }, LoadHistory(""))
+	if err := repl.Run(in, &out); err != nil {
+		t.Fatal(err)
+	}
+	return out.String(), errs
+}
+
+// 之前的输入中定义的函数出错时, 源码片段来自定义函数的输入
+func TestErrorInFunctionFromEarlierInput(t *testing.T) {
+	input := "fun f() {\n  return 1 + nil;\n}\nvar x = 1;\nf();\n"
+	for name, newVM := range backends {
+		_, errs := runRepl(t, newVM, input)
+		if len(errs) != 1 {
+			t.Fatalf("%s: expected one error, got %v", name, errs)
+		}
+		runtimeErr, ok := errs[0].(*Syntax.RuntimeError)
+		if !ok || runtimeErr.Diagnostic == nil {
+			t.Fatalf("%s: expected a runtime error with a location, got %v", name, errs[0])
+		}
+		if d := runtimeErr.Diagnostic; d.Line != 2 || d.SourceLine != "  return 1 + nil;" {
+			t.Errorf("%s: error located at line %d %q", name, d.Line, d.SourceLine)
+		}
+	}
+}
+
+func TestBalanced(t *testing.T) {
+	tests := []struct {
+		source   string
+		balanced bool
+	}{
+		{`print "a\"b";`, true},
+		{`print "a\\";`, true},
+		{`print "a\";`, false},
+		{`print "${1 + 2}";`, true},
+		{`print "${ {"k": 1}["k"] }";`, true},
+		{`print "${"a ${1}"}";`, true},
+		{`print "a ${f(`, false},
+		{`print "${1`, false},
+		{`print "\${";`, true},
+		{`print "}";`, true},
+		{"fun f() {\n  print \"{\";", false},
+		{"fun f() {\n  print \"{\";\n}", true},
+		{"print 1; // {", true},
+		{"}", true},
+	}
+	for _, test := range tests {
+		if got := balanced(test.source); got != test.balanced {
+			t.Errorf("balanced(%q) = %v, want %v", test.source, got, test.balanced)
+		}
+	}
+}
+
+// 转义的引号和插值不影响之后的输入
+func TestEscapesAndInterpolation(t *testing.T) {
+	input := "print \"a\\\"b\";\nprint \"${\"x${1}\"}\";\nprint \"\\${\";\nprint 2;\n"
+	for name, newVM := range backends {
+		out, errs := runRepl(t, newVM, input)
+		if len(errs) != 0 {
+			t.Fatalf("%s: unexpected errors %v", name, errs)
+		}
+		want := "> a\"b\n> x1\n> ${\n> 2\n> \n"
+		if out != want {
+			t.Errorf("%s: got %q, want %q", name, out, want)
+		}
+	}
+}
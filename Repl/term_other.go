@@ -0,0 +1,14 @@
+//go:build !linux
+
+package Repl
+
+import "errors"
+
+// 其他平台不支持行编辑, 按行读取输入
+func isTerminal(fd int) bool {
+	return false
+}
+
+func makeRaw(fd int) (func(), error) {
+	return nil, errors.New("raw mode is not supported on this platform")
+}
@@ -0,0 +1,67 @@
+package Syntax
+
+import "math"
+
+// 两个后端共用的取模和位运算, 以及它们的错误信息
+const (
+	errDivisionByZero  = "Division by zero."
+	errIntegerOperand  = "Operand must be an integer."
+	errIntegerOperands = "Operands must be integers."
+	errNegativeShift   = "Shift count must be non-negative."
+)
+
+// toInteger 位运算的操作数必须是 int64 范围内的整数
+func toInteger(value float64) (int64, bool) {
+	if value != math.Trunc(value) || value < math.MinInt64 || value >= math.MaxInt64 {
+		return 0, false
+	}
+	return int64(value), true
+}
+
+// bitwise 计算 & | ^ << >>, 出错时返回错误信息
+// 右移是算术右移, 保留符号
+func bitwise(op OpCode, left, right float64) (float64, string) {
+	a, ok1 := toInteger(left)
+	b, ok2 := toInteger(right)
+	if !ok1 || !ok2 {
+		return 0, errIntegerOperands
+	}
+	switch op {
+	case OP_BIT_AND:
+		return float64(a & b), ""
+	case OP_BIT_OR:
+		return float64(a | b), ""
+	case OP_BIT_XOR:
+		return float64(a ^ b), ""
+	case OP_SHIFT_LEFT, OP_SHIFT_RIGHT:
+		if b < 0 {
+			return 0, errNegativeShift
+		}
+		if op == OP_SHIFT_LEFT {
+			return float64(a << uint64(b)), ""
+		}
+		return float64(a >> uint64(b)), ""
+	}
+	return 0, "Unknown operator."
+}
+
+// arithmetic 计算 / ~/ % **, 除以 0 和对 0 取模是错误, 不会得到 Inf 或者 NaN
+// ~/ 是向下取整的除法, -7 ~/ 2 为 -4
+func arithmetic(op OpCode, a, b float64) (float64, string) {
+	switch op {
+	case OP_DIVIDE, OP_FLOOR_DIVIDE, OP_MODULO:
+		if b == 0 {
+			return 0, errDivisionByZero
+		}
+		switch op {
+		case OP_DIVIDE:
+			return a / b, ""
+		case OP_FLOOR_DIVIDE:
+			return math.Floor(a / b), ""
+		}
+		return math.Mod(a, b), ""
+	case OP_POWER:
+		return math.Pow(a, b), ""
+	}
+	return bitwise(op, a, b)
+}
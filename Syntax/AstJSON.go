@@ -0,0 +1,672 @@
+package Syntax
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/trueabc/lox/Token"
+)
+
+// AstVersion JSON 格式的版本, 格式不兼容的修改需要增加版本号
+const AstVersion = 1
+
+// 语法树 JSON 格式:
+//
+//	{"version": 1, "statements": [节点...]}
+//
+// 每个节点是一个对象, kind 为节点类型 (Binary, Print 等, 不带 Expr/Stmt 后缀),
+// 其余的键与 generateAST 中的字段同名, 子节点为对象或数组, 缺省的子节点为 null.
+// Literal 的 value 为 JSON 的数字, 字符串, 布尔值或 null.
+// token 为 {"type", "lexeme", "line", "column", "offset"}, type 与 TokenType.String 一致,
+// 位置不能是负数, 字符串和数字 token 额外带有 literal.
+// Expression 语句和 Print 语句的字段是 expression, 对象的键按字母排序输出.
+
+type astDocument struct {
+	Version    int           `json:"version"`
+	Statements []interface{} `json:"statements"`
+}
+
+type astToken struct {
+	Type    string      `json:"type"`
+	Lexeme  string      `json:"lexeme"`
+	Literal interface{} `json:"literal,omitempty"`
+	Line    int         `json:"line"`
+	Column  int         `json:"column"`
+	Offset  int         `json:"offset"`
+}
+
+// MarshalAST 把解析器的输出序列化为 JSON
+func MarshalAST(stmts []Stmt) ([]byte, error) {
+	encoder := &astEncoder{}
+	document := astDocument{Version: AstVersion, Statements: encoder.stmts(stmts)}
+	return json.MarshalIndent(document, "", "  ")
+}
+
+// UnmarshalAST 从 JSON 重建语法树, 得到的语法树需要重新经过 Resolver 的检查
+func UnmarshalAST(data []byte) (stmts []Stmt, err error) {
+	var document struct {
+		Version    int               `json:"version"`
+		Statements []json.RawMessage `json:"statements"`
+	}
+	if err := json.Unmarshal(data, &document); err != nil {
+		return nil, err
+	}
+	if document.Version != AstVersion {
+		return nil, fmt.Errorf("unsupported AST version %d, expect %d", document.Version, AstVersion)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			decodeErr, ok := r.(astDecodeError)
+			if !ok {
+				panic(r)
+			}
+			stmts, err = nil, decodeErr
+		}
+	}()
+	stmts = make([]Stmt, 0, len(document.Statements))
+	for _, item := range document.Statements {
+		if isNull(item) {
+			decodeFail("statements can't contain null")
+		}
+		stmts = append(stmts, decodeStmt(item))
+	}
+	return stmts, nil
+}
+
+// astEncoder 把节点转换为 map, 由 encoding/json 输出
+type astEncoder struct {
+}
+
+type astNodeJSON map[string]interface{}
+
+func (e *astEncoder) expr(expr Expr) interface{} {
+	if expr == nil {
+		return nil
+	}
+	return expr.Accept(e)
+}
+
+func (e *astEncoder) exprs(exprs []Expr) []interface{} {
+	items := make([]interface{}, 0, len(exprs))
+	for _, item := range exprs {
+		items = append(items, e.expr(item))
+	}
+	return items
+}
+
+func (e *astEncoder) stmt(stmt Stmt) interface{} {
+	if stmt == nil {
+		return nil
+	}
+	return stmt.Accept(e)
+}
+
+// block 可以缺省的块, nil 的 *BlockStmt 不能直接作为 Stmt 传给 stmt
+func (e *astEncoder) block(block *BlockStmt) interface{} {
+	if block == nil {
+		return nil
+	}
+	return block.Accept(e)
+}
+
+func (e *astEncoder) stmts(stmts []Stmt) []interface{} {
+	items := make([]interface{}, 0, len(stmts))
+	for _, item := range stmts {
+		items = append(items, e.stmt(item))
+	}
+	return items
+}
+
+func (e *astEncoder) token(token *Token.Token) interface{} {
+	if token == nil {
+		return nil
+	}
+	return &astToken{Type: token.TType.String(), Lexeme: token.Lexeme, Literal: token.Literal,
+		Line: token.Line, Column: token.Column, Offset: token.Offset}
+}
+
+func (e *astEncoder) tokens(tokens []*Token.Token) []interface{} {
+	items := make([]interface{}, 0, len(tokens))
+	for _, item := range tokens {
+		items = append(items, e.token(item))
+	}
+	return items
+}
+
+func (e *astEncoder) VisitBinaryExpr(expr Expr) interface{} {
+	class := expr.(*BinaryExpr)
+	return astNodeJSON{"kind": "Binary", "left": e.expr(class.left),
+		"operator": e.token(class.operator), "right": e.expr(class.right)}
+}
+
+func (e *astEncoder) VisitGroupingExpr(expr Expr) interface{} {
+	class := expr.(*GroupingExpr)
+	return astNodeJSON{"kind": "Grouping", "expression": e.expr(class.expression)}
+}
+
+func (e *astEncoder) VisitLiteralExpr(expr Expr) interface{} {
+	class := expr.(*LiteralExpr)
+	return astNodeJSON{"kind": "Literal", "value": class.value, "token": e.token(class.token)}
+}
+
+func (e *astEncoder) VisitUnaryExpr(expr Expr) interface{} {
+	class := expr.(*UnaryExpr)
+	return astNodeJSON{"kind": "Unary", "operator": e.token(class.operator), "right": e.expr(class.right)}
+}
+
+func (e *astEncoder) VisitVariableExpr(expr Expr) interface{} {
+	class := expr.(*VariableExpr)
+	return astNodeJSON{"kind": "Variable", "name": e.token(class.name)}
+}
+
+func (e *astEncoder) VisitThisExpr(expr Expr) interface{} {
+	class := expr.(*ThisExpr)
+	return astNodeJSON{"kind": "This", "keyword": e.token(class.keyword)}
+}
+
+func (e *astEncoder) VisitSuperExpr(expr Expr) interface{} {
+	class := expr.(*SuperExpr)
+	return astNodeJSON{"kind": "Super", "keyword": e.token(class.keyword), "method": e.token(class.method)}
+}
+
+func (e *astEncoder) VisitGetExpr(expr Expr) interface{} {
+	class := expr.(*GetExpr)
+	return astNodeJSON{"kind": "Get", "object": e.expr(class.object), "name": e.token(class.name)}
+}
+
+func (e *astEncoder) VisitSetExpr(expr Expr) interface{} {
+	class := expr.(*SetExpr)
+	return astNodeJSON{"kind": "Set", "object": e.expr(class.object), "name": e.token(class.name),
+		"value": e.expr(class.value), "operator": e.token(class.operator), "postfix": class.postfix}
+}
+
+func (e *astEncoder) VisitLogicExpr(expr Expr) interface{} {
+	class := expr.(*LogicExpr)
+	return astNodeJSON{"kind": "Logic", "left": e.expr(class.left),
+		"operator": e.token(class.operator), "right": e.expr(class.right)}
+}
+
+func (e *astEncoder) VisitAssignmentExpr(expr Expr) interface{} {
+	class := expr.(*AssignmentExpr)
+	return astNodeJSON{"kind": "Assignment", "name": e.token(class.name), "value": e.expr(class.value),
+		"operator": e.token(class.operator), "postfix": class.postfix}
+}
+
+func (e *astEncoder) VisitCallExpr(expr Expr) interface{} {
+	class := expr.(*CallExpr)
+	return astNodeJSON{"kind": "Call", "callee": e.expr(class.callee), "paren": e.token(class.paren),
+		"arguments": e.exprs(class.arguments)}
+}
+
+func (e *astEncoder) VisitListExpr(expr Expr) interface{} {
+	class := expr.(*ListExpr)
+	return astNodeJSON{"kind": "List", "bracket": e.token(class.bracket), "elements": e.exprs(class.elements)}
+}
+
+func (e *astEncoder) VisitMapExpr(expr Expr) interface{} {
+	class := expr.(*MapExpr)
+	return astNodeJSON{"kind": "Map", "brace": e.token(class.brace), "keys": e.exprs(class.keys),
+		"values": e.exprs(class.values)}
+}
+
+func (e *astEncoder) VisitIndexExpr(expr Expr) interface{} {
+	class := expr.(*IndexExpr)
+	return astNodeJSON{"kind": "Index", "object": e.expr(class.object), "bracket": e.token(class.bracket),
+		"index": e.expr(class.index)}
+}
+
+func (e *astEncoder) VisitSetIndexExpr(expr Expr) interface{} {
+	class := expr.(*SetIndexExpr)
+	return astNodeJSON{"kind": "SetIndex", "object": e.expr(class.object), "bracket": e.token(class.bracket),
+		"index": e.expr(class.index), "value": e.expr(class.value), "operator": e.token(class.operator),
+		"postfix": class.postfix}
+}
+
+func (e *astEncoder) VisitExpressionStmt(stmt Stmt) interface{} {
+	class := stmt.(*ExpressionStmt)
+	return astNodeJSON{"kind": "Expression", "expression": e.expr(class.Expression)}
+}
+
+func (e *astEncoder) VisitPrintStmt(stmt Stmt) interface{} {
+	class := stmt.(*PrintStmt)
+	return astNodeJSON{"kind": "Print", "expression": e.expr(class.Expression)}
+}
+
+func (e *astEncoder) VisitVariableStmt(stmt Stmt) interface{} {
+	class := stmt.(*VariableStmt)
+	return astNodeJSON{"kind": "Variable", "name": e.token(class.name), "initializer": e.expr(class.initializer)}
+}
+
+func (e *astEncoder) VisitBlockStmt(stmt Stmt) interface{} {
+	class := stmt.(*BlockStmt)
+	return astNodeJSON{"kind": "Block", "statements": e.stmts(class.statements),
+		"rightBrace": e.token(class.rightBrace)}
+}
+
+func (e *astEncoder) VisitClassStmt(stmt Stmt) interface{} {
+	class := stmt.(*ClassStmt)
+	var superClass interface{}
+	if class.superClass != nil {
+		superClass = e.expr(class.superClass)
+	}
+	return astNodeJSON{"kind": "Class", "name": e.token(class.name), "superClass": superClass,
+		"methods": e.stmts(class.methods)}
+}
+
+func (e *astEncoder) VisitWhileStmt(stmt Stmt) interface{} {
+	class := stmt.(*WhileStmt)
+	return astNodeJSON{"kind": "While", "condition": e.expr(class.condition), "body": e.stmt(class.body)}
+}
+
+func (e *astEncoder) VisitForStmt(stmt Stmt) interface{} {
+	class := stmt.(*ForStmt)
+	return astNodeJSON{"kind": "For", "keyword": e.token(class.keyword), "initializer": e.stmt(class.initializer),
+		"condition": e.expr(class.condition), "increment": e.expr(class.increment), "body": e.stmt(class.body)}
+}
+
+func (e *astEncoder) VisitIfStmt(stmt Stmt) interface{} {
+	class := stmt.(*IfStmt)
+	return astNodeJSON{"kind": "If", "condition": e.expr(class.condition),
+		"thenBranch": e.stmt(class.thenBranch), "elseBranch": e.stmt(class.elseBranch)}
+}
+
+func (e *astEncoder) VisitReturnStmt(stmt Stmt) interface{} {
+	class := stmt.(*ReturnStmt)
+	return astNodeJSON{"kind": "Return", "keyword": e.token(class.keyword), "value": e.expr(class.value)}
+}
+
+func (e *astEncoder) VisitThrowStmt(stmt Stmt) interface{} {
+	class := stmt.(*ThrowStmt)
+	return astNodeJSON{"kind": "Throw", "keyword": e.token(class.keyword), "value": e.expr(class.value)}
+}
+
+func (e *astEncoder) VisitTryStmt(stmt Stmt) interface{} {
+	class := stmt.(*TryStmt)
+	var catchName interface{}
+	if class.catchName != nil {
+		catchName = e.token(class.catchName)
+	}
+	return astNodeJSON{"kind": "Try", "keyword": e.token(class.keyword), "body": e.block(class.body),
+		"catchName": catchName, "catchBody": e.block(class.catchBody), "finallyBody": e.block(class.finallyBody)}
+}
+
+func (e *astEncoder) VisitBreakStmt(stmt Stmt) interface{} {
+	class := stmt.(*BreakStmt)
+	return astNodeJSON{"kind": "Break", "keyword": e.token(class.keyword)}
+}
+
+func (e *astEncoder) VisitContinueStmt(stmt Stmt) interface{} {
+	class := stmt.(*ContinueStmt)
+	return astNodeJSON{"kind": "Continue", "keyword": e.token(class.keyword)}
+}
+
+func (e *astEncoder) VisitFunctionStmt(stmt Stmt) interface{} {
+	class := stmt.(*FunctionStmt)
+	return astNodeJSON{"kind": "Function", "name": e.token(class.name), "params": e.tokens(class.params),
+		"body": e.stmts(class.body)}
+}
+
+func (e *astEncoder) VisitImportStmt(stmt Stmt) interface{} {
+	class := stmt.(*ImportStmt)
+	return astNodeJSON{"kind": "Import", "keyword": e.token(class.keyword), "path": e.token(class.path),
+		"name": e.token(class.name)}
+}
+
+// astDecodeError JSON 结构不符合格式, 在 UnmarshalAST 中 recover
+type astDecodeError struct {
+	message string
+}
+
+func (e astDecodeError) Error() string {
+	return "invalid AST: " + e.message
+}
+
+func decodeFail(format string, args ...interface{}) {
+	panic(astDecodeError{fmt.Sprintf(format, args...)})
+}
+
+// astFields 一个节点的字段, 子节点延迟解析
+type astFields map[string]json.RawMessage
+
+func decodeFields(data json.RawMessage) astFields {
+	if isNull(data) {
+		return nil
+	}
+	var fields astFields
+	if err := json.Unmarshal(data, &fields); err != nil {
+		decodeFail("%v", err)
+	}
+	return fields
+}
+
+func isNull(data json.RawMessage) bool {
+	return len(data) == 0 || string(data) == "null"
+}
+
+func (f astFields) kind() string {
+	var kind string
+	if err := json.Unmarshal(f["kind"], &kind); err != nil {
+		decodeFail("node without kind")
+	}
+	return kind
+}
+
+func (f astFields) expr(name string) Expr {
+	return decodeExpr(f[name])
+}
+
+// required 必须存在的子表达式
+func (f astFields) required(name string) Expr {
+	expr := decodeExpr(f[name])
+	if expr == nil {
+		decodeFail("%s node requires '%s'", f.kind(), name)
+	}
+	return expr
+}
+
+func (f astFields) exprs(name string) []Expr {
+	var items []json.RawMessage
+	if err := json.Unmarshal(f[name], &items); err != nil {
+		decodeFail("'%s' of %s node must be an array", name, f.kind())
+	}
+	exprs := make([]Expr, 0, len(items))
+	for _, item := range items {
+		if isNull(item) {
+			decodeFail("'%s' of %s node can't contain null", name, f.kind())
+		}
+		exprs = append(exprs, decodeExpr(item))
+	}
+	return exprs
+}
+
+func (f astFields) stmt(name string) Stmt {
+	return decodeStmt(f[name])
+}
+
+func (f astFields) stmts(name string) []Stmt {
+	var items []json.RawMessage
+	if err := json.Unmarshal(f[name], &items); err != nil {
+		decodeFail("'%s' of %s node must be an array", name, f.kind())
+	}
+	stmts := make([]Stmt, 0, len(items))
+	for _, item := range items {
+		if isNull(item) {
+			decodeFail("'%s' of %s node can't contain null", name, f.kind())
+		}
+		stmts = append(stmts, decodeStmt(item))
+	}
+	return stmts
+}
+
+// token 必须存在的 token, 可以缺省的 token 使用 optionalToken
+func (f astFields) token(name string) *Token.Token {
+	token := decodeToken(f[name])
+	if token == nil {
+		decodeFail("%s node requires token '%s'", f.kind(), name)
+	}
+	return token
+}
+
+func (f astFields) optionalToken(name string) *Token.Token {
+	return decodeToken(f[name])
+}
+
+// flag 可以缺省的布尔值, 缺省为 false
+func (f astFields) flag(name string) bool {
+	if isNull(f[name]) {
+		return false
+	}
+	var value bool
+	if err := json.Unmarshal(f[name], &value); err != nil {
+		decodeFail("'%s' of %s node must be a boolean", name, f.kind())
+	}
+	return value
+}
+
+// assignOperator 复合赋值的运算符, 普通赋值没有 operator, postfix 只能和 ++ 或者 -- 一起使用
+func (f astFields) assignOperator() (*Token.Token, bool) {
+	operator, postfix := f.optionalToken("operator"), f.flag("postfix")
+	if operator == nil {
+		if postfix {
+			decodeFail("postfix %s node requires 'operator'", f.kind())
+		}
+		return nil, false
+	}
+	if _, ok := compoundOps[operator.TType]; !ok {
+		decodeFail("'%s' is not an assignment operator", operator.Lexeme)
+	}
+	if postfix && operator.TType != Token.PLUS_PLUS && operator.TType != Token.MINUS_MINUS {
+		decodeFail("postfix %s node requires '++' or '--'", f.kind())
+	}
+	return operator, postfix
+}
+
+// 二元, 一元和逻辑运算的运算符, 其他运算符两个后端都无法执行
+var (
+	binaryOperators = map[Token.TokenType]bool{
+		Token.BANG_EQUAL: true, Token.EQUAL_EQUAL: true, Token.GREATER: true, Token.GREATER_EQUAL: true,
+		Token.LESS: true, Token.LESS_EQUAL: true, Token.PLUS: true, Token.MINUS: true, Token.STAR: true,
+		Token.SLASH: true, Token.TILDE_SLASH: true, Token.PERCENT: true, Token.STAR_STAR: true,
+		Token.AMPERSAND: true, Token.PIPE: true, Token.CARET: true, Token.LESS_LESS: true,
+		Token.GREATER_GREATER: true, Token.INTERPOLATION: true,
+	}
+	unaryOperators = map[Token.TokenType]bool{Token.MINUS: true, Token.BANG: true, Token.TILDE: true}
+	logicOperators = map[Token.TokenType]bool{Token.AND: true, Token.OR: true}
+)
+
+// operator 必须是 operators 中的运算符, description 用于错误信息
+func (f astFields) operator(operators map[Token.TokenType]bool, description string) *Token.Token {
+	operator := f.token("operator")
+	if !operators[operator.TType] {
+		decodeFail("'%s' is not %s operator", operator.Lexeme, description)
+	}
+	return operator
+}
+
+func (f astFields) requiredStmt(name string) Stmt {
+	stmt := decodeStmt(f[name])
+	if stmt == nil {
+		decodeFail("%s node requires '%s'", f.kind(), name)
+	}
+	return stmt
+}
+
+// block 必须存在的块
+func (f astFields) block(name string) *BlockStmt {
+	block := f.optionalBlock(name)
+	if block == nil {
+		decodeFail("%s node requires '%s'", f.kind(), name)
+	}
+	return block
+}
+
+func (f astFields) optionalBlock(name string) *BlockStmt {
+	stmt := decodeStmt(f[name])
+	if stmt == nil {
+		return nil
+	}
+	block, ok := stmt.(*BlockStmt)
+	if !ok {
+		decodeFail("'%s' of %s node must be a Block node", name, f.kind())
+	}
+	return block
+}
+
+func (f astFields) tokens(name string) []*Token.Token {
+	var items []json.RawMessage
+	if err := json.Unmarshal(f[name], &items); err != nil {
+		decodeFail("'%s' of %s node must be an array", name, f.kind())
+	}
+	tokens := make([]*Token.Token, 0, len(items))
+	for _, item := range items {
+		if isNull(item) {
+			decodeFail("'%s' of %s node can't contain null", name, f.kind())
+		}
+		tokens = append(tokens, decodeToken(item))
+	}
+	return tokens
+}
+
+func decodeToken(data json.RawMessage) *Token.Token {
+	if isNull(data) {
+		return nil
+	}
+	var token astToken
+	if err := json.Unmarshal(data, &token); err != nil {
+		decodeFail("%v", err)
+	}
+	tokenType, ok := Token.TokenTypeOf(token.Type)
+	if !ok {
+		decodeFail("unknown token type '%s'", token.Type)
+	}
+	if token.Line < 0 || token.Column < 0 || token.Offset < 0 {
+		decodeFail("position of token '%s' can't be negative", token.Lexeme)
+	}
+	// 和 Scanner 一致: 字符串 token 的 literal 是字符串, 数字 token 的是数字, 其他 token 没有 literal
+	switch token.Literal.(type) {
+	case nil:
+	case string:
+		if tokenType != Token.STRING && tokenType != Token.INTERPOLATION {
+			decodeFail("%s token '%s' can't have a string literal", token.Type, token.Lexeme)
+		}
+	case float64:
+		if tokenType != Token.NUMBER {
+			decodeFail("%s token '%s' can't have a number literal", token.Type, token.Lexeme)
+		}
+	default:
+		decodeFail("literal of token '%s' must be a number or string", token.Lexeme)
+	}
+	return Token.NewToken(tokenType, token.Lexeme, token.Literal, token.Line, token.Column, token.Offset)
+}
+
+func decodeExpr(data json.RawMessage) Expr {
+	f := decodeFields(data)
+	if f == nil {
+		return nil
+	}
+	switch f.kind() {
+	case "Binary":
+		return &BinaryExpr{left: f.required("left"), operator: f.operator(binaryOperators, "a binary"),
+			right: f.required("right")}
+	case "Grouping":
+		return &GroupingExpr{expression: f.required("expression")}
+	case "Literal":
+		var value interface{}
+		if err := json.Unmarshal(f["value"], &value); err != nil {
+			decodeFail("%v", err)
+		}
+		// 数组和对象不是 lox 的值, 两个后端都无法比较它们
+		switch value.(type) {
+		case nil, bool, float64, string:
+		default:
+			decodeFail("value of Literal node must be a number, string, boolean or null")
+		}
+		return &LiteralExpr{value: value, token: f.optionalToken("token")}
+	case "Unary":
+		return &UnaryExpr{operator: f.operator(unaryOperators, "a unary"), right: f.required("right")}
+	case "Variable":
+		return &VariableExpr{name: f.token("name")}
+	case "This":
+		return &ThisExpr{keyword: f.token("keyword")}
+	case "Super":
+		return &SuperExpr{keyword: f.token("keyword"), method: f.token("method")}
+	case "Get":
+		return &GetExpr{object: f.required("object"), name: f.token("name")}
+	case "Set":
+		operator, postfix := f.assignOperator()
+		return &SetExpr{object: f.required("object"), name: f.token("name"), value: f.required("value"),
+			operator: operator, postfix: postfix}
+	case "Logic":
+		return &LogicExpr{left: f.required("left"), operator: f.operator(logicOperators, "a logical"),
+			right: f.required("right")}
+	case "Assignment":
+		operator, postfix := f.assignOperator()
+		return &AssignmentExpr{name: f.token("name"), value: f.required("value"), operator: operator, postfix: postfix}
+	case "Call":
+		return &CallExpr{callee: f.required("callee"), paren: f.token("paren"), arguments: f.exprs("arguments")}
+	case "List":
+		return &ListExpr{bracket: f.token("bracket"), elements: f.exprs("elements")}
+	case "Map":
+		keys, values := f.exprs("keys"), f.exprs("values")
+		if len(keys) != len(values) {
+			decodeFail("Map node has %d keys and %d values", len(keys), len(values))
+		}
+		return &MapExpr{brace: f.token("brace"), keys: keys, values: values}
+	case "Index":
+		return &IndexExpr{object: f.required("object"), bracket: f.token("bracket"), index: f.required("index")}
+	case "SetIndex":
+		operator, postfix := f.assignOperator()
+		return &SetIndexExpr{object: f.required("object"), bracket: f.token("bracket"),
+			index: f.required("index"), value: f.required("value"), operator: operator, postfix: postfix}
+	}
+	decodeFail("unknown expression kind '%s'", f.kind())
+	return nil
+}
+
+func decodeStmt(data json.RawMessage) Stmt {
+	f := decodeFields(data)
+	if f == nil {
+		return nil
+	}
+	switch f.kind() {
+	case "Expression":
+		return &ExpressionStmt{Expression: f.required("expression")}
+	case "Print":
+		return &PrintStmt{Expression: f.required("expression")}
+	case "Variable":
+		return &VariableStmt{name: f.token("name"), initializer: f.expr("initializer")}
+	case "Block":
+		return &BlockStmt{statements: f.stmts("statements"), rightBrace: f.optionalToken("rightBrace")}
+	case "Class":
+		var superClass *VariableExpr
+		if expr := f.expr("superClass"); expr != nil {
+			variable, ok := expr.(*VariableExpr)
+			if !ok {
+				decodeFail("superClass of Class node must be a Variable")
+			}
+			superClass = variable
+		}
+		methods := f.stmts("methods")
+		for _, method := range methods {
+			if _, ok := method.(*FunctionStmt); !ok {
+				decodeFail("methods of Class node must be Function nodes")
+			}
+		}
+		return &ClassStmt{name: f.token("name"), superClass: superClass, methods: methods}
+	case "While":
+		return &WhileStmt{condition: f.required("condition"), body: f.requiredStmt("body")}
+	case "For":
+		return &ForStmt{keyword: f.token("keyword"), initializer: f.stmt("initializer"), condition: f.expr("condition"),
+			increment: f.expr("increment"), body: f.requiredStmt("body")}
+	case "If":
+		return &IfStmt{condition: f.required("condition"), thenBranch: f.requiredStmt("thenBranch"),
+			elseBranch: f.stmt("elseBranch")}
+	case "Return":
+		return &ReturnStmt{keyword: f.token("keyword"), value: f.expr("value")}
+	case "Throw":
+		return &ThrowStmt{keyword: f.token("keyword"), value: f.required("value")}
+	case "Try":
+		stmt := &TryStmt{keyword: f.token("keyword"), body: f.block("body"), catchName: f.optionalToken("catchName"),
+			catchBody: f.optionalBlock("catchBody"), finallyBody: f.optionalBlock("finallyBody")}
+		if (stmt.catchName == nil) != (stmt.catchBody == nil) {
+			decodeFail("Try node requires both 'catchName' and 'catchBody' or neither")
+		}
+		if stmt.catchBody == nil && stmt.finallyBody == nil {
+			decodeFail("Try node requires 'catchBody' or 'finallyBody'")
+		}
+		return stmt
+	case "Break":
+		return &BreakStmt{keyword: f.token("keyword")}
+	case "Continue":
+		return &ContinueStmt{keyword: f.token("keyword")}
+	case "Function":
+		return &FunctionStmt{name: f.token("name"), params: f.tokens("params"), body: f.stmts("body")}
+	case "Import":
+		path := f.token("path")
+		if _, ok := path.Literal.(string); !ok || path.TType != Token.STRING {
+			decodeFail("path of Import node must be a string token")
+		}
+		return &ImportStmt{keyword: f.token("keyword"), path: path, name: f.token("name")}
+	}
+	decodeFail("unknown statement kind '%s'", f.kind())
+	return nil
+}
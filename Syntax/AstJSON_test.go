@@ -0,0 +1,109 @@
+package Syntax
+
+import (
+	"github.com/trueabc/lox/Errors"
+	"github.com/trueabc/lox/Token"
+	"strings"
+	"testing"
+)
+
+// document 把语句拼成 --emit-ast=json 格式的文档
+func document(statements ...string) []byte {
+	return []byte(`{"version": 1, "statements": [` + strings.Join(statements, ", ") + `]}`)
+}
+
+// printLiteral 输出 value 的 Print 语句
+func printLiteral(value string) string {
+	return `{"kind": "Print", "expression": {"kind": "Literal", "value": ` + value + `}}`
+}
+
+// importPath 导入语句, path 为路径的 token
+func importPath(path string) string {
+	return `{"kind": "Import", "keyword": {"type": "import", "lexeme": "import", "line": 1, "column": 1, "offset": 0},
+		"name": {"type": "identifier", "lexeme": "m", "line": 1, "column": 8, "offset": 7}, "path": ` + path + `}`
+}
+
+// negate 对变量取负的 Print 语句, 运行时错误会指向 token 的位置
+func negate(name string) string {
+	return `{"kind": "Print", "expression": {"kind": "Unary",
+		"operator": {"type": "-", "lexeme": "-", "line": 1, "column": 7, "offset": 6},
+		"right": {"kind": "Variable", "name": ` + name + `}}}`
+}
+
+// operation 对两个数字做 kind 运算的 Print 语句, operator 为运算符的 token
+func operation(kind, operator string) string {
+	one := `{"kind": "Literal", "value": 1}`
+	if kind == "Unary" {
+		return `{"kind": "Print", "expression": {"kind": "Unary", "operator": ` + operator + `, "right": ` + one + `}}`
+	}
+	return `{"kind": "Print", "expression": {"kind": "` + kind + `", "left": ` + one + `, "operator": ` + operator +
+		`, "right": ` + one + `}}`
+}
+
+func TestUnmarshalLiterals(t *testing.T) {
+	for _, value := range []string{`null`, `true`, `1.5`, `"a"`} {
+		if _, err := UnmarshalAST(document(printLiteral(value))); err != nil {
+			t.Errorf("%s: unexpected error %v", value, err)
+		}
+	}
+}
+
+// 格式不正确的语法树返回错误, 不会在执行时 panic
+func TestUnmarshalMalformed(t *testing.T) {
+	tests := []struct {
+		name  string
+		data  []byte
+		error string
+	}{
+		{"array literal", document(printLiteral(`[1, 2]`)),
+			"value of Literal node must be a number, string, boolean or null"},
+		{"object literal", document(printLiteral(`{"a": 1}`)),
+			"value of Literal node must be a number, string, boolean or null"},
+		{"negative offset", document(negate(`{"type": "identifier", "lexeme": "x", "line": 1, "column": 8, "offset": -5}`)),
+			"position of token 'x' can't be negative"},
+		{"negative line", document(negate(`{"type": "identifier", "lexeme": "x", "line": -1, "column": 8, "offset": 7}`)),
+			"position of token 'x' can't be negative"},
+		{"identifier with a literal", document(negate(`{"type": "identifier", "lexeme": "x", "literal": "x", "line": 1, "column": 8, "offset": 7}`)),
+			"identifier token 'x' can't have a string literal"},
+		{"string with a number literal", document(importPath(`{"type": "str", "lexeme": "1", "literal": 1, "line": 1, "column": 8, "offset": 7}`)),
+			"str token '1' can't have a number literal"},
+		{"literal of another type", document(importPath(`{"type": "str", "lexeme": "m", "literal": ["m"], "line": 1, "column": 8, "offset": 7}`)),
+			"literal of token 'm' must be a number or string"},
+		{"import path without literal", document(importPath(`{"type": "str", "lexeme": "m", "line": 1, "column": 8, "offset": 7}`)),
+			"path of Import node must be a string token"},
+		{"binary with a parenthesis", document(operation("Binary", `{"type": "(", "lexeme": "(", "line": 1, "column": 9, "offset": 8}`)),
+			"'(' is not a binary operator"},
+		{"unary with a comparison", document(operation("Unary", `{"type": "!=", "lexeme": "!=", "line": 1, "column": 7, "offset": 6}`)),
+			"'!=' is not a unary operator"},
+		{"logic with a plus", document(operation("Logic", `{"type": "+", "lexeme": "+", "line": 1, "column": 9, "offset": 8}`)),
+			"'+' is not a logical operator"},
+		{"import path of another type", document(importPath(`{"type": "num", "lexeme": "1", "literal": 1, "line": 1, "column": 8, "offset": 7}`)),
+			"path of Import node must be a string token"},
+	}
+	for _, test := range tests {
+		stmts, err := UnmarshalAST(test.data)
+		if err == nil {
+			t.Errorf("%s: expected an error, got %d statements", test.name, len(stmts))
+			continue
+		}
+		if !strings.Contains(err.Error(), test.error) {
+			t.Errorf("%s: got error %q, want %q", test.name, err, test.error)
+		}
+	}
+}
+
+// 没有经过检查的语法树中出现未知的运算符时, 编译器报告错误而不是生成错误的指令
+func TestCompileUnknownOperator(t *testing.T) {
+	one := &LiteralExpr{value: 1.0}
+	paren := Token.NewToken(Token.LEFT_PAREN, "(", nil, 1, 9, 8)
+	for _, expr := range []Expr{
+		&BinaryExpr{left: one, operator: paren, right: one},
+		&UnaryExpr{operator: paren, right: one},
+	} {
+		reporter := Errors.NewReporter("", "print 1 ( 1;")
+		NewCompiler(reporter).Compile([]Stmt{&PrintStmt{Expression: expr}})
+		if len(reporter.Diagnostics) != 1 || !strings.Contains(reporter.Diagnostics[0].Message, "operator '('") {
+			t.Errorf("%T: got %v", expr, reporter.Diagnostics)
+		}
+	}
+}
@@ -0,0 +1,317 @@
+package Syntax
+
+import (
+	"github.com/trueabc/lox/Token"
+	"strconv"
+	"strings"
+)
+
+// AstPrinter 输出语法树, 用于调试解析器
+// 两种格式: 带括号的前缀形式, 例如 (* (- 1) (group 2)), 以及每层缩进两个空格的树形结构
+type AstPrinter struct {
+}
+
+func NewAstPrinter() *AstPrinter {
+	return &AstPrinter{}
+}
+
+// astNode 两种格式共用的中间结构, leaf 表示变量名, 字面量这样不需要括号的节点
+type astNode struct {
+	label    string
+	children []*astNode
+	leaf     bool
+}
+
+func leaf(label string) *astNode {
+	return &astNode{label: label, leaf: true}
+}
+
+// Print 表达式的前缀形式
+func (a *AstPrinter) Print(expr Expr) string {
+	return a.expr(expr).sexpr()
+}
+
+// PrintStmts 每个顶层语句输出一行前缀形式
+func (a *AstPrinter) PrintStmts(stmts []Stmt) string {
+	var builder strings.Builder
+	for _, stmt := range stmts {
+		builder.WriteString(a.stmt(stmt).sexpr() + "\n")
+	}
+	return builder.String()
+}
+
+// Tree 缩进的树形结构, 子节点比父节点多缩进两个空格
+func (a *AstPrinter) Tree(stmts []Stmt) string {
+	var builder strings.Builder
+	for _, stmt := range stmts {
+		a.stmt(stmt).tree(&builder, 0)
+	}
+	return builder.String()
+}
+
+func (a *AstPrinter) expr(expr Expr) *astNode {
+	return expr.Accept(a).(*astNode)
+}
+
+func (a *AstPrinter) stmt(stmt Stmt) *astNode {
+	return stmt.Accept(a).(*astNode)
+}
+
+func (n *astNode) sexpr() string {
+	if n.leaf {
+		return n.label
+	}
+	var builder strings.Builder
+	builder.WriteString("(" + n.label)
+	for _, child := range n.children {
+		builder.WriteString(" " + child.sexpr())
+	}
+	builder.WriteString(")")
+	return builder.String()
+}
+
+func (n *astNode) tree(builder *strings.Builder, depth int) {
+	builder.WriteString(strings.Repeat("  ", depth) + n.label + "\n")
+	for _, child := range n.children {
+		child.tree(builder, depth+1)
+	}
+}
+
+func (a *AstPrinter) node(label string, exprs ...Expr) *astNode {
+	node := &astNode{label: label}
+	for _, item := range exprs {
+		node.children = append(node.children, a.expr(item))
+	}
+	return node
+}
+
+func (a *AstPrinter) block(label string, stmts []Stmt) *astNode {
+	node := &astNode{label: label}
+	for _, item := range stmts {
+		node.children = append(node.children, a.stmt(item))
+	}
+	return node
+}
+
+func (a *AstPrinter) VisitBinaryExpr(expr Expr) interface{} {
+	class := expr.(*BinaryExpr)
+	return a.node(class.operator.Lexeme, class.left, class.right)
+}
+
+func (a *AstPrinter) VisitGroupingExpr(expr Expr) interface{} {
+	class := expr.(*GroupingExpr)
+	return a.node("group", class.expression)
+}
+
+func (a *AstPrinter) VisitLiteralExpr(expr Expr) interface{} {
+	class := expr.(*LiteralExpr)
+	if s, ok := class.value.(string); ok {
+		return leaf(strconv.Quote(s))
+	}
+	return leaf(Stringify(class.value))
+}
+
+func (a *AstPrinter) VisitUnaryExpr(expr Expr) interface{} {
+	class := expr.(*UnaryExpr)
+	return a.node(class.operator.Lexeme, class.right)
+}
+
+func (a *AstPrinter) VisitVariableExpr(expr Expr) interface{} {
+	class := expr.(*VariableExpr)
+	return leaf(class.name.Lexeme)
+}
+
+func (a *AstPrinter) VisitThisExpr(expr Expr) interface{} {
+	return leaf("this")
+}
+
+func (a *AstPrinter) VisitSuperExpr(expr Expr) interface{} {
+	class := expr.(*SuperExpr)
+	return &astNode{label: "super", children: []*astNode{leaf(class.method.Lexeme)}}
+}
+
+func (a *AstPrinter) VisitGetExpr(expr Expr) interface{} {
+	class := expr.(*GetExpr)
+	node := a.node(".", class.object)
+	node.children = append(node.children, leaf(class.name.Lexeme))
+	return node
+}
+
+func (a *AstPrinter) VisitSetExpr(expr Expr) interface{} {
+	class := expr.(*SetExpr)
+	target := a.node(".", class.object)
+	target.children = append(target.children, leaf(class.name.Lexeme))
+	return a.assign(target, class.value, class.operator, class.postfix)
+}
+
+// assign 赋值的标签是运算符, 自增自减省略隐含的 1, 后缀形式的标签为 post++ 和 post--
+func (a *AstPrinter) assign(target *astNode, value Expr, operator *Token.Token, postfix bool) *astNode {
+	switch {
+	case operator == nil:
+		return &astNode{label: "=", children: []*astNode{target, a.expr(value)}}
+	case operator.TType != Token.PLUS_PLUS && operator.TType != Token.MINUS_MINUS:
+		return &astNode{label: operator.Lexeme, children: []*astNode{target, a.expr(value)}}
+	case postfix:
+		return &astNode{label: "post" + operator.Lexeme, children: []*astNode{target}}
+	}
+	return &astNode{label: operator.Lexeme, children: []*astNode{target}}
+}
+
+func (a *AstPrinter) VisitLogicExpr(expr Expr) interface{} {
+	class := expr.(*LogicExpr)
+	return a.node(class.operator.Lexeme, class.left, class.right)
+}
+
+func (a *AstPrinter) VisitAssignmentExpr(expr Expr) interface{} {
+	class := expr.(*AssignmentExpr)
+	return a.assign(leaf(class.name.Lexeme), class.value, class.operator, class.postfix)
+}
+
+func (a *AstPrinter) VisitCallExpr(expr Expr) interface{} {
+	class := expr.(*CallExpr)
+	return a.node("call", append([]Expr{class.callee}, class.arguments...)...)
+}
+
+func (a *AstPrinter) VisitListExpr(expr Expr) interface{} {
+	class := expr.(*ListExpr)
+	return a.node("list", class.elements...)
+}
+
+func (a *AstPrinter) VisitMapExpr(expr Expr) interface{} {
+	class := expr.(*MapExpr)
+	entries := make([]Expr, 0, 2*len(class.keys))
+	for id := range class.keys {
+		entries = append(entries, class.keys[id], class.values[id])
+	}
+	return a.node("map", entries...)
+}
+
+func (a *AstPrinter) VisitIndexExpr(expr Expr) interface{} {
+	class := expr.(*IndexExpr)
+	return a.node("[]", class.object, class.index)
+}
+
+func (a *AstPrinter) VisitSetIndexExpr(expr Expr) interface{} {
+	class := expr.(*SetIndexExpr)
+	target := a.node("[]", class.object, class.index)
+	return a.assign(target, class.value, class.operator, class.postfix)
+}
+
+func (a *AstPrinter) VisitExpressionStmt(stmt Stmt) interface{} {
+	class := stmt.(*ExpressionStmt)
+	return a.node(";", class.Expression)
+}
+
+func (a *AstPrinter) VisitPrintStmt(stmt Stmt) interface{} {
+	class := stmt.(*PrintStmt)
+	return a.node("print", class.Expression)
+}
+
+func (a *AstPrinter) VisitVariableStmt(stmt Stmt) interface{} {
+	class := stmt.(*VariableStmt)
+	if class.initializer == nil {
+		return a.node("var " + class.name.Lexeme)
+	}
+	return a.node("var "+class.name.Lexeme, class.initializer)
+}
+
+func (a *AstPrinter) VisitBlockStmt(stmt Stmt) interface{} {
+	class := stmt.(*BlockStmt)
+	return a.block("block", class.statements)
+}
+
+func (a *AstPrinter) VisitClassStmt(stmt Stmt) interface{} {
+	class := stmt.(*ClassStmt)
+	label := "class " + class.name.Lexeme
+	if class.superClass != nil {
+		label += " < " + class.superClass.name.Lexeme
+	}
+	return a.block(label, class.methods)
+}
+
+func (a *AstPrinter) VisitWhileStmt(stmt Stmt) interface{} {
+	class := stmt.(*WhileStmt)
+	node := a.node("while", class.condition)
+	node.children = append(node.children, a.stmt(class.body))
+	return node
+}
+
+func (a *AstPrinter) VisitForStmt(stmt Stmt) interface{} {
+	class := stmt.(*ForStmt)
+	node := &astNode{label: "for"}
+	// 省略的部分输出为 nil, 保证子节点的位置固定
+	if class.initializer != nil {
+		node.children = append(node.children, a.stmt(class.initializer))
+	} else {
+		node.children = append(node.children, leaf("nil"))
+	}
+	for _, item := range []Expr{class.condition, class.increment} {
+		if item != nil {
+			node.children = append(node.children, a.expr(item))
+		} else {
+			node.children = append(node.children, leaf("nil"))
+		}
+	}
+	node.children = append(node.children, a.stmt(class.body))
+	return node
+}
+
+func (a *AstPrinter) VisitIfStmt(stmt Stmt) interface{} {
+	class := stmt.(*IfStmt)
+	node := a.node("if", class.condition)
+	node.children = append(node.children, a.stmt(class.thenBranch))
+	if class.elseBranch != nil {
+		node.children = append(node.children, a.stmt(class.elseBranch))
+	}
+	return node
+}
+
+func (a *AstPrinter) VisitReturnStmt(stmt Stmt) interface{} {
+	class := stmt.(*ReturnStmt)
+	if class.value == nil {
+		return a.node("return")
+	}
+	return a.node("return", class.value)
+}
+
+func (a *AstPrinter) VisitThrowStmt(stmt Stmt) interface{} {
+	class := stmt.(*ThrowStmt)
+	return a.node("throw", class.value)
+}
+
+// VisitTryStmt 输出为 (try body (catch e body) (finally body)), 没有的部分省略
+func (a *AstPrinter) VisitTryStmt(stmt Stmt) interface{} {
+	class := stmt.(*TryStmt)
+	node := &astNode{label: "try", children: []*astNode{a.stmt(class.body)}}
+	if class.catchBody != nil {
+		node.children = append(node.children, &astNode{label: "catch",
+			children: []*astNode{leaf(class.catchName.Lexeme), a.stmt(class.catchBody)}})
+	}
+	if class.finallyBody != nil {
+		node.children = append(node.children, &astNode{label: "finally",
+			children: []*astNode{a.stmt(class.finallyBody)}})
+	}
+	return node
+}
+
+func (a *AstPrinter) VisitBreakStmt(stmt Stmt) interface{} {
+	return a.node("break")
+}
+
+func (a *AstPrinter) VisitContinueStmt(stmt Stmt) interface{} {
+	return a.node("continue")
+}
+
+func (a *AstPrinter) VisitFunctionStmt(stmt Stmt) interface{} {
+	class := stmt.(*FunctionStmt)
+	params := make([]string, len(class.params))
+	for id, param := range class.params {
+		params[id] = param.Lexeme
+	}
+	return a.block("fun "+class.name.Lexeme+"("+strings.Join(params, ", ")+")", class.body)
+}
+
+func (a *AstPrinter) VisitImportStmt(stmt Stmt) interface{} {
+	class := stmt.(*ImportStmt)
+	return a.node("import " + class.path.Lexeme + " as " + class.name.Lexeme)
+}
@@ -0,0 +1,77 @@
+package Syntax
+
+import (
+	"github.com/trueabc/lox/Errors"
+	"github.com/trueabc/lox/Token"
+	"testing"
+)
+
+func parse(t *testing.T, source string) []Stmt {
+	reporter := Errors.NewReporter("printer.lox", source)
+	stmts := NewParser(Token.NewScanner(source, reporter).ScanTokens(), reporter).Parse()
+	if reporter.HadError() {
+		t.Fatalf("unexpected errors in %q: %v", source, reporter.Diagnostics)
+	}
+	return stmts
+}
+
+// 前缀形式中括号的嵌套就是解析器得到的优先级和结合性
+func TestPrintStmts(t *testing.T) {
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{"print 1 + 2 * -3;", "(print (+ 1 (* 2 (- 3))))"},
+		{"print (1 - 2) - 3;", "(print (- (group (- 1 2)) 3))"},
+		{"print 2 ** 3 ** 2;", "(print (** 2 (** 3 2)))"},
+		{"print a or b and !c;", "(print (or a (and b (! c))))"},
+		{"a = b = 1;", "(; (= a (= b 1)))"},
+		{"var s = \"x\";", "(var s \"x\")"},
+		{"var n;", "(var n)"},
+		{"if (a) print 1; else { print 2; }", "(if a (print 1) (block (print 2)))"},
+		{"while (a) a = a - 1;", "(while a (; (= a (- a 1))))"},
+		{"for (var i = 0; i < 3; i++) print i;", "(for (var i 0) (< i 3) (post++ i) (print i))"},
+		{"for (;;) break;", "(for nil nil nil (break))"},
+		{"class B < A { init(x) { this.x = x; super.init(); } }",
+			"(class B < A (fun init(x) (; (= (. this x) x)) (; (call (super init)))))"},
+		{"fun f(a, b) { return [a, b][0]; }", "(fun f(a, b) (return ([] (list a b) 0)))"},
+		{"print {\"k\": 1}[\"k\"];", "(print ([] (map \"k\" 1) \"k\"))"},
+	}
+	printer := NewAstPrinter()
+	for _, test := range tests {
+		if got := printer.PrintStmts(parse(t, test.source)); got != test.want+"\n" {
+			t.Errorf("%s: got %q, want %q", test.source, got, test.want+"\n")
+		}
+	}
+}
+
+// 树形结构中每个子节点比父节点多缩进两个空格
+func TestTree(t *testing.T) {
+	source := "var a = 1 + 2 * 3;\nprint -a;\n"
+	want := `var a
+  +
+    1
+    *
+      2
+      3
+print
+  -
+    a
+`
+	if got := NewAstPrinter().Tree(parse(t, source)); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+// REPL 的 :ast 只打印一个表达式
+func TestPrintExpression(t *testing.T) {
+	source := "a.b(1)[2]"
+	reporter := Errors.NewReporter("", source)
+	expr := NewParser(Token.NewScanner(source, reporter).ScanTokens(), reporter).ParseExpression()
+	if expr == nil {
+		t.Fatalf("unexpected errors: %v", reporter.Diagnostics)
+	}
+	if got, want := NewAstPrinter().Print(expr), "([] (call (. a b) 1) 2)"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,82 @@
+package Syntax
+
+import (
+	"fmt"
+	"github.com/trueabc/lox/Token"
+	"strings"
+)
+
+// 调用栈的最大深度, 超过之后报 Stack overflow 而不是让 go 的栈溢出
+const maxCallDepth = 10000
+
+// CallFrame 一次函数调用, 在 VisitCallExpr 中入栈, import 的模块的顶层代码也是一层
+type CallFrame struct {
+	Function string // 函数名, 构造函数为 init
+	Class    string // 方法所属的类, 普通函数为空
+	Module   string // 模块顶层代码的 import 路径, 函数调用为空
+	Line     int    // 调用或者 import 发生的行
+}
+
+func (cf CallFrame) Name() string {
+	if cf.Module != "" {
+		return cf.Module
+	}
+	if cf.Class != "" {
+		return cf.Class + "." + cf.Function + "()"
+	}
+	return cf.Function + "()"
+}
+
+// TraceLine 调用栈中的一行, 从最内层开始
+type TraceLine struct {
+	Line     int
+	Function string
+}
+
+func (tl TraceLine) String() string {
+	return fmt.Sprintf("[line %d] in %s", tl.Line, tl.Function)
+}
+
+// StackTrace 多行的调用栈, 没有调用栈信息时只输出行号
+func (re *RuntimeError) StackTrace() string {
+	if len(re.Trace) == 0 {
+		return fmt.Sprintf("[line %d]", re.Line())
+	}
+	lines := make([]string, 0, len(re.Trace))
+	for _, item := range re.Trace {
+		lines = append(lines, item.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (i *Interpreter) pushFrame(callee LoxCallable, paren *Token.Token) {
+	if len(i.frames) >= maxCallDepth {
+		panic(NewRuntimeError(paren, "Stack overflow."))
+	}
+	frame := CallFrame{Line: paren.Line}
+	switch c := callee.(type) {
+	case *LoxFunction:
+		frame.Function = c.funcStmt.name.Lexeme
+		frame.Class = c.className
+	case *LoxClass:
+		frame.Function = "init"
+		frame.Class = c.name
+	default:
+		frame.Function = fmt.Sprintf("%v", callee)
+	}
+	i.frames = append(i.frames, frame)
+}
+
+func (i *Interpreter) popFrame() {
+	i.frames = i.frames[:len(i.frames)-1]
+}
+
+// 在错误发生的位置记录调用栈, 最内层在前
+func (i *Interpreter) stackTrace(line int) []TraceLine {
+	trace := make([]TraceLine, 0, len(i.frames)+1)
+	for k := len(i.frames) - 1; k >= 0; k-- {
+		trace = append(trace, TraceLine{line, i.frames[k].Name()})
+		line = i.frames[k].Line
+	}
+	return append(trace, TraceLine{line, "script"})
+}
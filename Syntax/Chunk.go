@@ -0,0 +1,215 @@
+package Syntax
+
+import (
+	"fmt"
+	"github.com/trueabc/lox/Token"
+	"io"
+)
+
+// OpCode 字节码指令, 操作数紧跟在指令后面
+type OpCode byte
+
+const (
+	OP_CONSTANT      OpCode = iota // index
+	OP_NIL                         //
+	OP_TRUE                        //
+	OP_FALSE                       //
+	OP_POP                         //
+	OP_DUP                         // 距离栈顶的位置, 0 为栈顶
+	OP_SWAP                        //
+	OP_GET_LOCAL                   // slot
+	OP_SET_LOCAL                   // slot
+	OP_GET_GLOBAL                  // name index
+	OP_DEFINE_GLOBAL               // name index
+	OP_SET_GLOBAL                  // name index
+	OP_GET_UPVALUE                 // upvalue index
+	OP_SET_UPVALUE                 // upvalue index
+	OP_GET_PROPERTY                // name index
+	OP_SET_PROPERTY                // name index
+	OP_GET_SUPER                   // name index
+	OP_EQUAL                       //
+	OP_GREATER                     //
+	OP_LESS                        //
+	OP_ADD                         //
+	OP_SUBTRACT                    //
+	OP_MULTIPLY                    //
+	OP_DIVIDE                      //
+	OP_FLOOR_DIVIDE                //
+	OP_MODULO                      //
+	OP_POWER                       //
+	OP_BIT_AND                     //
+	OP_BIT_OR                      //
+	OP_BIT_XOR                     //
+	OP_SHIFT_LEFT                  //
+	OP_SHIFT_RIGHT                 //
+	OP_BIT_NOT                     //
+	OP_CONCAT                      // 转换为字符串之后拼接, 用于字符串插值
+	OP_NOT                         //
+	OP_NEGATE                      //
+	OP_PRINT                       //
+	OP_JUMP                        // 16 位偏移
+	OP_JUMP_IF_FALSE               // 16 位偏移
+	OP_LOOP                        // 16 位偏移, 向后跳
+	OP_CALL                        // 参数个数
+	OP_INVOKE                      // name index, 参数个数
+	OP_SUPER_INVOKE                // name index, 参数个数
+	OP_CLOSURE                     // function index, 之后每个 upvalue 两个字节 (isLocal, index)
+	OP_CLOSE_UPVALUE               //
+	OP_RETURN                      //
+	OP_CLASS                       // name index
+	OP_INHERIT                     //
+	OP_METHOD                      // name index
+	OP_LIST                        // 元素个数
+	OP_MAP                         // 键值对个数
+	OP_GET_INDEX                   //
+	OP_SET_INDEX                   //
+	OP_IMPORT                      // path index, name index
+	OP_TRY                         // 16 位偏移, 指向 catch 或者 finally
+	OP_END_TRY                     //
+	OP_THROW                       //
+)
+
+var opCodeNames = map[OpCode]string{
+	OP_CONSTANT:      "OP_CONSTANT",
+	OP_NIL:           "OP_NIL",
+	OP_TRUE:          "OP_TRUE",
+	OP_FALSE:         "OP_FALSE",
+	OP_POP:           "OP_POP",
+	OP_DUP:           "OP_DUP",
+	OP_SWAP:          "OP_SWAP",
+	OP_GET_LOCAL:     "OP_GET_LOCAL",
+	OP_SET_LOCAL:     "OP_SET_LOCAL",
+	OP_GET_GLOBAL:    "OP_GET_GLOBAL",
+	OP_DEFINE_GLOBAL: "OP_DEFINE_GLOBAL",
+	OP_SET_GLOBAL:    "OP_SET_GLOBAL",
+	OP_GET_UPVALUE:   "OP_GET_UPVALUE",
+	OP_SET_UPVALUE:   "OP_SET_UPVALUE",
+	OP_GET_PROPERTY:  "OP_GET_PROPERTY",
+	OP_SET_PROPERTY:  "OP_SET_PROPERTY",
+	OP_GET_SUPER:     "OP_GET_SUPER",
+	OP_EQUAL:         "OP_EQUAL",
+	OP_GREATER:       "OP_GREATER",
+	OP_LESS:          "OP_LESS",
+	OP_ADD:           "OP_ADD",
+	OP_SUBTRACT:      "OP_SUBTRACT",
+	OP_MULTIPLY:      "OP_MULTIPLY",
+	OP_DIVIDE:        "OP_DIVIDE",
+	OP_FLOOR_DIVIDE:  "OP_FLOOR_DIVIDE",
+	OP_MODULO:        "OP_MODULO",
+	OP_POWER:         "OP_POWER",
+	OP_BIT_AND:       "OP_BIT_AND",
+	OP_BIT_OR:        "OP_BIT_OR",
+	OP_BIT_XOR:       "OP_BIT_XOR",
+	OP_SHIFT_LEFT:    "OP_SHIFT_LEFT",
+	OP_SHIFT_RIGHT:   "OP_SHIFT_RIGHT",
+	OP_BIT_NOT:       "OP_BIT_NOT",
+	OP_CONCAT:        "OP_CONCAT",
+	OP_NOT:           "OP_NOT",
+	OP_NEGATE:        "OP_NEGATE",
+	OP_PRINT:         "OP_PRINT",
+	OP_JUMP:          "OP_JUMP",
+	OP_JUMP_IF_FALSE: "OP_JUMP_IF_FALSE",
+	OP_LOOP:          "OP_LOOP",
+	OP_CALL:          "OP_CALL",
+	OP_INVOKE:        "OP_INVOKE",
+	OP_SUPER_INVOKE:  "OP_SUPER_INVOKE",
+	OP_CLOSURE:       "OP_CLOSURE",
+	OP_CLOSE_UPVALUE: "OP_CLOSE_UPVALUE",
+	OP_RETURN:        "OP_RETURN",
+	OP_CLASS:         "OP_CLASS",
+	OP_INHERIT:       "OP_INHERIT",
+	OP_METHOD:        "OP_METHOD",
+	OP_LIST:          "OP_LIST",
+	OP_MAP:           "OP_MAP",
+	OP_GET_INDEX:     "OP_GET_INDEX",
+	OP_SET_INDEX:     "OP_SET_INDEX",
+	OP_IMPORT:        "OP_IMPORT",
+	OP_TRY:           "OP_TRY",
+	OP_END_TRY:       "OP_END_TRY",
+	OP_THROW:         "OP_THROW",
+}
+
+func (op OpCode) String() string {
+	if name, ok := opCodeNames[op]; ok {
+		return name
+	}
+	return fmt.Sprintf("OP_UNKNOWN(%d)", byte(op))
+}
+
+// Chunk 一个函数的字节码
+type Chunk struct {
+	Code      []byte
+	Constants []Value
+	// 每个字节对应的 token, 运行时错误用来定位行号和源码
+	Tokens []*Token.Token
+}
+
+func NewChunk() *Chunk {
+	return &Chunk{Code: make([]byte, 0), Constants: make([]Value, 0), Tokens: make([]*Token.Token, 0)}
+}
+
+func (c *Chunk) Write(b byte, token *Token.Token) {
+	c.Code = append(c.Code, b)
+	c.Tokens = append(c.Tokens, token)
+}
+
+// AddConstant 返回常量的下标, 超出一个字节的范围由编译器报错
+func (c *Chunk) AddConstant(value Value) int {
+	c.Constants = append(c.Constants, value)
+	return len(c.Constants) - 1
+}
+
+// Disassemble 输出可读的字节码, 调试用
+func (c *Chunk) Disassemble(out io.Writer, name string) {
+	fmt.Fprintf(out, "== %s ==\n", name)
+	for offset := 0; offset < len(c.Code); {
+		offset = c.disassembleInstruction(out, offset)
+	}
+}
+
+func (c *Chunk) disassembleInstruction(out io.Writer, offset int) int {
+	fmt.Fprintf(out, "%04d %4d ", offset, c.Tokens[offset].Line)
+	op := OpCode(c.Code[offset])
+	switch op {
+	case OP_CONSTANT, OP_GET_GLOBAL, OP_DEFINE_GLOBAL, OP_SET_GLOBAL,
+		OP_GET_PROPERTY, OP_SET_PROPERTY, OP_GET_SUPER, OP_CLASS, OP_METHOD:
+		index := c.Code[offset+1]
+		fmt.Fprintf(out, "%-16s %4d '%v'\n", op, index, c.Constants[index])
+		return offset + 2
+	case OP_GET_LOCAL, OP_SET_LOCAL, OP_GET_UPVALUE, OP_SET_UPVALUE, OP_CALL, OP_LIST, OP_MAP, OP_DUP:
+		fmt.Fprintf(out, "%-16s %4d\n", op, c.Code[offset+1])
+		return offset + 2
+	case OP_JUMP, OP_JUMP_IF_FALSE, OP_LOOP, OP_TRY:
+		jump := int(c.Code[offset+1])<<8 | int(c.Code[offset+2])
+		target := offset + 3 + jump
+		if op == OP_LOOP {
+			target = offset + 3 - jump
+		}
+		fmt.Fprintf(out, "%-16s %4d -> %d\n", op, offset, target)
+		return offset + 3
+	case OP_IMPORT:
+		fmt.Fprintf(out, "%-16s '%v' as '%v'\n", op, c.Constants[c.Code[offset+1]], c.Constants[c.Code[offset+2]])
+		return offset + 3
+	case OP_INVOKE, OP_SUPER_INVOKE:
+		index := c.Code[offset+1]
+		fmt.Fprintf(out, "%-16s (%d args) %4d '%v'\n", op, c.Code[offset+2], index, c.Constants[index])
+		return offset + 3
+	case OP_CLOSURE:
+		index := c.Code[offset+1]
+		function := c.Constants[index].obj.(*ObjFunction)
+		fmt.Fprintf(out, "%-16s %4d %v\n", op, index, function)
+		offset += 2
+		for j := 0; j < function.upvalueCount; j++ {
+			kind := "upvalue"
+			if c.Code[offset] == 1 {
+				kind = "local"
+			}
+			fmt.Fprintf(out, "%04d      |                     %s %d\n", offset, kind, c.Code[offset+1])
+			offset += 2
+		}
+		return offset
+	default:
+		fmt.Fprintf(out, "%v\n", op)
+		return offset + 1
+	}
+}
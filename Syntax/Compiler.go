@@ -0,0 +1,1067 @@
+package Syntax
+
+import (
+	"github.com/trueabc/lox/Errors"
+	"github.com/trueabc/lox/Token"
+)
+
+// Compiler 把语法树编译为字节码, 语义检查已经由 Resolver 完成
+// 这里只处理字节码本身的限制: 常量, 局部变量, upvalue 的个数以及跳转的距离
+
+const uint8Count = 256
+
+type local struct {
+	name       string
+	depth      int // -1 表示已经声明但是还没有初始化
+	isCaptured bool
+}
+
+type upvalueRef struct {
+	index   byte
+	isLocal bool
+}
+
+// 每个正在编译的函数一个 funcCompiler, 通过 enclosing 形成链
+type funcCompiler struct {
+	enclosing *funcCompiler
+	function  *ObjFunction
+	kind      FunctionType
+
+	locals     []local
+	upvalues   []upvalueRef
+	scopeDepth int
+	// 正在编译的循环, 最内层在最后
+	loops []*loopCompiler
+	// 正在编译的 try 和带有 finally 的 catch, 最内层在最后
+	tries []*tryCompiler
+}
+
+// tryCompiler break, continue 和 return 离开 try 时需要移除异常处理器并执行 finally
+type tryCompiler struct {
+	finally *BlockStmt
+	// try 开始时的局部变量个数, 之后声明的局部变量在 finally 中不可见
+	locals int
+	// try 开始时的循环层数, 只有离开这些循环的 break 和 continue 不经过这个 try
+	loops int
+}
+
+// loopCompiler 记录 break 和 continue 的跳转, 循环体编译完之后回填
+type loopCompiler struct {
+	// 循环体外层的作用域深度, 跳出时弹出更深的局部变量
+	scopeDepth int
+	breaks     []int
+	continues  []int
+}
+
+type classCompiler struct {
+	enclosing     *classCompiler
+	hasSuperclass bool
+}
+
+type Compiler struct {
+	current  *funcCompiler
+	class    *classCompiler
+	reporter *Errors.Reporter
+
+	// 最近一个访问到的 token, 写入字节码时记录, 也作为错误的位置
+	token *Token.Token
+	// 同一个语句只报告第一个错误, 避免连锁的错误
+	panicMode bool
+}
+
+func NewCompiler(reporter *Errors.Reporter) *Compiler {
+	return &Compiler{reporter: reporter,
+		token: Token.NewToken(Token.EOF, "", nil, 1, 1, 0)}
+}
+
+// Compile 把顶层的语句编译为 script 函数, 出错时返回 nil
+func (c *Compiler) Compile(stmts []Stmt) *ObjFunction {
+	c.beginFunction(None, "")
+	for _, stmt := range stmts {
+		c.compileStmt(stmt)
+	}
+	function := c.endFunction()
+	if c.reporter.HadError() {
+		return nil
+	}
+	return function
+}
+
+// CompileExpression 编译一个返回表达式值的 script 函数, 用于 REPL 回显
+func (c *Compiler) CompileExpression(expr Expr) *ObjFunction {
+	c.beginFunction(None, "")
+	c.panicMode = false
+	c.compileExpr(expr)
+	c.emitOp(OP_RETURN)
+	function := c.endFunction()
+	if c.reporter.HadError() {
+		return nil
+	}
+	return function
+}
+
+func (c *Compiler) beginFunction(kind FunctionType, name string) {
+	fc := &funcCompiler{
+		enclosing: c.current,
+		function:  &ObjFunction{name: name, chunk: NewChunk(), reporter: c.reporter},
+		kind:      kind,
+		locals:    make([]local, 0, 8),
+	}
+	// slot 0 保存被调用的函数, 方法中是 this
+	slotZero := ""
+	if kind == METHOD || kind == ISINITIALIZER {
+		slotZero = "this"
+	}
+	fc.locals = append(fc.locals, local{name: slotZero, depth: 0})
+	c.current = fc
+}
+
+func (c *Compiler) endFunction() *ObjFunction {
+	c.emitReturn()
+	function := c.current.function
+	function.upvalueCount = len(c.current.upvalues)
+	c.current = c.current.enclosing
+	return function
+}
+
+func (c *Compiler) error(token *Token.Token, message string) {
+	if c.panicMode {
+		return
+	}
+	c.panicMode = true
+	c.reporter.LoxError(token, message)
+}
+
+func (c *Compiler) compileStmt(stmt Stmt) {
+	c.panicMode = false
+	stmt.Accept(c)
+}
+
+func (c *Compiler) compileExpr(expr Expr) {
+	expr.Accept(c)
+}
+
+func (c *Compiler) chunk() *Chunk {
+	return c.current.function.chunk
+}
+
+// 字节码的写入
+
+func (c *Compiler) emitByte(b byte) {
+	c.chunk().Write(b, c.token)
+}
+
+func (c *Compiler) emitOp(op OpCode) {
+	c.emitByte(byte(op))
+}
+
+func (c *Compiler) emitOpByte(op OpCode, b byte) {
+	c.emitByte(byte(op))
+	c.emitByte(b)
+}
+
+func (c *Compiler) emitReturn() {
+	if c.current.kind == ISINITIALIZER {
+		c.emitOpByte(OP_GET_LOCAL, 0)
+	} else {
+		c.emitOp(OP_NIL)
+	}
+	c.emitOp(OP_RETURN)
+}
+
+func (c *Compiler) makeConstant(value Value) byte {
+	index := c.chunk().AddConstant(value)
+	if index >= uint8Count {
+		c.error(c.token, "Too many constants in one chunk.")
+		return 0
+	}
+	return byte(index)
+}
+
+func (c *Compiler) emitConstant(value Value) {
+	c.emitOpByte(OP_CONSTANT, c.makeConstant(value))
+}
+
+func (c *Compiler) identifierConstant(name *Token.Token) byte {
+	c.token = name
+	// 同一个名字只占用一个常量, 否则较长的脚本很快就会用完 256 个常量
+	for index, constant := range c.chunk().Constants {
+		if index >= uint8Count {
+			break
+		}
+		if lexeme, ok := constant.obj.(string); ok && lexeme == name.Lexeme {
+			return byte(index)
+		}
+	}
+	return c.makeConstant(ObjValue(name.Lexeme))
+}
+
+// 写入跳转指令, 返回偏移量的位置, 之后由 patchJump 回填
+func (c *Compiler) emitJump(op OpCode) int {
+	c.emitOp(op)
+	c.emitByte(0xff)
+	c.emitByte(0xff)
+	return len(c.chunk().Code) - 2
+}
+
+func (c *Compiler) patchJump(offset int) {
+	jump := len(c.chunk().Code) - offset - 2
+	if jump > 0xffff {
+		c.error(c.token, "Too much code to jump over.")
+	}
+	c.chunk().Code[offset] = byte(jump >> 8 & 0xff)
+	c.chunk().Code[offset+1] = byte(jump & 0xff)
+}
+
+func (c *Compiler) emitLoop(loopStart int) {
+	c.emitOp(OP_LOOP)
+	offset := len(c.chunk().Code) - loopStart + 2
+	if offset > 0xffff {
+		c.error(c.token, "Loop body too large.")
+	}
+	c.emitByte(byte(offset >> 8 & 0xff))
+	c.emitByte(byte(offset & 0xff))
+}
+
+// 作用域和变量
+
+func (c *Compiler) beginScope() {
+	c.current.scopeDepth++
+}
+
+func (c *Compiler) endScope() {
+	fc := c.current
+	fc.scopeDepth--
+	for len(fc.locals) > 0 && fc.locals[len(fc.locals)-1].depth > fc.scopeDepth {
+		if fc.locals[len(fc.locals)-1].isCaptured {
+			c.emitOp(OP_CLOSE_UPVALUE)
+		} else {
+			c.emitOp(OP_POP)
+		}
+		fc.locals = fc.locals[:len(fc.locals)-1]
+	}
+}
+
+func (c *Compiler) addLocal(name *Token.Token) {
+	if len(c.current.locals) == uint8Count {
+		c.error(name, "Too many local variables in function.")
+		return
+	}
+	c.current.locals = append(c.current.locals, local{name: name.Lexeme, depth: -1})
+}
+
+// 全局变量不需要声明, 局部变量加入当前作用域
+func (c *Compiler) declareVariable(name *Token.Token) {
+	if c.current.scopeDepth == 0 {
+		return
+	}
+	c.addLocal(name)
+}
+
+func (c *Compiler) markInitialized() {
+	if c.current.scopeDepth == 0 {
+		return
+	}
+	c.current.locals[len(c.current.locals)-1].depth = c.current.scopeDepth
+}
+
+// 值已经在栈顶, 局部变量直接留在栈上, 全局变量写入全局表
+func (c *Compiler) defineVariable(global byte) {
+	if c.current.scopeDepth > 0 {
+		c.markInitialized()
+		return
+	}
+	c.emitOpByte(OP_DEFINE_GLOBAL, global)
+}
+
+func resolveLocal(fc *funcCompiler, name string) int {
+	for i := len(fc.locals) - 1; i >= 0; i-- {
+		if fc.locals[i].name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func (c *Compiler) addUpvalue(fc *funcCompiler, index byte, isLocal bool, name *Token.Token) int {
+	for i, item := range fc.upvalues {
+		if item.index == index && item.isLocal == isLocal {
+			return i
+		}
+	}
+	if len(fc.upvalues) == uint8Count {
+		c.error(name, "Too many closure variables in function.")
+		return 0
+	}
+	fc.upvalues = append(fc.upvalues, upvalueRef{index: index, isLocal: isLocal})
+	return len(fc.upvalues) - 1
+}
+
+func (c *Compiler) resolveUpvalue(fc *funcCompiler, name *Token.Token) int {
+	if fc.enclosing == nil {
+		return -1
+	}
+	if index := resolveLocal(fc.enclosing, name.Lexeme); index != -1 {
+		fc.enclosing.locals[index].isCaptured = true
+		return c.addUpvalue(fc, byte(index), true, name)
+	}
+	if index := c.resolveUpvalue(fc.enclosing, name); index != -1 {
+		return c.addUpvalue(fc, byte(index), false, name)
+	}
+	return -1
+}
+
+func (c *Compiler) namedVariable(name *Token.Token, value Expr) {
+	getOp, setOp, arg := c.variableOps(name)
+	if value != nil {
+		c.compileExpr(value)
+		c.token = name
+		c.emitOpByte(setOp, byte(arg))
+	} else {
+		c.token = name
+		c.emitOpByte(getOp, byte(arg))
+	}
+}
+
+// variableOps 变量所在的位置, 以及读写它的指令
+func (c *Compiler) variableOps(name *Token.Token) (getOp, setOp OpCode, arg int) {
+	if arg = resolveLocal(c.current, name.Lexeme); arg != -1 {
+		return OP_GET_LOCAL, OP_SET_LOCAL, arg
+	}
+	if arg = c.resolveUpvalue(c.current, name); arg != -1 {
+		return OP_GET_UPVALUE, OP_SET_UPVALUE, arg
+	}
+	return OP_GET_GLOBAL, OP_SET_GLOBAL, int(c.identifierConstant(name))
+}
+
+// 函数体编译为一个新的 ObjFunction, 再在外层生成 OP_CLOSURE
+func (c *Compiler) function(stmt *FunctionStmt, kind FunctionType, className string) {
+	c.beginFunction(kind, stmt.name.Lexeme)
+	c.current.function.className = className
+	c.beginScope()
+	c.current.function.arity = len(stmt.params)
+	for _, param := range stmt.params {
+		c.declareVariable(param)
+		c.markInitialized()
+	}
+	for _, item := range stmt.body {
+		c.compileStmt(item)
+	}
+	upvalues := c.current.upvalues
+	function := c.endFunction()
+
+	c.token = stmt.name
+	c.emitOpByte(OP_CLOSURE, c.makeConstant(ObjValue(function)))
+	for _, item := range upvalues {
+		if item.isLocal {
+			c.emitByte(1)
+		} else {
+			c.emitByte(0)
+		}
+		c.emitByte(item.index)
+	}
+}
+
+// statement
+
+func (c *Compiler) VisitExpressionStmt(stmt Stmt) interface{} {
+	class := stmt.(*ExpressionStmt)
+	c.compileExpr(class.Expression)
+	c.emitOp(OP_POP)
+	return nil
+}
+
+func (c *Compiler) VisitPrintStmt(stmt Stmt) interface{} {
+	class := stmt.(*PrintStmt)
+	c.compileExpr(class.Expression)
+	c.emitOp(OP_PRINT)
+	return nil
+}
+
+func (c *Compiler) VisitVariableStmt(stmt Stmt) interface{} {
+	class := stmt.(*VariableStmt)
+	var global byte
+	if c.current.scopeDepth > 0 {
+		c.declareVariable(class.name)
+	} else {
+		global = c.identifierConstant(class.name)
+	}
+	if class.initializer != nil {
+		c.compileExpr(class.initializer)
+	} else {
+		c.token = class.name
+		c.emitOp(OP_NIL)
+	}
+	c.defineVariable(global)
+	return nil
+}
+
+// import 只出现在顶层, 模块作为全局变量定义
+func (c *Compiler) VisitImportStmt(stmt Stmt) interface{} {
+	class := stmt.(*ImportStmt)
+	name := c.identifierConstant(class.name)
+	c.token = class.path
+	path := c.makeConstant(ObjValue(class.path.Literal.(string)))
+	c.emitOpByte(OP_IMPORT, path)
+	c.emitByte(name)
+	c.defineVariable(name)
+	return nil
+}
+
+func (c *Compiler) VisitBlockStmt(stmt Stmt) interface{} {
+	class := stmt.(*BlockStmt)
+	c.beginScope()
+	for _, item := range class.statements {
+		c.compileStmt(item)
+	}
+	if class.rightBrace != nil {
+		c.token = class.rightBrace
+	}
+	c.endScope()
+	return nil
+}
+
+func (c *Compiler) VisitClassStmt(stmt Stmt) interface{} {
+	class := stmt.(*ClassStmt)
+	nameConstant := c.identifierConstant(class.name)
+	c.declareVariable(class.name)
+
+	c.emitOpByte(OP_CLASS, nameConstant)
+	c.defineVariable(nameConstant)
+
+	c.class = &classCompiler{enclosing: c.class}
+
+	if class.superClass != nil {
+		c.namedVariable(class.superClass.name, nil)
+		// super 保存在一个新作用域的局部变量中, 方法通过 upvalue 捕获
+		c.beginScope()
+		c.addLocal(Token.NewToken(Token.SUPER, "super", nil,
+			class.superClass.name.Line, class.superClass.name.Column, class.superClass.name.Offset))
+		c.defineVariable(0)
+
+		c.namedVariable(class.name, nil)
+		c.emitOp(OP_INHERIT)
+		c.class.hasSuperclass = true
+	}
+
+	c.namedVariable(class.name, nil)
+	for _, item := range class.methods {
+		method := item.(*FunctionStmt)
+		kind := METHOD
+		if method.name.Lexeme == "init" {
+			kind = ISINITIALIZER
+		}
+		c.function(method, kind, class.name.Lexeme)
+		c.emitOpByte(OP_METHOD, c.identifierConstant(method.name))
+	}
+	c.emitOp(OP_POP)
+
+	if c.class.hasSuperclass {
+		c.endScope()
+	}
+	c.class = c.class.enclosing
+	return nil
+}
+
+func (c *Compiler) VisitWhileStmt(stmt Stmt) interface{} {
+	class := stmt.(*WhileStmt)
+	loopStart := len(c.chunk().Code)
+	c.compileExpr(class.condition)
+
+	exitJump := c.emitJump(OP_JUMP_IF_FALSE)
+	c.emitOp(OP_POP)
+	loop := c.beginLoop()
+	c.compileStmt(class.body)
+	c.patchJumps(loop.continues)
+	c.emitLoop(loopStart)
+
+	c.patchJump(exitJump)
+	c.emitOp(OP_POP)
+	c.endLoop()
+	return nil
+}
+
+func (c *Compiler) VisitForStmt(stmt Stmt) interface{} {
+	class := stmt.(*ForStmt)
+	c.beginScope()
+	if class.initializer != nil {
+		c.compileStmt(class.initializer)
+	}
+	loopStart := len(c.chunk().Code)
+	exitJump := -1
+	if class.condition != nil {
+		c.compileExpr(class.condition)
+		exitJump = c.emitJump(OP_JUMP_IF_FALSE)
+		c.emitOp(OP_POP)
+	}
+	loop := c.beginLoop()
+	c.compileStmt(class.body)
+	// continue 跳转到 increment
+	c.patchJumps(loop.continues)
+	if class.increment != nil {
+		c.compileExpr(class.increment)
+		c.emitOp(OP_POP)
+	}
+	c.emitLoop(loopStart)
+
+	if exitJump != -1 {
+		c.patchJump(exitJump)
+		c.emitOp(OP_POP)
+	}
+	c.endLoop()
+	c.endScope()
+	return nil
+}
+
+func (c *Compiler) beginLoop() *loopCompiler {
+	loop := &loopCompiler{scopeDepth: c.current.scopeDepth}
+	c.current.loops = append(c.current.loops, loop)
+	return loop
+}
+
+// endLoop break 跳转到循环结束的位置
+func (c *Compiler) endLoop() {
+	loops := c.current.loops
+	c.patchJumps(loops[len(loops)-1].breaks)
+	c.current.loops = loops[:len(loops)-1]
+}
+
+func (c *Compiler) patchJumps(offsets []int) {
+	for _, offset := range offsets {
+		c.patchJump(offset)
+	}
+}
+
+// exitLoopScopes 弹出循环体中声明的局部变量, 编译器中的局部变量由 endScope 移除
+func (c *Compiler) exitLoopScopes(loop *loopCompiler) {
+	fc := c.current
+	for id := len(fc.locals) - 1; id >= 0 && fc.locals[id].depth > loop.scopeDepth; id-- {
+		if fc.locals[id].isCaptured {
+			c.emitOp(OP_CLOSE_UPVALUE)
+		} else {
+			c.emitOp(OP_POP)
+		}
+	}
+}
+
+func (c *Compiler) VisitBreakStmt(stmt Stmt) interface{} {
+	class := stmt.(*BreakStmt)
+	c.token = class.keyword
+	loop := c.current.loops[len(c.current.loops)-1]
+	c.exitTries(c.loopTries())
+	c.exitLoopScopes(loop)
+	loop.breaks = append(loop.breaks, c.emitJump(OP_JUMP))
+	return nil
+}
+
+func (c *Compiler) VisitContinueStmt(stmt Stmt) interface{} {
+	class := stmt.(*ContinueStmt)
+	c.token = class.keyword
+	loop := c.current.loops[len(c.current.loops)-1]
+	c.exitTries(c.loopTries())
+	c.exitLoopScopes(loop)
+	loop.continues = append(loop.continues, c.emitJump(OP_JUMP))
+	return nil
+}
+
+func (c *Compiler) VisitIfStmt(stmt Stmt) interface{} {
+	class := stmt.(*IfStmt)
+	c.compileExpr(class.condition)
+
+	thenJump := c.emitJump(OP_JUMP_IF_FALSE)
+	c.emitOp(OP_POP)
+	c.compileStmt(class.thenBranch)
+
+	elseJump := c.emitJump(OP_JUMP)
+	c.patchJump(thenJump)
+	c.emitOp(OP_POP)
+	if class.elseBranch != nil {
+		c.compileStmt(class.elseBranch)
+	}
+	c.patchJump(elseJump)
+	return nil
+}
+
+func (c *Compiler) VisitReturnStmt(stmt Stmt) interface{} {
+	class := stmt.(*ReturnStmt)
+	c.token = class.keyword
+	if class.value == nil {
+		c.exitTries(0)
+		c.emitReturn()
+		return nil
+	}
+	c.compileExpr(class.value)
+	c.token = class.keyword
+	if len(c.current.tries) == 0 {
+		c.emitOp(OP_RETURN)
+		return nil
+	}
+	// 返回值作为隐藏的局部变量留在栈上, finally 执行完之后回到栈顶
+	c.beginScope()
+	c.addHiddenLocal()
+	c.exitTries(0)
+	c.token = class.keyword
+	c.emitOp(OP_RETURN)
+	c.dropScope()
+	return nil
+}
+
+func (c *Compiler) VisitThrowStmt(stmt Stmt) interface{} {
+	class := stmt.(*ThrowStmt)
+	c.compileExpr(class.value)
+	c.token = class.keyword
+	c.emitOp(OP_THROW)
+	return nil
+}
+
+// VisitTryStmt 生成的代码:
+//
+//	OP_TRY handler; try 的块; OP_END_TRY; OP_JUMP normal
+//	handler: (栈顶是 catch 的值) catch 的块, 外面套一层 OP_TRY 以便出错时执行 finally; OP_JUMP normal
+//	rethrow: finally 的块; OP_THROW
+//	normal: finally 的块
+func (c *Compiler) VisitTryStmt(stmt Stmt) interface{} {
+	class := stmt.(*TryStmt)
+	locals := len(c.current.locals)
+	c.token = class.keyword
+	handler := c.emitJump(OP_TRY)
+	c.pushTry(class.finallyBody, locals)
+	c.compileStmt(class.body)
+	c.popTry()
+	c.token = class.body.rightBrace
+	c.emitOp(OP_END_TRY)
+	exits := []int{c.emitJump(OP_JUMP)}
+	c.patchJump(handler)
+
+	if class.catchBody == nil {
+		c.rethrow(class.finallyBody, 1)
+	} else {
+		c.beginScope()
+		c.addLocal(class.catchName)
+		c.markInitialized()
+		rethrow := -1
+		if class.finallyBody != nil {
+			rethrow = c.emitJump(OP_TRY)
+			c.pushTry(class.finallyBody, locals)
+		}
+		c.compileStmt(class.catchBody)
+		c.token = class.catchBody.rightBrace
+		if rethrow != -1 {
+			c.popTry()
+			c.emitOp(OP_END_TRY)
+		}
+		c.endScope()
+		if rethrow != -1 {
+			exits = append(exits, c.emitJump(OP_JUMP))
+			c.patchJump(rethrow)
+			// 栈上是 catch 的变量和新的错误
+			c.rethrow(class.finallyBody, 2)
+		}
+	}
+
+	c.patchJumps(exits)
+	if class.finallyBody != nil {
+		c.compileStmt(class.finallyBody)
+	}
+	return nil
+}
+
+// rethrow 出错时执行 finally 再重新抛出, 栈顶的 hidden 个值在 finally 中不可见
+func (c *Compiler) rethrow(finally *BlockStmt, hidden int) {
+	c.beginScope()
+	for k := 0; k < hidden; k++ {
+		c.addHiddenLocal()
+	}
+	c.compileStmt(finally)
+	c.token = finally.rightBrace
+	c.emitOp(OP_THROW)
+	c.dropScope()
+}
+
+func (c *Compiler) pushTry(finally *BlockStmt, locals int) {
+	fc := c.current
+	fc.tries = append(fc.tries, &tryCompiler{finally: finally, locals: locals, loops: len(fc.loops)})
+}
+
+func (c *Compiler) popTry() {
+	c.current.tries = c.current.tries[:len(c.current.tries)-1]
+}
+
+// loopTries 在最内层的循环中开始的第一个 try, break 和 continue 需要离开它和它里面的 try
+func (c *Compiler) loopTries() int {
+	fc := c.current
+	index := len(fc.tries)
+	for index > 0 && fc.tries[index-1].loops >= len(fc.loops) {
+		index--
+	}
+	return index
+}
+
+// exitTries 从内到外离开 tries[from:], 移除处理器并执行 finally
+// finally 中只能看到 try 之前的局部变量, 执行时外层的 try 仍然有效
+func (c *Compiler) exitTries(from int) {
+	fc := c.current
+	tries := fc.tries
+	token := c.token
+	for index := len(tries) - 1; index >= from; index-- {
+		c.token = token
+		c.emitOp(OP_END_TRY)
+		if tries[index].finally == nil {
+			continue
+		}
+		names := make([]string, len(fc.locals))
+		for id := tries[index].locals; id < len(fc.locals); id++ {
+			names[id], fc.locals[id].name = fc.locals[id].name, ""
+		}
+		fc.tries = tries[:index]
+		c.compileStmt(tries[index].finally)
+		for id := tries[index].locals; id < len(fc.locals); id++ {
+			fc.locals[id].name = names[id]
+		}
+	}
+	fc.tries = tries
+	c.token = token
+}
+
+// addHiddenLocal 编译器生成的局部变量, 没有名字, 不能被源码引用
+func (c *Compiler) addHiddenLocal() {
+	c.addLocal(Token.NewToken(Token.IDENTIFIER, "", nil, c.token.Line, c.token.Column, c.token.Offset))
+	c.markInitialized()
+}
+
+// dropScope 结束一个之后不会再执行到的作用域, 栈上的值已经由 OP_RETURN 或者 OP_THROW 丢弃
+func (c *Compiler) dropScope() {
+	fc := c.current
+	fc.scopeDepth--
+	for len(fc.locals) > 0 && fc.locals[len(fc.locals)-1].depth > fc.scopeDepth {
+		fc.locals = fc.locals[:len(fc.locals)-1]
+	}
+}
+
+func (c *Compiler) VisitFunctionStmt(stmt Stmt) interface{} {
+	class := stmt.(*FunctionStmt)
+	var global byte
+	if c.current.scopeDepth > 0 {
+		c.declareVariable(class.name)
+		// 函数可以递归引用自己
+		c.markInitialized()
+	} else {
+		global = c.identifierConstant(class.name)
+	}
+	c.function(class, FUNCTION, "")
+	c.defineVariable(global)
+	return nil
+}
+
+// expression
+
+// binaryOps 取模, 乘方和位运算, 每个运算符对应一条指令
+var binaryOps = map[Token.TokenType]OpCode{
+	Token.TILDE_SLASH:     OP_FLOOR_DIVIDE,
+	Token.PERCENT:         OP_MODULO,
+	Token.STAR_STAR:       OP_POWER,
+	Token.AMPERSAND:       OP_BIT_AND,
+	Token.PIPE:            OP_BIT_OR,
+	Token.CARET:           OP_BIT_XOR,
+	Token.LESS_LESS:       OP_SHIFT_LEFT,
+	Token.GREATER_GREATER: OP_SHIFT_RIGHT,
+}
+
+func (c *Compiler) VisitBinaryExpr(expr Expr) interface{} {
+	class := expr.(*BinaryExpr)
+	c.compileExpr(class.left)
+	c.compileExpr(class.right)
+	c.token = class.operator
+	c.binary(class.operator.TType)
+	return nil
+}
+
+// binary 二元运算 op 的指令, 两个操作数已经在栈上
+func (c *Compiler) binary(op Token.TokenType) {
+	switch op {
+	case Token.BANG_EQUAL:
+		c.emitOp(OP_EQUAL)
+		c.emitOp(OP_NOT)
+	case Token.EQUAL_EQUAL:
+		c.emitOp(OP_EQUAL)
+	case Token.GREATER:
+		c.emitOp(OP_GREATER)
+	case Token.GREATER_EQUAL:
+		c.emitOp(OP_LESS)
+		c.emitOp(OP_NOT)
+	case Token.LESS:
+		c.emitOp(OP_LESS)
+	case Token.LESS_EQUAL:
+		c.emitOp(OP_GREATER)
+		c.emitOp(OP_NOT)
+	case Token.PLUS:
+		c.emitOp(OP_ADD)
+	case Token.MINUS:
+		c.emitOp(OP_SUBTRACT)
+	case Token.STAR:
+		c.emitOp(OP_MULTIPLY)
+	case Token.SLASH:
+		c.emitOp(OP_DIVIDE)
+	case Token.INTERPOLATION:
+		c.emitOp(OP_CONCAT)
+	default:
+		code, ok := binaryOps[op]
+		if !ok {
+			c.error(c.token, "Unknown binary operator '"+c.token.Lexeme+"'.")
+			return
+		}
+		c.emitOp(code)
+	}
+}
+
+func (c *Compiler) VisitGroupingExpr(expr Expr) interface{} {
+	class := expr.(*GroupingExpr)
+	c.compileExpr(class.expression)
+	return nil
+}
+
+func (c *Compiler) VisitLiteralExpr(expr Expr) interface{} {
+	class := expr.(*LiteralExpr)
+	if class.token != nil {
+		c.token = class.token
+	}
+	switch value := class.value.(type) {
+	case nil:
+		c.emitOp(OP_NIL)
+	case bool:
+		if value {
+			c.emitOp(OP_TRUE)
+		} else {
+			c.emitOp(OP_FALSE)
+		}
+	default:
+		c.emitConstant(ValueOf(value))
+	}
+	return nil
+}
+
+func (c *Compiler) VisitUnaryExpr(expr Expr) interface{} {
+	class := expr.(*UnaryExpr)
+	c.compileExpr(class.right)
+	c.token = class.operator
+	switch class.operator.TType {
+	case Token.MINUS:
+		c.emitOp(OP_NEGATE)
+	case Token.BANG:
+		c.emitOp(OP_NOT)
+	case Token.TILDE:
+		c.emitOp(OP_BIT_NOT)
+	default:
+		c.error(class.operator, "Unknown unary operator '"+class.operator.Lexeme+"'.")
+	}
+	return nil
+}
+
+func (c *Compiler) VisitVariableExpr(expr Expr) interface{} {
+	class := expr.(*VariableExpr)
+	c.namedVariable(class.name, nil)
+	return nil
+}
+
+func (c *Compiler) VisitThisExpr(expr Expr) interface{} {
+	class := expr.(*ThisExpr)
+	c.namedVariable(class.keyword, nil)
+	return nil
+}
+
+func (c *Compiler) VisitSuperExpr(expr Expr) interface{} {
+	class := expr.(*SuperExpr)
+	name := c.identifierConstant(class.method)
+	c.namedVariable(thisToken(class.keyword), nil)
+	c.namedVariable(class.keyword, nil)
+	c.token = class.method
+	c.emitOpByte(OP_GET_SUPER, name)
+	return nil
+}
+
+// super 表达式中需要读取 this, 使用 super 的位置
+func thisToken(keyword *Token.Token) *Token.Token {
+	return Token.NewToken(Token.THIS, "this", nil, keyword.Line, keyword.Column, keyword.Offset)
+}
+
+func (c *Compiler) VisitGetExpr(expr Expr) interface{} {
+	class := expr.(*GetExpr)
+	c.compileExpr(class.object)
+	c.emitOpByte(OP_GET_PROPERTY, c.identifierConstant(class.name))
+	return nil
+}
+
+func (c *Compiler) VisitSetExpr(expr Expr) interface{} {
+	class := expr.(*SetExpr)
+	c.compileExpr(class.object)
+	if class.operator == nil {
+		c.compileExpr(class.value)
+		c.emitOpByte(OP_SET_PROPERTY, c.identifierConstant(class.name))
+		return nil
+	}
+	// 复制对象用来读取原来的值, 对象只求值一次
+	name := c.identifierConstant(class.name)
+	c.token = class.name
+	c.emitOpByte(OP_DUP, 0)
+	c.emitOpByte(OP_GET_PROPERTY, name)
+	if class.postfix {
+		// [object old] -> [old object old], 设置之后栈上剩下原来的值
+		c.emitOp(OP_SWAP)
+		c.emitOpByte(OP_DUP, 1)
+	}
+	c.compound(class.operator, class.value)
+	c.token = class.name
+	c.emitOpByte(OP_SET_PROPERTY, name)
+	if class.postfix {
+		c.emitOp(OP_POP)
+	}
+	return nil
+}
+
+// compound 复合赋值中计算新值, 原来的值已经在栈顶
+func (c *Compiler) compound(operator *Token.Token, value Expr) {
+	c.compileExpr(value)
+	c.token = operator
+	c.binary(compoundOps[operator.TType])
+}
+
+func (c *Compiler) VisitLogicExpr(expr Expr) interface{} {
+	class := expr.(*LogicExpr)
+	c.compileExpr(class.left)
+	c.token = class.operator
+	if class.operator.TType == Token.AND {
+		endJump := c.emitJump(OP_JUMP_IF_FALSE)
+		c.emitOp(OP_POP)
+		c.compileExpr(class.right)
+		c.patchJump(endJump)
+		return nil
+	}
+	elseJump := c.emitJump(OP_JUMP_IF_FALSE)
+	endJump := c.emitJump(OP_JUMP)
+	c.patchJump(elseJump)
+	c.emitOp(OP_POP)
+	c.compileExpr(class.right)
+	c.patchJump(endJump)
+	return nil
+}
+
+func (c *Compiler) VisitAssignmentExpr(expr Expr) interface{} {
+	class := expr.(*AssignmentExpr)
+	if class.operator == nil {
+		c.namedVariable(class.name, class.value)
+		return nil
+	}
+	getOp, setOp, arg := c.variableOps(class.name)
+	c.token = class.name
+	c.emitOpByte(getOp, byte(arg))
+	if class.postfix {
+		// 设置之后弹出新值, 栈上剩下原来的值
+		c.emitOpByte(OP_DUP, 0)
+	}
+	c.compound(class.operator, class.value)
+	c.token = class.name
+	c.emitOpByte(setOp, byte(arg))
+	if class.postfix {
+		c.emitOp(OP_POP)
+	}
+	return nil
+}
+
+func (c *Compiler) VisitCallExpr(expr Expr) interface{} {
+	class := expr.(*CallExpr)
+	// 方法调用直接使用 invoke, 避免创建 bound method
+	switch callee := class.callee.(type) {
+	case *GetExpr:
+		c.compileExpr(callee.object)
+		name := c.identifierConstant(callee.name)
+		c.arguments(class)
+		c.emitOpByte(OP_INVOKE, name)
+		c.emitByte(byte(len(class.arguments)))
+		return nil
+	case *SuperExpr:
+		name := c.identifierConstant(callee.method)
+		c.namedVariable(thisToken(callee.keyword), nil)
+		c.arguments(class)
+		c.namedVariable(callee.keyword, nil)
+		c.token = class.paren
+		c.emitOpByte(OP_SUPER_INVOKE, name)
+		c.emitByte(byte(len(class.arguments)))
+		return nil
+	}
+	c.compileExpr(class.callee)
+	c.arguments(class)
+	c.emitOpByte(OP_CALL, byte(len(class.arguments)))
+	return nil
+}
+
+func (c *Compiler) arguments(call *CallExpr) {
+	for _, item := range call.arguments {
+		c.compileExpr(item)
+	}
+	c.token = call.paren
+}
+
+func (c *Compiler) VisitListExpr(expr Expr) interface{} {
+	class := expr.(*ListExpr)
+	for _, item := range class.elements {
+		c.compileExpr(item)
+	}
+	c.token = class.bracket
+	c.emitOpByte(OP_LIST, byte(len(class.elements)))
+	return nil
+}
+
+func (c *Compiler) VisitMapExpr(expr Expr) interface{} {
+	class := expr.(*MapExpr)
+	for id := range class.keys {
+		c.compileExpr(class.keys[id])
+		c.compileExpr(class.values[id])
+	}
+	c.token = class.brace
+	c.emitOpByte(OP_MAP, byte(len(class.keys)))
+	return nil
+}
+
+func (c *Compiler) VisitIndexExpr(expr Expr) interface{} {
+	class := expr.(*IndexExpr)
+	c.compileExpr(class.object)
+	c.compileExpr(class.index)
+	c.token = class.bracket
+	c.emitOp(OP_GET_INDEX)
+	return nil
+}
+
+func (c *Compiler) VisitSetIndexExpr(expr Expr) interface{} {
+	class := expr.(*SetIndexExpr)
+	c.compileExpr(class.object)
+	c.compileExpr(class.index)
+	if class.operator == nil {
+		c.compileExpr(class.value)
+		c.token = class.bracket
+		c.emitOp(OP_SET_INDEX)
+		return nil
+	}
+	// 复制对象和下标用来读取原来的值, 它们只求值一次
+	c.token = class.bracket
+	c.emitOpByte(OP_DUP, 1)
+	c.emitOpByte(OP_DUP, 1)
+	c.emitOp(OP_GET_INDEX)
+	if class.postfix {
+		// [object index old] -> [object index old object index old]
+		for n := 0; n < 3; n++ {
+			c.emitOpByte(OP_DUP, 2)
+		}
+	}
+	c.compound(class.operator, class.value)
+	c.token = class.bracket
+	c.emitOp(OP_SET_INDEX)
+	if class.postfix {
+		// [object index old new] -> [old]
+		c.emitOp(OP_POP)
+		for n := 0; n < 2; n++ {
+			c.emitOp(OP_SWAP)
+			c.emitOp(OP_POP)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package Syntax
+
+import (
+	"errors"
+	"github.com/trueabc/lox/Errors"
+	"github.com/trueabc/lox/Token"
+)
+
+// ErrDebugStopped 调试器中止了程序的执行
+var ErrDebugStopped = errors.New("debugging stopped")
+
+// debugStop 钩子返回 false 时抛出, 在 protect 中转换为 ErrDebugStopped
+type debugStop struct{}
+
+// DebugHook 每个带有行号的语句执行之前调用, 返回 false 中止执行
+// stmt 是将要执行的语句, 同一行的循环再次执行同一个语句时可以据此区分
+// 钩子中可以使用 Depth, Environment 和 EvaluateInFrame 查看暂停时的状态
+type DebugHook func(i *Interpreter, stmt Stmt, line int) bool
+
+// SetDebugHook 设置调试钩子, lines 是语句所在的行, 来自 Parser.Lines
+// 不在 lines 中的语句 (例如 import 的模块中的语句) 不会触发钩子
+func (i *Interpreter) SetDebugHook(lines map[Stmt]int, hook DebugHook) {
+	i.lines = lines
+	i.debugHook = hook
+}
+
+// Depth 当前的调用深度, 顶层代码为 0
+func (i *Interpreter) Depth() int {
+	return len(i.frames)
+}
+
+// Environment 当前的作用域, 通过 Enclosing 可以访问闭包和 this 所在的外层作用域
+func (i *Interpreter) Environment() *Environment {
+	return i.env
+}
+
+// GlobalEnvironment 当前函数所在模块的全局作用域
+func (i *Interpreter) GlobalEnvironment() *Environment {
+	return i.global
+}
+
+// Backtrace 暂停在 line 时的调用栈, 最内层在前
+func (i *Interpreter) Backtrace(line int) []TraceLine {
+	return i.stackTrace(line)
+}
+
+// EvaluateInFrame 在暂停的位置计算 source 中的表达式, 可以使用局部变量, this 和 super
+// 出错时不会像 Evaluate 一样回到全局作用域, 程序可以继续执行
+func (i *Interpreter) EvaluateInFrame(source string) (value interface{}, err error) {
+	reporter := Errors.NewReporter("", source)
+	tokens := Token.NewScanner(source, reporter).ScanTokens()
+	expr := NewParser(tokens, reporter).ParseExpression()
+	if reporter.HadError() {
+		return nil, reporter.Diagnostics
+	}
+
+	// 作用域链除了全局作用域以外, 从外到内对应 Resolver 的 scopes
+	resolver := NewResolver(i, reporter)
+	for env := i.env; env != nil && env != i.global && env.Enclosing != nil; env = env.Enclosing {
+		scope := make(map[string]bool, len(env.VarValues))
+		for name := range env.VarValues {
+			scope[name] = true
+		}
+		if _, ok := env.VarValues["super"]; ok {
+			resolver.currentClass = SUBCLASS
+		} else if _, ok := env.VarValues["this"]; ok && resolver.currentClass == NoneClass {
+			resolver.currentClass = Class
+		}
+		resolver.scopes = append([]map[string]bool{scope}, resolver.scopes...)
+	}
+	resolver.currentFunction = FUNCTION
+	resolver.resolveExpr(expr)
+	if reporter.HadError() {
+		return nil, reporter.Diagnostics
+	}
+
+	// 表达式中调用的函数不再触发钩子
+	env, global, frames, hook := i.env, i.global, len(i.frames), i.debugHook
+	i.debugHook = nil
+	defer func() {
+		i.debugHook = hook
+		if r := recover(); r != nil {
+			runtimeErr, ok := r.(*RuntimeError)
+			if !ok {
+				panic(r)
+			}
+			err = runtimeErr
+			i.env, i.global, i.frames = env, global, i.frames[:frames]
+		}
+	}()
+	return i.evaluate(expr), nil
+}
@@ -23,7 +23,7 @@ func (ev *Environment) Get(token *Token.Token) interface{} {
 	} else if ev.Enclosing != nil {
 		return ev.Enclosing.Get(token)
 	}
-	panic(NewRuntimeError(token, "Undefined Var "+token.Lexeme+"."))
+	panic(NewRuntimeError(token, "Undefined variable '"+token.Lexeme+"'."))
 }
 
 func (ev *Environment) GetAt(dis int, token *Token.Token) interface{} {
@@ -51,7 +51,7 @@ func (ev *Environment) Assign(token *Token.Token, value interface{}) interface{}
 	} else if ev.Enclosing != nil {
 		return ev.Enclosing.Assign(token, value)
 	}
-	panic(NewRuntimeError(token, "Undefined var name "+token.Lexeme+"."))
+	panic(NewRuntimeError(token, "Undefined variable '"+token.Lexeme+"'."))
 }
 
 func (ev *Environment) AssignAt(dis int, token *Token.Token, value interface{}) interface{} {
@@ -20,6 +20,10 @@ type VisitorExpr interface {
 	VisitLogicExpr(logicexpr Expr) interface{}
 	VisitAssignmentExpr(assignmentexpr Expr) interface{}
 	VisitCallExpr(callexpr Expr) interface{}
+	VisitListExpr(listexpr Expr) interface{}
+	VisitMapExpr(mapexpr Expr) interface{}
+	VisitIndexExpr(indexexpr Expr) interface{}
+	VisitSetIndexExpr(setindexexpr Expr) interface{}
 }
 type BinaryExpr struct {
 	left     Expr
@@ -41,6 +45,7 @@ func (groupingexpr *GroupingExpr) Accept(visitor VisitorExpr) interface{} {
 
 type LiteralExpr struct {
 	value interface{}
+	token *Token.Token
 }
 
 func (literalexpr *LiteralExpr) Accept(visitor VisitorExpr) interface{} {
@@ -91,9 +96,11 @@ func (getexpr *GetExpr) Accept(visitor VisitorExpr) interface{} {
 }
 
 type SetExpr struct {
-	object Expr
-	name   *Token.Token
-	value  Expr
+	object   Expr
+	name     *Token.Token
+	value    Expr
+	operator *Token.Token
+	postfix  bool
 }
 
 func (setexpr *SetExpr) Accept(visitor VisitorExpr) interface{} {
@@ -111,8 +118,10 @@ func (logicexpr *LogicExpr) Accept(visitor VisitorExpr) interface{} {
 }
 
 type AssignmentExpr struct {
-	name  *Token.Token
-	value Expr
+	name     *Token.Token
+	value    Expr
+	operator *Token.Token
+	postfix  bool
 }
 
 func (assignmentexpr *AssignmentExpr) Accept(visitor VisitorExpr) interface{} {
@@ -128,3 +137,45 @@ type CallExpr struct {
 func (callexpr *CallExpr) Accept(visitor VisitorExpr) interface{} {
 	return visitor.VisitCallExpr(callexpr)
 }
+
+type ListExpr struct {
+	bracket  *Token.Token
+	elements []Expr
+}
+
+func (listexpr *ListExpr) Accept(visitor VisitorExpr) interface{} {
+	return visitor.VisitListExpr(listexpr)
+}
+
+type MapExpr struct {
+	brace  *Token.Token
+	keys   []Expr
+	values []Expr
+}
+
+func (mapexpr *MapExpr) Accept(visitor VisitorExpr) interface{} {
+	return visitor.VisitMapExpr(mapexpr)
+}
+
+type IndexExpr struct {
+	object  Expr
+	bracket *Token.Token
+	index   Expr
+}
+
+func (indexexpr *IndexExpr) Accept(visitor VisitorExpr) interface{} {
+	return visitor.VisitIndexExpr(indexexpr)
+}
+
+type SetIndexExpr struct {
+	object   Expr
+	bracket  *Token.Token
+	index    Expr
+	value    Expr
+	operator *Token.Token
+	postfix  bool
+}
+
+func (setindexexpr *SetIndexExpr) Accept(visitor VisitorExpr) interface{} {
+	return visitor.VisitSetIndexExpr(setindexexpr)
+}
@@ -0,0 +1,366 @@
+package Syntax
+
+import (
+	"github.com/trueabc/lox/Errors"
+	"github.com/trueabc/lox/Token"
+	"sort"
+	"strings"
+)
+
+// 每一层缩进两个空格, 与 lox-sample 中的代码一致
+const formatIndent = "  "
+
+// Formatter 把语法树重新输出为统一风格的源码, 类似 gofmt
+// 注释不在语法树中, 根据位置放在语句之前, 或者作为行尾注释跟在语句之后.
+// 表达式内部和语句头部 (例如 for 的括号中) 的注释无法保持原来的位置, 这时报告错误, 不输出结果.
+// 语句之间最多保留一个空行, 表达式内部的换行不保留.
+type Formatter struct {
+	builder  strings.Builder
+	reporter *Errors.Reporter
+	tokens   []*Token.Token
+	spans    map[Stmt]stmtSpan
+	comments []*Token.Token
+	next     int // 下一个还没有输出的注释
+	after    int // 已经输出到源码中的这个偏移, 在它之前的注释不能再输出
+	depth    int
+	line     int  // 最后输出的内容在源码中所在的行, 用来判断是否需要空行
+	open     bool // 刚刚输出了 '{', 块中的第一个语句之前不需要空行
+}
+
+// Format 解析 source 并输出格式化之后的源码, 语法错误返回 Errors.Diagnostics
+func Format(source, file string) (string, error) {
+	reporter := Errors.NewReporter(file, source)
+	scanner := Token.NewScanner(source, reporter)
+	tokens := scanner.ScanTokens()
+	parser := NewParser(tokens, reporter)
+	stmts := parser.Parse()
+	if reporter.HadError() {
+		return "", reporter.Diagnostics
+	}
+
+	f := &Formatter{reporter: reporter, tokens: tokens, spans: parser.spans, comments: scanner.Comments()}
+	f.stmts(stmts, tokens[len(tokens)-1], f.stmt)
+	if reporter.HadError() {
+		return "", reporter.Diagnostics
+	}
+	return f.builder.String(), nil
+}
+
+func (f *Formatter) write(text string) {
+	f.builder.WriteString(text)
+}
+
+func (f *Formatter) newLine() {
+	f.write("\n" + strings.Repeat(formatIndent, f.depth))
+}
+
+// startLine 开始输出源码中第 line 行的内容, 源码中有空行时保留一个空行
+func (f *Formatter) startLine(line int) {
+	if f.line != 0 && !f.open && line > f.line+1 {
+		f.write("\n")
+	}
+	f.open = false
+	f.write(strings.Repeat(formatIndent, f.depth))
+}
+
+// misplaced 报告 offset 之前还没有输出的注释, 它们在已经输出的语句或者表达式内部
+func (f *Formatter) misplaced(offset int) {
+	for f.next < len(f.comments) && f.comments[f.next].Offset < offset {
+		f.reporter.LoxError(f.comments[f.next], "Can't keep this comment in place, move it to its own line between statements.")
+		f.next++
+	}
+}
+
+// commentsBefore 输出 end 之前的所有注释, 每个注释单独一行
+func (f *Formatter) commentsBefore(end *Token.Token) {
+	f.misplaced(f.after)
+	for f.next < len(f.comments) && f.comments[f.next].Offset < end.Offset {
+		comment := f.comments[f.next]
+		f.startLine(comment.Line)
+		f.write(comment.Lexeme + "\n")
+		f.line = comment.Line
+		f.next++
+	}
+}
+
+// trailingComment 和 token 在同一行并且紧跟在 token 之后的注释作为行尾注释
+// 例如 init() { a(); } // 注释 属于方法, 而不是方法中的 a();
+func (f *Formatter) trailingComment(token *Token.Token) {
+	if f.next == len(f.comments) || f.comments[f.next].Line != token.Line {
+		return
+	}
+	index := sort.Search(len(f.tokens), func(id int) bool {
+		return f.tokens[id].Offset > token.Offset
+	})
+	if index == len(f.tokens) || f.tokens[index].Offset > f.comments[f.next].Offset {
+		f.write(" " + f.comments[f.next].Lexeme)
+		f.next++
+	}
+}
+
+// stmts 输出一组语句, end 是结束的 '}' 或者 EOF, 它之前的注释也属于这一组
+// 类的方法使用 f.method 输出, 其他情况使用 f.stmt
+func (f *Formatter) stmts(stmts []Stmt, end *Token.Token, emit func(Stmt)) {
+	for _, stmt := range stmts {
+		span := f.spans[stmt]
+		f.commentsBefore(span.first)
+		f.startLine(span.first.Line)
+		emit(stmt)
+		f.trailingComment(span.last)
+		f.write("\n")
+		f.line = span.last.Line
+		f.after = span.last.Offset
+	}
+	f.commentsBefore(end)
+}
+
+// block 输出 { ... }, open 和 end 是源码中的 '{' 和 '}', 没有语句和注释时输出 {}
+// '{' 之前还没有输出的注释在语句的头部, 由 commentsBefore 报告
+func (f *Formatter) block(open *Token.Token, stmts []Stmt, end *Token.Token, emit func(Stmt)) {
+	f.after = open.Offset
+	if len(stmts) == 0 && (f.next == len(f.comments) || f.comments[f.next].Offset > end.Offset) {
+		f.write("{}")
+		f.after = end.Offset
+		return
+	}
+	f.write("{\n")
+	f.open = true
+	f.depth++
+	f.stmts(stmts, end, emit)
+	f.depth--
+	f.open = false
+	f.write(strings.Repeat(formatIndent, f.depth) + "}")
+	f.after = end.Offset
+}
+
+// blockStmt 输出语句块, 范围记录在 spans 中
+func (f *Formatter) blockStmt(block *BlockStmt) {
+	f.block(f.spans[block].first, block.statements, block.rightBrace, f.stmt)
+}
+
+// leftBrace token 之后的第一个 '{', 用于函数和类的主体
+func (f *Formatter) leftBrace(token *Token.Token) *Token.Token {
+	index := f.tokenIndex(token)
+	for f.tokens[index].TType != Token.LEFT_BRACE {
+		index++
+	}
+	return f.tokens[index]
+}
+
+// tokenIndex token 在 tokens 中的下标
+func (f *Formatter) tokenIndex(token *Token.Token) int {
+	return sort.Search(len(f.tokens), func(id int) bool {
+		return f.tokens[id].Offset >= token.Offset
+	})
+}
+
+// body if, while 和 for 的循环体, 块和关键字在同一行, 其他语句换行并缩进
+// 头部和语句之间的注释保留在原来的位置: 同一行的作为头部的行尾注释, 其他的单独一行
+func (f *Formatter) body(stmt Stmt) {
+	if block, ok := stmt.(*BlockStmt); ok {
+		f.write(" ")
+		f.blockStmt(block)
+		return
+	}
+	first := f.spans[stmt].first
+	header := f.tokens[f.tokenIndex(first)-1]
+	f.misplaced(header.Offset)
+	f.depth++
+	f.trailingComment(header)
+	for f.next < len(f.comments) && f.comments[f.next].Offset < first.Offset {
+		f.newLine()
+		f.write(f.comments[f.next].Lexeme)
+		f.next++
+	}
+	f.newLine()
+	f.stmt(stmt)
+	f.depth--
+}
+
+func (f *Formatter) stmt(stmt Stmt) {
+	switch class := stmt.(type) {
+	case *ExpressionStmt:
+		f.write(f.expr(class.Expression) + ";")
+	case *PrintStmt:
+		f.write("print " + f.expr(class.Expression) + ";")
+	case *VariableStmt:
+		f.write("var " + class.name.Lexeme)
+		if class.initializer != nil {
+			f.write(" = " + f.expr(class.initializer))
+		}
+		f.write(";")
+	case *BlockStmt:
+		f.blockStmt(class)
+	case *ClassStmt:
+		f.write("class " + class.name.Lexeme)
+		if class.superClass != nil {
+			f.write(" < " + class.superClass.name.Lexeme)
+		}
+		f.write(" ")
+		f.block(f.leftBrace(class.name), class.methods, f.spans[class].last, f.method)
+	case *FunctionStmt:
+		f.write("fun ")
+		f.method(class)
+	case *IfStmt:
+		f.write("if (" + f.expr(class.condition) + ")")
+		f.body(class.thenBranch)
+		if class.elseBranch == nil {
+			return
+		}
+		// 例如 } // 注释, else 之前的行尾注释保留在原来的位置, else 换行
+		next := f.next
+		f.trailingComment(f.spans[class.thenBranch].last)
+		if _, ok := class.thenBranch.(*BlockStmt); ok && f.next == next {
+			f.write(" else")
+		} else {
+			f.newLine()
+			f.write("else")
+		}
+		// else if 保持在同一行
+		if _, ok := class.elseBranch.(*IfStmt); ok {
+			f.write(" ")
+			f.stmt(class.elseBranch)
+		} else {
+			f.body(class.elseBranch)
+		}
+	case *WhileStmt:
+		f.write("while (" + f.expr(class.condition) + ")")
+		f.body(class.body)
+	case *ForStmt:
+		f.write("for (")
+		switch initializer := class.initializer.(type) {
+		case nil:
+			f.write(";")
+		case *VariableStmt:
+			f.stmt(initializer)
+		case *ExpressionStmt:
+			f.write(f.expr(initializer.Expression) + ";")
+		}
+		if class.condition != nil {
+			f.write(" " + f.expr(class.condition))
+		}
+		f.write(";")
+		if class.increment != nil {
+			f.write(" " + f.expr(class.increment))
+		}
+		f.write(")")
+		f.body(class.body)
+	case *ReturnStmt:
+		f.write("return")
+		if class.value != nil {
+			f.write(" " + f.expr(class.value))
+		}
+		f.write(";")
+	case *ThrowStmt:
+		f.write("throw " + f.expr(class.value) + ";")
+	case *TryStmt:
+		f.write("try ")
+		f.blockStmt(class.body)
+		if class.catchBody != nil {
+			f.write(" catch (" + class.catchName.Lexeme + ") ")
+			f.blockStmt(class.catchBody)
+		}
+		if class.finallyBody != nil {
+			f.write(" finally ")
+			f.blockStmt(class.finallyBody)
+		}
+	case *BreakStmt:
+		f.write("break;")
+	case *ContinueStmt:
+		f.write("continue;")
+	case *ImportStmt:
+		// 省略名字时 name 是由 path 合成的
+		if class.name.Offset == class.path.Offset {
+			f.write("import " + class.path.Lexeme + ";")
+		} else {
+			f.write("import " + class.name.Lexeme + " from " + class.path.Lexeme + ";")
+		}
+	}
+}
+
+// method 函数和方法共用的部分, 从名字开始
+func (f *Formatter) method(method Stmt) {
+	stmt := method.(*FunctionStmt)
+	params := make([]string, len(stmt.params))
+	for id, param := range stmt.params {
+		params[id] = param.Lexeme
+	}
+	f.write(stmt.name.Lexeme + "(" + strings.Join(params, ", ") + ") ")
+	f.block(f.leftBrace(stmt.name), stmt.body, f.spans[stmt].last, f.stmt)
+}
+
+func (f *Formatter) exprs(exprs []Expr) string {
+	items := make([]string, len(exprs))
+	for id, item := range exprs {
+		items[id] = f.expr(item)
+	}
+	return strings.Join(items, ", ")
+}
+
+// assign 赋值和复合赋值, 自增自减不输出隐含的 1
+func (f *Formatter) assign(target string, value Expr, operator *Token.Token, postfix bool) string {
+	switch {
+	case operator == nil:
+		return target + " = " + f.expr(value)
+	case operator.TType != Token.PLUS_PLUS && operator.TType != Token.MINUS_MINUS:
+		return target + " " + operator.Lexeme + " " + f.expr(value)
+	case postfix:
+		return target + operator.Lexeme
+	}
+	return operator.Lexeme + target
+}
+
+func (f *Formatter) expr(expr Expr) string {
+	switch class := expr.(type) {
+	case *BinaryExpr:
+		// 插值字符串的每一部分都输出 lexeme, 它们已经包含了 ${ 和 }
+		if class.operator.TType == Token.INTERPOLATION {
+			return f.expr(class.left) + f.expr(class.right)
+		}
+		return f.expr(class.left) + " " + class.operator.Lexeme + " " + f.expr(class.right)
+	case *LogicExpr:
+		return f.expr(class.left) + " " + class.operator.Lexeme + " " + f.expr(class.right)
+	case *GroupingExpr:
+		return "(" + f.expr(class.expression) + ")"
+	case *LiteralExpr:
+		// 使用源码中的写法, 例如数字 1.0 和字符串中的换行
+		if class.token != nil {
+			return class.token.Lexeme
+		}
+		return Stringify(class.value)
+	case *UnaryExpr:
+		right := f.expr(class.right)
+		// - -a 不能输出为 --a
+		if strings.HasPrefix(right, class.operator.Lexeme) && class.operator.Lexeme != "!" {
+			return class.operator.Lexeme + " " + right
+		}
+		return class.operator.Lexeme + right
+	case *VariableExpr:
+		return class.name.Lexeme
+	case *ThisExpr:
+		return "this"
+	case *SuperExpr:
+		return "super." + class.method.Lexeme
+	case *GetExpr:
+		return f.expr(class.object) + "." + class.name.Lexeme
+	case *SetExpr:
+		return f.assign(f.expr(class.object)+"."+class.name.Lexeme, class.value, class.operator, class.postfix)
+	case *AssignmentExpr:
+		return f.assign(class.name.Lexeme, class.value, class.operator, class.postfix)
+	case *CallExpr:
+		return f.expr(class.callee) + "(" + f.exprs(class.arguments) + ")"
+	case *ListExpr:
+		return "[" + f.exprs(class.elements) + "]"
+	case *MapExpr:
+		entries := make([]string, len(class.keys))
+		for id := range class.keys {
+			entries[id] = f.expr(class.keys[id]) + ": " + f.expr(class.values[id])
+		}
+		return "{" + strings.Join(entries, ", ") + "}"
+	case *IndexExpr:
+		return f.expr(class.object) + "[" + f.expr(class.index) + "]"
+	case *SetIndexExpr:
+		return f.assign(f.expr(class.object)+"["+f.expr(class.index)+"]", class.value, class.operator, class.postfix)
+	}
+	return ""
+}
@@ -0,0 +1,182 @@
+package Syntax
+
+import (
+	"github.com/trueabc/lox/Errors"
+	"github.com/trueabc/lox/Token"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// 格式化之后再次格式化结果不变, 并且语法树和原来的源码一致
+func TestFormatIdempotent(t *testing.T) {
+	for _, root := range []string{"../lox-sample/test", "../Conformance/testdata"} {
+		err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() || filepath.Ext(path) != ".lox" {
+				return err
+			}
+			source, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			once, err := Format(string(source), path)
+			if err != nil {
+				// 有语法错误的用例不能格式化
+				return nil
+			}
+			twice, err := Format(once, path)
+			if err != nil {
+				t.Errorf("%s: formatted source does not parse: %v", path, err)
+				return nil
+			}
+			if once != twice {
+				t.Errorf("%s: formatting is not idempotent:\n%s\n---\n%s", path, once, twice)
+			}
+			if before, after := dumpAST(string(source)), dumpAST(once); before != after {
+				t.Errorf("%s: formatting changed the syntax tree:\n%s\n---\n%s", path, before, after)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func dumpAST(source string) string {
+	reporter := Errors.NewReporter("", source)
+	tokens := Token.NewScanner(source, reporter).ScanTokens()
+	return NewAstPrinter().PrintStmts(NewParser(tokens, reporter).Parse())
+}
+
+// 各个位置的注释都被保留, 并且顺序不变
+func TestFormatKeepsComments(t *testing.T) {
+	source := `// 文件开头的注释
+var a = 1; // 行尾注释
+
+// 空行之后的注释
+fun f(x) { // 函数头的注释
+  // 块中的注释
+  if (x) { return 1; } // if 的行尾注释
+  else {
+    // else 中的注释
+    return 2;
+  }
+  // 块结束之前的注释
+}
+
+class A {
+  // 方法之前的注释
+  init() { this.x = 1; } // 方法的行尾注释
+}
+
+while (a < 3) a = a + 1; // 循环的注释
+// 文件结尾的注释
+`
+	formatted, err := Format(source, "comments.lox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	comments := []string{
+		"// 文件开头的注释", "// 行尾注释", "// 空行之后的注释", "// 函数头的注释", "// 块中的注释",
+		"// if 的行尾注释", "// else 中的注释", "// 块结束之前的注释", "// 方法之前的注释",
+		"// 方法的行尾注释", "// 循环的注释", "// 文件结尾的注释",
+	}
+	rest := formatted
+	for _, comment := range comments {
+		if strings.Count(formatted, comment) != 1 {
+			t.Errorf("expected %q exactly once in:\n%s", comment, formatted)
+			continue
+		}
+		index := strings.Index(rest, comment)
+		if index < 0 {
+			t.Errorf("%q is out of order in:\n%s", comment, formatted)
+			continue
+		}
+		rest = rest[index+len(comment):]
+	}
+
+	// 行尾注释仍然跟在同一个语句之后
+	for _, line := range []string{"var a = 1; // 行尾注释", "  a = a + 1; // 循环的注释"} {
+		if !strings.Contains(formatted, line+"\n") {
+			t.Errorf("expected line %q in:\n%s", line, formatted)
+		}
+	}
+
+	again, err := Format(formatted, "comments.lox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != formatted {
+		t.Errorf("formatting with comments is not idempotent:\n%s\n---\n%s", formatted, again)
+	}
+}
+
+// 循环体和 else 不是块时, 头部之后的注释仍然在原来的位置
+func TestFormatKeepsCommentsAroundBodies(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{"while header", "while (a) // header\n  a = a - 1;\n",
+			"while (a) // header\n  a = a - 1;\n"},
+		{"comment on its own line before the body", "while (a)\n// body\na = a - 1;\n",
+			"while (a)\n  // body\n  a = a - 1;\n"},
+		{"if header", "if (a) // then\n  print 1;\n",
+			"if (a) // then\n  print 1;\n"},
+		{"for header", "for (;;) // forever\n  print 1;\n",
+			"for (;;) // forever\n  print 1;\n"},
+		{"else header", "if (a) print 1;\nelse // otherwise\n  print 2;\n",
+			"if (a)\n  print 1;\nelse // otherwise\n  print 2;\n"},
+		{"before else", "if (a) print 1; // one\nelse print 2;\n",
+			"if (a)\n  print 1; // one\nelse\n  print 2;\n"},
+		{"after a block before else", "if (a) { print 1; } // one\nelse { print 2; }\n",
+			"if (a) {\n  print 1;\n} // one\nelse {\n  print 2;\n}\n"},
+	}
+	for _, test := range tests {
+		got, err := Format(test.source, "body.lox")
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", test.name, got, test.want)
+		}
+		if again, _ := Format(got, "body.lox"); again != got {
+			t.Errorf("%s: not idempotent:\n%s\n---\n%s", test.name, got, again)
+		}
+	}
+}
+
+// 表达式和语句头部中的注释无法保持原来的位置, 格式化报告错误而不是移动它们
+func TestFormatRejectsMisplacedComments(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		line   int
+	}{
+		{"list literal", "var a = [1, // one\n  2];\n", 1},
+		{"map literal", "var a = {\n  \"a\": 1, // one\n  \"b\": 2\n};\n", 2},
+		{"call arguments", "print f(\n  1, // one\n  2);\n", 2},
+		{"while condition", "while (a // loop\n) a = a - 1;\n", 1},
+		{"if condition", "if (a // test\n) { print 1; }\n", 1},
+		{"for clauses", "for (var i = 0; // start\n  i < 3; i = i + 1) print i;\n", 1},
+		{"parameters", "fun f(a, // first\n  b) {}\n", 1},
+		{"class header", "class A // class\n{}\n", 1},
+		{"last statement in a block", "{\n  print [1, // one\n    2];\n}\n", 2},
+	}
+	for _, test := range tests {
+		got, err := Format(test.source, "misplaced.lox")
+		if err == nil {
+			t.Errorf("%s: expected an error, got\n%s", test.name, got)
+			continue
+		}
+		diagnostics, ok := err.(Errors.Diagnostics)
+		if !ok || len(diagnostics) != 1 || diagnostics[0].Line != test.line ||
+			!strings.HasPrefix(diagnostics[0].Where, " at '//") {
+			t.Errorf("%s: got %v, want one error for the comment on line %d", test.name, err, test.line)
+		}
+	}
+}
@@ -1,10 +1,12 @@
 package Syntax
 
 import (
+	"bufio"
 	"fmt"
 	"github.com/trueabc/lox/Errors"
-	"github.com/trueabc/lox/Logger"
 	"github.com/trueabc/lox/Token"
+	"io"
+	"os"
 )
 
 type Interpreter struct {
@@ -14,6 +16,27 @@ type Interpreter struct {
 	global *Environment
 
 	locals map[Expr]int
+
+	// print 的输出, 以及给 native 函数使用的错误输出
+	stdout io.Writer
+	stderr io.Writer
+	// io.readLine 读取的输入, 第一次读取时才包装 os.Stdin, 见 SetStdin
+	stdin *bufio.Reader
+
+	// 当前的调用栈, 出现运行时错误时用来生成 traceback
+	frames []CallFrame
+
+	// import 的模块缓存和加载状态
+	loader *moduleLoader
+	// 正在执行的代码所在文件的源码, 用来给运行时错误生成位置信息
+	// 调用函数时切换为定义函数的文件, 见 SetReporter
+	reporter *Errors.Reporter
+	// 宿主程序通过 RegisterNative 和 Define 添加的全局变量, import 的模块中同样可见
+	hosted map[string]interface{}
+
+	// 调试器的钩子, 在每个语句执行之前调用, 见 SetDebugHook
+	debugHook DebugHook
+	lines     map[Stmt]int
 }
 
 func (i *Interpreter) VisitSuperExpr(superexpr Expr) interface{} {
@@ -42,22 +65,107 @@ func (i *Interpreter) VisitSetExpr(setexpr Expr) interface{} {
 	class := setexpr.(*SetExpr)
 	obj := i.evaluate(class.object)
 	if _, ok := obj.(*LoxInstance); !ok {
-		Errors.LoxRuntimeError(class.name, "Only instances have fields.")
+		panic(NewRuntimeError(class.name, "Only instances have fields."))
 	}
 
+	if class.operator != nil {
+		updated, result := i.compound(class.operator, class.postfix, obj.(*LoxInstance).Get(class.name), class.value)
+		obj.(*LoxInstance).Set(class.name, updated)
+		return result
+	}
 	value := i.evaluate(class.value)
 	obj.(*LoxInstance).Set(class.name, value)
 	return value
 }
 
+// compound 复合赋值的新值 updated 和表达式的值 result, 后缀自增自减的值是原来的值
+func (i *Interpreter) compound(operator *Token.Token, postfix bool, old interface{}, value Expr) (updated, result interface{}) {
+	updated = i.binary(operator, compoundOps[operator.TType], old, i.evaluate(value))
+	if postfix {
+		return updated, old
+	}
+	return updated, updated
+}
+
 func (i *Interpreter) VisitGetExpr(getexpr Expr) interface{} {
 	class := getexpr.(*GetExpr)
 	value := i.evaluate(class.object)
 	if v, ok := value.(*LoxInstance); ok {
 		return v.Get(class.name)
 	}
-	Errors.LoxRuntimeError(class.name, "Only instances have properties.")
-	return nil
+	if v, ok := value.(*LoxList); ok {
+		return v.Get(class.name)
+	}
+	if v, ok := value.(*LoxMap); ok {
+		return v.Get(class.name)
+	}
+	if v, ok := value.(*LoxModule); ok {
+		return v.Get(class.name)
+	}
+	if v, ok := value.(*LoxError); ok {
+		return v.Get(class.name)
+	}
+	panic(NewRuntimeError(class.name, "Only instances have properties."))
+}
+
+func (i *Interpreter) VisitListExpr(listexpr Expr) interface{} {
+	class := listexpr.(*ListExpr)
+	elements := make([]interface{}, 0, len(class.elements))
+	for _, item := range class.elements {
+		elements = append(elements, i.evaluate(item))
+	}
+	return NewLoxList(elements)
+}
+
+func (i *Interpreter) VisitMapExpr(mapexpr Expr) interface{} {
+	class := mapexpr.(*MapExpr)
+	m := NewLoxMap()
+	for id := range class.keys {
+		key := i.evaluate(class.keys[id])
+		m.Put(key, i.evaluate(class.values[id]))
+	}
+	return m
+}
+
+func (i *Interpreter) VisitIndexExpr(indexexpr Expr) interface{} {
+	class := indexexpr.(*IndexExpr)
+	return i.getIndex(class.bracket, i.evaluate(class.object), i.evaluate(class.index))
+}
+
+func (i *Interpreter) getIndex(bracket *Token.Token, object, index interface{}) interface{} {
+	switch v := object.(type) {
+	case *LoxList:
+		return v.GetIndex(bracket, index)
+	case *LoxMap:
+		return v.GetIndex(bracket, index)
+	}
+	panic(NewRuntimeError(bracket, "Only lists and maps can be indexed."))
+}
+
+func (i *Interpreter) VisitSetIndexExpr(setindexexpr Expr) interface{} {
+	class := setindexexpr.(*SetIndexExpr)
+	object := i.evaluate(class.object)
+	index := i.evaluate(class.index)
+	if class.operator != nil {
+		updated, result := i.compound(class.operator, class.postfix, i.getIndex(class.bracket, object, index), class.value)
+		i.setIndex(class.bracket, object, index, updated)
+		return result
+	}
+	value := i.evaluate(class.value)
+	i.setIndex(class.bracket, object, index, value)
+	return value
+}
+
+func (i *Interpreter) setIndex(bracket *Token.Token, object, index, value interface{}) {
+	switch v := object.(type) {
+	case *LoxList:
+		v.SetIndex(bracket, index, value)
+		return
+	case *LoxMap:
+		v.Put(index, value)
+		return
+	}
+	panic(NewRuntimeError(bracket, "Only lists and maps can be indexed."))
 }
 
 func (i *Interpreter) VisitClassStmt(classstmt Stmt) interface{} {
@@ -67,7 +175,7 @@ func (i *Interpreter) VisitClassStmt(classstmt Stmt) interface{} {
 		superclass = i.evaluate(class.superClass)
 		if _, ok := superclass.(*LoxClass); !ok {
 			panic(NewRuntimeError(class.superClass.name, ""+
-				"SuperClass must be a class"))
+				"Superclass must be a class."))
 		}
 	}
 
@@ -81,6 +189,8 @@ func (i *Interpreter) VisitClassStmt(classstmt Stmt) interface{} {
 		fClass := item.(*FunctionStmt)
 		function := NewLoxFunction(fClass, i.env,
 			fClass.name.Lexeme == "init")
+		function.className = class.name.Lexeme
+		function.reporter = i.reporter
 		methods[fClass.name.Lexeme] = function
 	}
 	if superclass != nil {
@@ -108,6 +218,7 @@ func (i *Interpreter) VisitFunctionStmt(functionstmt Stmt) interface{} {
 	class := functionstmt.(*FunctionStmt)
 	// 这里捕获闭包, 函数声明阶段创建的内部变量
 	function := NewLoxFunction(class, i.env, false)
+	function.reporter = i.reporter
 	i.env.Define(class.name.Lexeme, function)
 	return nil
 }
@@ -123,23 +234,146 @@ func (i *Interpreter) VisitCallExpr(callexpr Expr) interface{} {
 	funCall, ok := callee.(LoxCallable)
 	if !ok {
 		panic(NewRuntimeError(class.paren, ""+
-			"can only call functions and classes."))
+			"Can only call functions and classes."))
 	}
-	if funCall.Arity() != len(args) {
+	if funCall.Arity() != Variadic && funCall.Arity() != len(args) {
 		panic(NewRuntimeError(class.paren,
-			fmt.Sprintf("Expected %d arguments. Got %d arguments", funCall.Arity(), len(args))))
+			fmt.Sprintf("Expected %d arguments but got %d.", funCall.Arity(), len(args))))
+	}
+	if native, ok := funCall.(*NativeFunction); ok {
+		result, err := native.function(i, args)
+		if err != nil {
+			panic(NewRuntimeError(class.paren, err.Error()))
+		}
+		return result
 	}
-	return funCall.Call(i, args)
+	i.pushFrame(funCall, class.paren)
+	// 出错时不出栈, 由 executeSingle 记录调用栈后清空
+	result := funCall.Call(i, args)
+	i.popFrame()
+	return result
 }
 
 func (i *Interpreter) VisitWhileStmt(whilestmt Stmt) interface{} {
 	class := whilestmt.(*WhileStmt)
 	for i.isTruthy(i.evaluate(class.condition)) {
+		if i.executeLoopBody(class.body) {
+			break
+		}
+	}
+	return nil
+}
+
+// VisitForStmt 初始化语句中的变量属于循环自己的作用域, 每次执行循环体之后对 increment 求值
+func (i *Interpreter) VisitForStmt(forstmt Stmt) interface{} {
+	class := forstmt.(*ForStmt)
+	previous := i.env
+	defer func() {
+		i.env = previous
+	}()
+	i.env = NewLocalEnvironment(previous)
+	if class.initializer != nil {
+		i.execute(class.initializer)
+	}
+	for class.condition == nil || i.isTruthy(i.evaluate(class.condition)) {
+		// continue 之后仍然执行 increment
+		if i.executeLoopBody(class.body) {
+			break
+		}
+		if class.increment != nil {
+			i.evaluate(class.increment)
+		}
+	}
+	return nil
+}
+
+func (i *Interpreter) VisitThrowStmt(stmt Stmt) interface{} {
+	class := stmt.(*ThrowStmt)
+	panic(newThrowError(class.keyword, i.evaluate(class.value), i.stackTrace))
+}
+
+// VisitTryStmt finally 在 defer 中执行, 无论 try 和 catch 是正常结束,
+// 抛出错误还是通过 return, break 和 continue 离开. finally 中新的错误或者跳转覆盖原来的
+func (i *Interpreter) VisitTryStmt(stmt Stmt) interface{} {
+	class := stmt.(*TryStmt)
+	env, depth := i.env, len(i.frames)
+	if class.finallyBody != nil {
+		defer func() {
+			r := recover()
+			if _, ok := r.(debugStop); ok {
+				// 调试器中止执行时不再执行 finally
+				panic(r)
+			}
+			if err, ok := r.(*RuntimeError); ok {
+				i.unwind(err, env, depth)
+			}
+			i.execute(class.finallyBody)
+			if r != nil {
+				panic(r)
+			}
+		}()
+	}
+	if class.catchBody == nil {
 		i.execute(class.body)
+		return nil
+	}
+	if err := i.tryBlock(class.body); err != nil {
+		i.unwind(err, env, depth)
+		catchEnv := NewLocalEnvironment(env)
+		catchEnv.Define(class.catchName.Lexeme, err.Caught())
+		i.executeBlock([]Stmt{class.catchBody}, catchEnv)
 	}
 	return nil
 }
 
+// tryBlock 执行 try 的块, 返回其中没有被捕获的运行时错误
+func (i *Interpreter) tryBlock(body *BlockStmt) (err *RuntimeError) {
+	defer func() {
+		if r := recover(); r != nil {
+			runtimeErr, ok := r.(*RuntimeError)
+			if !ok {
+				panic(r)
+			}
+			err = runtimeErr
+		}
+	}()
+	i.execute(body)
+	return nil
+}
+
+// unwind 记录错误发生时的调用栈, 然后回到 try 所在的作用域和调用深度
+func (i *Interpreter) unwind(err *RuntimeError, env *Environment, depth int) {
+	if err.Trace == nil {
+		err.Trace = i.stackTrace(err.Line())
+	}
+	attachDiagnostic(err, i.reporter)
+	i.env, i.frames = env, i.frames[:depth]
+}
+
+func (i *Interpreter) VisitBreakStmt(stmt Stmt) interface{} {
+	panic(loopJump{isBreak: true})
+}
+
+func (i *Interpreter) VisitContinueStmt(stmt Stmt) interface{} {
+	panic(loopJump{isBreak: false})
+}
+
+// executeLoopBody 执行一次循环体, 遇到 break 返回 true
+// 循环体中的块由 executeBlock 的 defer 恢复作用域
+func (i *Interpreter) executeLoopBody(body Stmt) (broke bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			jump, ok := r.(loopJump)
+			if !ok {
+				panic(r)
+			}
+			broke = jump.isBreak
+		}
+	}()
+	i.execute(body)
+	return false
+}
+
 func (i *Interpreter) VisitLogicExpr(logicexpr Expr) interface{} {
 	class := logicexpr.(*LogicExpr)
 	left := i.evaluate(class.left)
@@ -186,14 +420,20 @@ func (i *Interpreter) executeBlock(stmt []Stmt, environment *Environment) {
 
 func (i *Interpreter) VisitAssignmentExpr(assignment Expr) interface{} {
 	class := assignment.(*AssignmentExpr)
-	value := i.evaluate(class.value)
+	var value, result interface{}
+	if class.operator != nil {
+		value, result = i.compound(class.operator, class.postfix, i.lookupVariable(class.name, class), class.value)
+	} else {
+		value = i.evaluate(class.value)
+		result = value
+	}
 	if dis, ok := i.locals[class]; ok {
 		i.env.AssignAt(dis, class.name, value)
 	} else {
 		i.global.Assign(class.name, value)
 	}
 
-	return value
+	return result
 }
 
 func (i *Interpreter) VisitVariableStmt(variable Stmt) interface{} {
@@ -217,11 +457,16 @@ func (i *Interpreter) VisitExpressionStmt(expression Stmt) interface{} {
 func (i *Interpreter) VisitPrintStmt(print Stmt) interface{} {
 	class := print.(*PrintStmt)
 	value := i.evaluate(class.Expression)
-	fmt.Println(value)
+	fmt.Fprintln(i.stdout, Stringify(value))
 	return nil
 }
 
 func (i *Interpreter) execute(stmt Stmt) {
+	if i.debugHook != nil {
+		if line, ok := i.lines[stmt]; ok && !i.debugHook(i, stmt, line) {
+			panic(debugStop{})
+		}
+	}
 	stmt.Accept(i)
 }
 
@@ -229,32 +474,128 @@ func (i *Interpreter) resolve(expr Expr, depth int) {
 	i.locals[expr] = depth
 }
 
-func NewInterpreter() *Interpreter {
+func NewInterpreter(stdout, stderr io.Writer) *Interpreter {
 	global := NewEnvironment()
-	global.Define("clock", ClockFunc{})
-	return &Interpreter{env: global, global: global, locals: map[Expr]int{}}
+	defineNatives(global.Define)
+	return &Interpreter{env: global, global: global, locals: map[Expr]int{},
+		stdout: stdout, stderr: stderr, loader: newModuleLoader()}
+}
+
+// SetReporter 设置之后执行的代码的源码, 运行时错误在其中生成位置信息
+// 函数记录定义时的 reporter, 在其他文件或者 REPL 之后的输入中调用时仍然指向定义它的源码
+func (i *Interpreter) SetReporter(reporter *Errors.Reporter) {
+	i.reporter = reporter
+}
+
+// RegisterNative 只在这个解释器中定义 native 函数, 所有解释器共用的函数使用包级别的 RegisterNative
+func (i *Interpreter) RegisterNative(name string, arity int, function NativeFunc) {
+	i.Define(name, &NativeFunction{name: name, arity: arity, function: function})
+}
+
+// Define 在全局作用域定义变量, 用于宿主程序注入值
+func (i *Interpreter) Define(name string, value interface{}) {
+	if i.hosted == nil {
+		i.hosted = make(map[string]interface{})
+	}
+	i.hosted[name] = value
+	i.global.Define(name, value)
+}
+
+// moduleGlobals import 的模块的全局作用域, 包括注册表中的 native 和宿主程序添加的变量
+func (i *Interpreter) moduleGlobals() *Environment {
+	globals := NewEnvironment()
+	defineNatives(globals.Define)
+	for name, value := range i.hosted {
+		globals.Define(name, value)
+	}
+	return globals
+}
+
+// Global 读取全局变量
+func (i *Interpreter) Global(name string) (interface{}, bool) {
+	value, ok := i.global.VarValues[name]
+	return value, ok
 }
 
-func (i *Interpreter) Interpret(statements []Stmt) interface{} {
+// Globals 所有全局变量的副本
+func (i *Interpreter) Globals() map[string]interface{} {
+	globals := make(map[string]interface{}, len(i.global.VarValues))
+	for name, value := range i.global.VarValues {
+		globals[name] = value
+	}
+	return globals
+}
+
+func (i *Interpreter) Stdout() io.Writer {
+	return i.stdout
+}
+
+func (i *Interpreter) Stderr() io.Writer {
+	return i.stderr
+}
+
+// SetStdin 设置 io.readLine 读取的输入, 默认为 os.Stdin
+func (i *Interpreter) SetStdin(stdin io.Reader) {
+	i.stdin = bufio.NewReader(stdin)
+}
+
+func (i *Interpreter) Stdin() *bufio.Reader {
+	if i.stdin == nil {
+		i.stdin = bufio.NewReader(os.Stdin)
+	}
+	return i.stdin
+}
+
+// Interpret 执行语句, 遇到第一个运行时错误停止并返回
+func (i *Interpreter) Interpret(statements []Stmt) error {
 	for _, s := range statements {
-		i.executeSingle(s)
+		if err := i.executeSingle(s); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
-func (i *Interpreter) executeSingle(stmt Stmt) {
+// Evaluate 计算一个已经 resolve 过的表达式, 错误的处理与 Interpret 一致
+func (i *Interpreter) Evaluate(expr Expr) (value interface{}, err error) {
+	err = i.protect(func() {
+		value = i.evaluate(expr)
+	})
+	return value, err
+}
+
+func (i *Interpreter) executeSingle(stmt Stmt) error {
+	return i.protect(func() {
+		i.execute(stmt)
+	})
+}
+
+// protect 执行 run, 把运行时错误和模块的编译错误转换为返回值
+func (i *Interpreter) protect(run func()) (err error) {
 	defer func() {
 		if r := recover(); r != nil {
-			switch r.(type) {
+			switch e := r.(type) {
 			case *RuntimeError:
-				err := r.(*RuntimeError)
-				Errors.LoxRuntimeError(err.Token, err.Content)
+				if e.Trace == nil {
+					e.Trace = i.stackTrace(e.Line())
+				}
+				err = e
+			case Errors.Diagnostics:
+				// import 的模块中的编译错误
+				err = e
+			case debugStop:
+				err = ErrDebugStopped
+			default:
+				panic(r)
 			}
-			Logger.Errorf("%v", r)
+			// 出错时可能在函数或者block内部, 恢复到全局作用域
+			i.env = i.global
+			i.frames = i.frames[:0]
 		}
 	}()
-	i.execute(stmt)
+	run()
+	return nil
 }
 
 // expression计算结果 四类expression
@@ -263,17 +604,31 @@ func (i *Interpreter) VisitBinaryExpr(binary Expr) interface{} {
 	class := binary.(*BinaryExpr)
 	left := i.evaluate(class.left)
 	right := i.evaluate(class.right)
-	switch class.operator.TType {
+	return i.binary(class.operator, class.operator.TType, left, right)
+}
+
+// binary 计算二元运算 op, 错误报告在 operator 的位置, 复合赋值中 operator 是 += 或者 ++
+func (i *Interpreter) binary(operator *Token.Token, op Token.TokenType, left, right interface{}) interface{} {
+	switch op {
 	case Token.MINUS:
-		i.checkNumberOperands(class.operator, left, right)
+		i.checkNumberOperands(operator, left, right)
 		return left.(float64) - right.(float64)
 	case Token.STAR:
-		i.checkNumberOperands(class.operator, left, right)
+		i.checkNumberOperands(operator, left, right)
 		return left.(float64) * right.(float64)
-	case Token.SLASH:
-		// 分母为0
-		i.checkNumberOperands(class.operator, left, right)
-		return left.(float64) / right.(float64)
+	case Token.SLASH, Token.TILDE_SLASH, Token.PERCENT, Token.STAR_STAR, Token.AMPERSAND, Token.PIPE, Token.CARET,
+		Token.LESS_LESS, Token.GREATER_GREATER:
+		// 分母为0 时是运行时错误, 和字节码虚拟机共用 arithmetic
+		i.checkNumberOperands(operator, left, right)
+		code := OP_DIVIDE
+		if op != Token.SLASH {
+			code = binaryOps[op]
+		}
+		result, message := arithmetic(code, left.(float64), right.(float64))
+		if message != "" {
+			panic(NewRuntimeError(operator, message))
+		}
+		return result
 	case Token.PLUS:
 		// 字符串拼接和数字相加
 		l1, ok1 := left.(float64)
@@ -286,20 +641,23 @@ func (i *Interpreter) VisitBinaryExpr(binary Expr) interface{} {
 		if ok1 && ok2 {
 			return s1 + s2
 		}
-		panic(NewRuntimeError(class.operator, "Operands must be two numbers or strings."))
+		panic(NewRuntimeError(operator, "Operands must be two numbers or two strings."))
 	case Token.GREATER:
-		i.checkNumberOperands(class.operator, left, right)
+		i.checkNumberOperands(operator, left, right)
 		return left.(float64) > right.(float64)
 	case Token.GREATER_EQUAL:
-		i.checkNumberOperands(class.operator, left, right)
+		i.checkNumberOperands(operator, left, right)
 		return left.(float64) >= right.(float64)
 	case Token.LESS:
-		i.checkNumberOperands(class.operator, left, right)
+		i.checkNumberOperands(operator, left, right)
 		return left.(float64) < right.(float64)
 	case Token.LESS_EQUAL:
-		i.checkNumberOperands(class.operator, left, right)
+		i.checkNumberOperands(operator, left, right)
 		return left.(float64) <= right.(float64)
 
+	case Token.INTERPOLATION:
+		// 字符串插值, 两边转换为 print 输出的字符串之后拼接
+		return Stringify(left) + Stringify(right)
 	case Token.BANG_EQUAL:
 		return !i.isEqual(left, right)
 	case Token.EQUAL_EQUAL:
@@ -328,6 +686,13 @@ func (i *Interpreter) VisitUnaryExpr(unary Expr) interface{} {
 		return -(right.(float64))
 	case Token.BANG:
 		return !i.isTruthy(right)
+	case Token.TILDE:
+		i.checkNumberOperand(class.operator, right)
+		n, ok := toInteger(right.(float64))
+		if !ok {
+			panic(NewRuntimeError(class.operator, errIntegerOperand))
+		}
+		return float64(^n)
 	}
 	return nil
 }
@@ -361,6 +726,24 @@ func (i *Interpreter) isTruthy(value interface{}) bool {
 	return true
 }
 
+// Stringify print 输出的格式, 列表中的元素使用同样的格式
+func Stringify(value interface{}) string {
+	return stringify(value, nil)
+}
+
+// stringify printing 记录正在输出的列表和字典, 包含自身时输出 [...] 或者 {...}, 不会无限递归
+func stringify(value interface{}, printing map[interface{}]bool) string {
+	switch v := value.(type) {
+	case nil:
+		return "nil"
+	case *LoxList:
+		return v.format(printing)
+	case *LoxMap:
+		return v.format(printing)
+	}
+	return fmt.Sprint(value)
+}
+
 func (i *Interpreter) isEqual(left, right interface{}) bool {
 	if left == nil && right == nil {
 		return true
@@ -376,7 +759,7 @@ func (i *Interpreter) checkNumberOperand(operator *Token.Token, operand interfac
 	case float64:
 		return
 	default:
-		panic(NewRuntimeError(operator, "operand must be number. "))
+		panic(NewRuntimeError(operator, "Operand must be a number."))
 	}
 }
 
@@ -386,22 +769,39 @@ func (i *Interpreter) checkNumberOperands(operator *Token.Token, left, right int
 	if ok1 && ok2 {
 		return
 	}
-	panic(NewRuntimeError(operator, "operand must be number."))
+	panic(NewRuntimeError(operator, "Operands must be numbers."))
 }
 
 type RuntimeError struct {
 	Token   *Token.Token
 	Content string
+
+	// 由调用方根据源码补充的位置信息, 可能为 nil
+	Diagnostic *Errors.Diagnostic
+	// 出错时的调用栈, 最内层在前
+	Trace []TraceLine
+	// throw 抛出的值, 只有 throw 产生的错误 Thrown 为 true, 见 Caught
+	Value  interface{}
+	Thrown bool
 }
 
 func (re *RuntimeError) Error() string {
 	return re.Content
 }
 
+func (re *RuntimeError) Line() int {
+	return re.Token.Line
+}
+
 func NewRuntimeError(token *Token.Token, content string) *RuntimeError {
 	return &RuntimeError{Token: token, Content: content}
 }
 
+// loopJump break 和 continue 作为 panic 跳出循环体, Resolver 保证它们不会离开函数
+type loopJump struct {
+	isBreak bool
+}
+
 // ReturnObj return 作为panic跳出内部
 type ReturnObj struct {
 	Value interface{}
@@ -0,0 +1,255 @@
+package Syntax
+
+import (
+	"github.com/trueabc/lox/Errors"
+	"github.com/trueabc/lox/Token"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// lint 警告的代码, 在同一行或者上一行写 // lox:ignore CODE 可以忽略, 多个代码用逗号分隔
+const (
+	LintUnusedLocal = "unused-local"
+	LintUnusedParam = "unused-param"
+	LintUnreachable = "unreachable"
+	LintShadow      = "shadow"
+	LintUndefined   = "undefined-global"
+	LintSelfAssign  = "self-assign"
+)
+
+const ignoreDirective = "lox:ignore"
+
+// linter 在 Resolver 记录的符号和语法树上做静态检查, 发现的问题都是警告
+type linter struct {
+	analysis *Analysis
+	warnings Errors.Diagnostics
+}
+
+// Lint 返回所有没有被 lox:ignore 忽略的警告, 按位置排序
+// 以 _ 开头的局部变量和参数不检查是否使用
+func (a *Analysis) Lint() Errors.Diagnostics {
+	l := &linter{analysis: a}
+	l.unused()
+	l.shadowed(a.Root)
+	for _, name := range a.Unresolved {
+		l.warn(name, LintUndefined, "Undefined variable '"+name.Lexeme+"'.")
+	}
+	l.stmts(a.Stmts)
+
+	warnings := l.ignore()
+	sort.SliceStable(warnings, func(i, j int) bool {
+		return warnings[i].Span.Start < warnings[j].Span.Start
+	})
+	return warnings
+}
+
+func (l *linter) warn(token *Token.Token, code, message string) {
+	diagnostic := l.analysis.reporter.NewDiagnostic(token, Errors.SeverityWarning, " at '"+token.Lexeme+"'", message)
+	diagnostic.Code = code
+	l.warnings = append(l.warnings, diagnostic)
+}
+
+func (l *linter) unused() {
+	for _, symbol := range l.analysis.Symbols {
+		name := symbol.Name.Lexeme
+		// 只被赋值, 从来没有读取的变量同样没有用
+		if symbol.Global || len(symbol.References) != 0 || strings.HasPrefix(name, "_") {
+			continue
+		}
+		switch symbol.Kind {
+		case SymbolVariable:
+			l.warn(symbol.Name, LintUnusedLocal, "Local variable '"+name+"' is never used.")
+		case SymbolFunction:
+			l.warn(symbol.Name, LintUnusedLocal, "Local function '"+name+"' is never used.")
+		case SymbolClass:
+			l.warn(symbol.Name, LintUnusedLocal, "Local class '"+name+"' is never used.")
+		case SymbolParameter:
+			l.warn(symbol.Name, LintUnusedParam, "Parameter '"+name+"' is never used.")
+		}
+	}
+}
+
+// shadowed 局部的声明和外层作用域中的声明同名, 外层的局部变量需要在它之前声明
+func (l *linter) shadowed(scope *Scope) {
+	for _, child := range scope.Children {
+		for _, symbol := range child.Symbols {
+			for outer := scope; outer != nil; outer = outer.Parent {
+				shadow, ok := outer.names[symbol.Name.Lexeme]
+				if ok && (shadow.Global || shadow.Name.Offset < symbol.Name.Offset) {
+					l.warn(symbol.Name, LintShadow, "'"+symbol.Name.Lexeme+"' shadows the declaration on line "+
+						strconv.Itoa(shadow.Name.Line)+".")
+					break
+				}
+			}
+		}
+		l.shadowed(child)
+	}
+}
+
+// ignore 去掉被 lox:ignore 注释忽略的警告, 注释对所在的行和下一行有效, 不写代码时忽略所有警告
+func (l *linter) ignore() Errors.Diagnostics {
+	ignored := make(map[int][]string)
+	for _, comment := range l.analysis.Comments {
+		text := strings.TrimSpace(strings.TrimPrefix(comment.Lexeme, "//"))
+		if !strings.HasPrefix(text, ignoreDirective) {
+			continue
+		}
+		codes := strings.FieldsFunc(strings.TrimPrefix(text, ignoreDirective), func(r rune) bool {
+			return r == ',' || r == ' ' || r == '\t'
+		})
+		if len(codes) == 0 {
+			codes = []string{"*"}
+		}
+		ignored[comment.Line] = append(ignored[comment.Line], codes...)
+		ignored[comment.Line+1] = append(ignored[comment.Line+1], codes...)
+	}
+
+	warnings := make(Errors.Diagnostics, 0, len(l.warnings))
+	for _, warning := range l.warnings {
+		keep := true
+		for _, code := range ignored[warning.Line] {
+			if code == "*" || code == warning.Code {
+				keep = false
+			}
+		}
+		if keep {
+			warnings = append(warnings, warning)
+		}
+	}
+	return warnings
+}
+
+// stmts 同一组语句中 return, break, continue 和 throw 之后的语句不会执行, 每组只报告第一个
+func (l *linter) stmts(stmts []Stmt) {
+	for id, stmt := range stmts {
+		l.stmt(stmt)
+		if keyword := jumpKeyword(stmt); keyword != nil && id+1 < len(stmts) {
+			if span, ok := l.analysis.spans[stmts[id+1]]; ok {
+				l.warn(span.first, LintUnreachable, "Unreachable code after '"+keyword.Lexeme+"'.")
+			}
+			return
+		}
+	}
+}
+
+// jumpKeyword 离开当前语句组的语句的关键字, 其他语句返回 nil
+func jumpKeyword(stmt Stmt) *Token.Token {
+	switch class := stmt.(type) {
+	case *ReturnStmt:
+		return class.keyword
+	case *BreakStmt:
+		return class.keyword
+	case *ContinueStmt:
+		return class.keyword
+	case *ThrowStmt:
+		return class.keyword
+	}
+	return nil
+}
+
+func (l *linter) stmt(stmt Stmt) {
+	switch class := stmt.(type) {
+	case *ExpressionStmt:
+		l.expr(class.Expression)
+	case *PrintStmt:
+		l.expr(class.Expression)
+	case *VariableStmt:
+		l.expr(class.initializer)
+	case *BlockStmt:
+		l.stmts(class.statements)
+	case *ClassStmt:
+		for _, method := range class.methods {
+			l.stmt(method)
+		}
+	case *FunctionStmt:
+		l.stmts(class.body)
+	case *IfStmt:
+		l.expr(class.condition)
+		l.stmt(class.thenBranch)
+		if class.elseBranch != nil {
+			l.stmt(class.elseBranch)
+		}
+	case *WhileStmt:
+		l.expr(class.condition)
+		l.stmt(class.body)
+	case *ForStmt:
+		if class.initializer != nil {
+			l.stmt(class.initializer)
+		}
+		l.expr(class.condition)
+		l.expr(class.increment)
+		l.stmt(class.body)
+	case *ReturnStmt:
+		l.expr(class.value)
+	case *ThrowStmt:
+		l.expr(class.value)
+	case *TryStmt:
+		l.stmt(class.body)
+		if class.catchBody != nil {
+			l.stmt(class.catchBody)
+		}
+		if class.finallyBody != nil {
+			l.stmt(class.finallyBody)
+		}
+	}
+}
+
+func (l *linter) exprs(exprs []Expr) {
+	for _, item := range exprs {
+		l.expr(item)
+	}
+}
+
+func (l *linter) expr(expr Expr) {
+	switch class := expr.(type) {
+	case *BinaryExpr:
+		l.exprs([]Expr{class.left, class.right})
+	case *LogicExpr:
+		l.exprs([]Expr{class.left, class.right})
+	case *GroupingExpr:
+		l.expr(class.expression)
+	case *UnaryExpr:
+		l.expr(class.right)
+	case *GetExpr:
+		l.expr(class.object)
+	case *SetExpr:
+		if get, ok := class.value.(*GetExpr); ok && class.operator == nil && get.name.Lexeme == class.name.Lexeme &&
+			l.sameObject(class.object, get.object) {
+			l.warn(class.name, LintSelfAssign, "Property '"+class.name.Lexeme+"' is assigned to itself.")
+		}
+		l.exprs([]Expr{class.object, class.value})
+	case *AssignmentExpr:
+		if variable, ok := class.value.(*VariableExpr); ok && class.operator == nil && variable.name.Lexeme == class.name.Lexeme &&
+			l.analysis.uses[variable.name] == l.analysis.uses[class.name] {
+			l.warn(class.name, LintSelfAssign, "Variable '"+class.name.Lexeme+"' is assigned to itself.")
+		}
+		l.expr(class.value)
+	case *CallExpr:
+		l.expr(class.callee)
+		l.exprs(class.arguments)
+	case *ListExpr:
+		l.exprs(class.elements)
+	case *MapExpr:
+		l.exprs(class.keys)
+		l.exprs(class.values)
+	case *IndexExpr:
+		l.exprs([]Expr{class.object, class.index})
+	case *SetIndexExpr:
+		l.exprs([]Expr{class.object, class.index, class.value})
+	}
+}
+
+// sameObject 两个表达式是否一定是同一个对象, 只判断 this 和同一个变量
+func (l *linter) sameObject(a, b Expr) bool {
+	switch left := a.(type) {
+	case *ThisExpr:
+		_, ok := b.(*ThisExpr)
+		return ok
+	case *VariableExpr:
+		right, ok := b.(*VariableExpr)
+		return ok && left.name.Lexeme == right.name.Lexeme &&
+			l.analysis.uses[left.name] == l.analysis.uses[right.name]
+	}
+	return false
+}
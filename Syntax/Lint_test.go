@@ -0,0 +1,102 @@
+package Syntax
+
+import (
+	"github.com/trueabc/lox/Errors"
+	"strings"
+	"testing"
+)
+
+func lint(t *testing.T, source string) Errors.Diagnostics {
+	analysis := Analyze(source, "lint.lox")
+	if len(analysis.Diagnostics) != 0 {
+		t.Fatalf("unexpected errors in %q: %v", source, analysis.Diagnostics)
+	}
+	return analysis.Lint()
+}
+
+// 每个代码一个触发警告的源码, 以及用 lox:ignore 忽略之后的源码
+func TestLintCodes(t *testing.T) {
+	tests := []struct {
+		code     string
+		source   string
+		line     int
+		message  string
+		suppress string
+	}{
+		{LintUnusedLocal, "fun f() {\n  var a = 1;\n}\nf();\n", 2, "Local variable 'a' is never used.",
+			"fun f() {\n  var a = 1; // lox:ignore unused-local\n}\nf();\n"},
+		{LintUnusedLocal, "{\n  fun g() {}\n}\n", 2, "Local function 'g' is never used.",
+			"{\n  // lox:ignore unused-local\n  fun g() {}\n}\n"},
+		{LintUnusedLocal, "{\n  class A {}\n}\n", 2, "Local class 'A' is never used.",
+			"{\n  class A {} // lox:ignore unused-local\n}\n"},
+		{LintUnusedLocal, "{\n  var w;\n  w = 1;\n}\n", 2, "Local variable 'w' is never used.",
+			"{\n  var w; // lox:ignore unused-local\n  w = 1;\n}\n"},
+		{LintUnusedParam, "fun f(x) {\n  return 1;\n}\nf(1);\n", 1, "Parameter 'x' is never used.",
+			"// lox:ignore unused-param\nfun f(x) {\n  return 1;\n}\nf(1);\n"},
+		{LintUnreachable, "fun f() {\n  return 1;\n  print 2;\n}\nf();\n", 3, "Unreachable code after 'return'.",
+			"fun f() {\n  return 1;\n  print 2; // lox:ignore unreachable\n}\nf();\n"},
+		{LintUnreachable, "while (true) {\n  break;\n  print 1;\n}\n", 3, "Unreachable code after 'break'.",
+			"while (true) {\n  break;\n  // lox:ignore unreachable\n  print 1;\n}\n"},
+		{LintShadow, "var a = 1;\n{\n  var a = 2;\n  print a;\n}\n", 3, "'a' shadows the declaration on line 1.",
+			"var a = 1;\n{\n  var a = 2; // lox:ignore shadow\n  print a;\n}\n"},
+		{LintUndefined, "print b;\n", 1, "Undefined variable 'b'.",
+			"print b; // lox:ignore undefined-global\n"},
+		{LintSelfAssign, "var a = 1;\na = a;\n", 2, "Variable 'a' is assigned to itself.",
+			"var a = 1;\na = a; // lox:ignore self-assign\n"},
+		{LintSelfAssign, "class A {\n  init() {\n    this.x = this.x;\n  }\n}\n", 3, "Property 'x' is assigned to itself.",
+			"class A {\n  init() {\n    this.x = this.x; // lox:ignore self-assign\n  }\n}\n"},
+	}
+	for _, test := range tests {
+		warnings := lint(t, test.source)
+		if len(warnings) != 1 {
+			t.Errorf("%s: expected one warning for %q, got %v", test.code, test.source, warnings)
+			continue
+		}
+		w := warnings[0]
+		if w.Code != test.code || w.Line != test.line || w.Message != test.message ||
+			w.Severity != Errors.SeverityWarning {
+			t.Errorf("%s: got %s warning on line %d: %q", test.code, w.Code, w.Line, w.Message)
+		}
+		if warnings := lint(t, test.suppress); len(warnings) != 0 {
+			t.Errorf("%s: expected %q to suppress the warning, got %v", test.code, test.suppress, warnings)
+		}
+	}
+}
+
+// 读取变量, 包括复合赋值和自增, 都算作使用
+func TestLintReadsAfterWrites(t *testing.T) {
+	for _, source := range []string{
+		"{\n  var w;\n  w = 1;\n  print w;\n}\n",
+		"{\n  var w = 0;\n  w += 1;\n}\n",
+		"{\n  var w = 0;\n  w++;\n}\n",
+	} {
+		if warnings := lint(t, source); len(warnings) != 0 {
+			t.Errorf("%q: expected no warnings, got %v", source, warnings)
+		}
+	}
+}
+
+// 注释对所在的行和下一行有效, 其他代码不会忽略警告, 不写代码时忽略所有警告, 多个代码用逗号分隔
+func TestLintIgnore(t *testing.T) {
+	tests := []struct {
+		source string
+		codes  []string
+	}{
+		{"fun f(x) {\n  var y = 1;\n}\nf(1);\n", []string{LintUnusedParam, LintUnusedLocal}},
+		{"fun f(x) { // lox:ignore shadow\n  var y = 1;\n}\nf(1);\n", []string{LintUnusedParam, LintUnusedLocal}},
+		{"fun f(x) { // lox:ignore unused-local\n  var y = 1;\n}\nf(1);\n", []string{LintUnusedParam}},
+		{"fun f(x) { // lox:ignore\n  var y = 1;\n}\nf(1);\n", []string{}},
+		{"// lox:ignore\nfun f(x) {\n  var y = 1;\n}\nf(1);\n", []string{LintUnusedLocal}},
+		{"fun f(x) {\n  var y = 1; // lox:ignore unused-param, unused-local\n}\nf(1);\n", []string{LintUnusedParam}},
+		{"fun f(x) { // lox:ignore unused-param,unused-local\n  var y = 1;\n}\nf(1);\n", []string{}},
+	}
+	for _, test := range tests {
+		codes := make([]string, 0)
+		for _, w := range lint(t, test.source) {
+			codes = append(codes, w.Code)
+		}
+		if strings.Join(codes, " ") != strings.Join(test.codes, " ") {
+			t.Errorf("%q: got warnings %v, want %v", test.source, codes, test.codes)
+		}
+	}
+}
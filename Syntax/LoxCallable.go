@@ -1,27 +1,33 @@
 package Syntax
 
-import (
-	"time"
-)
+import "github.com/trueabc/lox/Errors"
 
 type LoxCallable interface {
 	Arity() int
 	Call(interpreter *Interpreter, args []interface{}) interface{}
 }
 
-// ClockFunc Native Function
-type ClockFunc struct {
+// NativeFunction 用 go 实现的函数, 返回的 error 在调用处转换为运行时错误
+type NativeFunction struct {
+	name     string
+	arity    int
+	function func(interpreter *Interpreter, args []interface{}) (interface{}, error)
 }
 
-func (c ClockFunc) Arity() int {
-	return 0
+func (n *NativeFunction) Arity() int {
+	return n.arity
 }
 
-func (c ClockFunc) Call(interpreter *Interpreter, args []interface{}) interface{} {
-	return time.Now().Second()
+// Call 通过 VisitCallExpr 调用时 error 会带上调用的位置, 这里直接向上传递
+func (n *NativeFunction) Call(interpreter *Interpreter, args []interface{}) interface{} {
+	result, err := n.function(interpreter, args)
+	if err != nil {
+		panic(err)
+	}
+	return result
 }
 
-func (c ClockFunc) String() string {
+func (n *NativeFunction) String() string {
 	return "<native fn>"
 }
 
@@ -30,12 +36,21 @@ type LoxFunction struct {
 	Closure  *Environment
 
 	isInitializer bool
+	// 方法所属的类名, 用于调用栈
+	className string
+	// 定义函数的模块的全局作用域, 调用其他模块的函数时切换过去
+	globals *Environment
+	// 定义函数的源码, 函数中的运行时错误在这里生成位置信息
+	reporter *Errors.Reporter
 }
 
 func (l *LoxFunction) Bind(instance *LoxInstance) *LoxFunction {
 	env := NewLocalEnvironment(l.Closure)
 	env.Define("this", instance)
-	return NewLoxFunction(l.funcStmt, env, l.isInitializer)
+	bound := NewLoxFunction(l.funcStmt, env, l.isInitializer)
+	bound.className = l.className
+	bound.reporter = l.reporter
+	return bound
 }
 
 func (l *LoxFunction) Arity() int {
@@ -44,11 +59,20 @@ func (l *LoxFunction) Arity() int {
 
 func (l *LoxFunction) Call(interpreter *Interpreter, args []interface{}) (result interface{}) {
 	// 默认是使用全局变量, 闭包在这里需要考虑其他
+	previous, previousReporter := interpreter.global, interpreter.reporter
+	interpreter.global, interpreter.reporter = l.globals, l.reporter
 	defer func() {
+		interpreter.global, interpreter.reporter = previous, previousReporter
 		if r := recover(); r != nil {
-			if v, ok := r.(*ReturnObj); ok {
-				result = v.Value
+			v, ok := r.(*ReturnObj)
+			if !ok {
+				// 运行时错误继续向上传递, 位置信息使用函数所在的源码
+				if err, ok := r.(error); ok {
+					attachDiagnostic(err, l.reporter)
+				}
+				panic(r)
 			}
+			result = v.Value
 			if l.isInitializer {
 				result = l.Closure.GetWithString(0, "this")
 			}
@@ -66,10 +90,14 @@ func (l *LoxFunction) Call(interpreter *Interpreter, args []interface{}) (result
 }
 
 func (l *LoxFunction) String() string {
-	return "<fn " + l.funcStmt.name.Lexeme + " >"
+	return "<fn " + l.funcStmt.name.Lexeme + ">"
 }
 
 func NewLoxFunction(declaration *FunctionStmt, closure *Environment, isInitializer bool) *LoxFunction {
-	f := &LoxFunction{funcStmt: declaration, Closure: closure, isInitializer: isInitializer}
+	globals := closure
+	for globals.Enclosing != nil {
+		globals = globals.Enclosing
+	}
+	f := &LoxFunction{funcStmt: declaration, Closure: closure, isInitializer: isInitializer, globals: globals}
 	return f
 }
@@ -1,7 +1,6 @@
 package Syntax
 
 import (
-	"github.com/trueabc/lox/Errors"
 	"github.com/trueabc/lox/Token"
 )
 
@@ -12,9 +11,12 @@ type LoxClass struct {
 	superClass *LoxClass
 }
 
+// FindMethod 在类和它的所有父类中查找方法
 func (lc *LoxClass) FindMethod(name string) *LoxFunction {
-	if v, ok := lc.methods[name]; ok {
-		return v
+	for class := lc; class != nil; class = class.superClass {
+		if v, ok := class.methods[name]; ok {
+			return v
+		}
 	}
 	return nil
 }
@@ -63,11 +65,7 @@ func (li *LoxInstance) Get(token *Token.Token) interface{} {
 	if method := li.kClass.FindMethod(token.Lexeme); method != nil {
 		return method.Bind(li)
 	}
-	if li.kClass.superClass != nil {
-		return li.kClass.superClass.FindMethod(token.Lexeme).Bind(li)
-	}
-	Errors.LoxRuntimeError(token, "Undefined property '"+token.Lexeme+"'.")
-	return nil
+	panic(NewRuntimeError(token, "Undefined property '"+token.Lexeme+"'."))
 }
 
 func (li *LoxInstance) Set(token *Token.Token, value interface{}) interface{} {
@@ -76,7 +74,7 @@ func (li *LoxInstance) Set(token *Token.Token, value interface{}) interface{} {
 }
 
 func (li *LoxInstance) String() string {
-	return li.kClass.String() + " instance."
+	return li.kClass.String() + " instance"
 }
 
 func NewLoxInstance(kClass *LoxClass) *LoxInstance {
@@ -0,0 +1,84 @@
+package Syntax
+
+import (
+	"github.com/trueabc/lox/Errors"
+	"github.com/trueabc/lox/Token"
+)
+
+func init() {
+	RegisterNative("Error", 1, func(interpreter *Interpreter, args []interface{}) (interface{}, error) {
+		if message, ok := args[0].(string); ok {
+			return &LoxError{Message: message}, nil
+		}
+		return &LoxError{Message: Stringify(args[0])}, nil
+	})
+}
+
+// LoxError 错误对象, 由 Error(message) 创建, 或者在 catch 中由运行时错误转换而来
+// 属性 message, line 和 stack 只读, 两个后端共用这个类型
+type LoxError struct {
+	Message string
+	// 第一次抛出的位置和调用栈, 还没有抛出时为 nil, 再次抛出时保持不变
+	Token *Token.Token
+	Stack []TraceLine
+	// 第一次抛出的位置在源码中的信息, 在其他文件中再次抛出时仍然指向原来的源码
+	diagnostic *Errors.Diagnostic
+}
+
+// member 属性的值, stack 是调用栈中每一行组成的列表, 最内层在前
+func (e *LoxError) member(name string) (interface{}, bool) {
+	switch name {
+	case "message":
+		return e.Message, true
+	case "line":
+		if e.Token == nil {
+			return nil, true
+		}
+		return float64(e.Token.Line), true
+	case "stack":
+		stack := make([]interface{}, 0, len(e.Stack))
+		for _, line := range e.Stack {
+			stack = append(stack, line.String())
+		}
+		return NewLoxList(stack), true
+	}
+	return nil, false
+}
+
+func (e *LoxError) Get(token *Token.Token) interface{} {
+	if value, ok := e.member(token.Lexeme); ok {
+		return value
+	}
+	panic(NewRuntimeError(token, "Undefined property '"+token.Lexeme+"'."))
+}
+
+func (e *LoxError) String() string {
+	return "Error: " + e.Message
+}
+
+// newThrowError throw 语句产生的运行时错误, 错误对象第一次抛出时记录位置和调用栈
+// 没有被捕获时, 错误对象输出它的 message, 其他值输出 Uncaught 和值本身
+func newThrowError(keyword *Token.Token, value interface{}, stackTrace func(line int) []TraceLine) *RuntimeError {
+	err := &RuntimeError{Value: value, Thrown: true}
+	if e, ok := value.(*LoxError); ok {
+		if e.Token == nil {
+			e.Token, e.Stack = keyword, stackTrace(keyword.Line)
+		}
+		err.Token, err.Content, err.Trace, err.Diagnostic = e.Token, e.Message, e.Stack, e.diagnostic
+		return err
+	}
+	err.Token, err.Content, err.Trace = keyword, "Uncaught "+Stringify(value)+".", stackTrace(keyword.Line)
+	return err
+}
+
+// Caught catch 中得到的值, throw 的值原样返回, 其他运行时错误转换为错误对象
+// 调用之前 Trace 必须已经记录
+func (re *RuntimeError) Caught() interface{} {
+	if re.Thrown {
+		if e, ok := re.Value.(*LoxError); ok && e.diagnostic == nil {
+			e.diagnostic = re.Diagnostic
+		}
+		return re.Value
+	}
+	return &LoxError{Message: re.Content, Token: re.Token, Stack: re.Trace, diagnostic: re.Diagnostic}
+}
@@ -0,0 +1,148 @@
+package Syntax
+
+import (
+	"errors"
+	"fmt"
+	"github.com/trueabc/lox/Token"
+	"strings"
+)
+
+// LoxList 列表, 树遍历解释器中的表示, 元素直接使用 interface{}
+type LoxList struct {
+	elements []interface{}
+}
+
+func NewLoxList(elements []interface{}) *LoxList {
+	return &LoxList{elements: elements}
+}
+
+// Get 列表的方法, 返回绑定了列表的 native 函数
+func (l *LoxList) Get(token *Token.Token) interface{} {
+	switch token.Lexeme {
+	case "len":
+		return l.method("len", 0, func(args []interface{}) (interface{}, error) {
+			return float64(len(l.elements)), nil
+		})
+	case "push":
+		return l.method("push", 1, func(args []interface{}) (interface{}, error) {
+			l.elements = append(l.elements, args[0])
+			return nil, nil
+		})
+	case "pop":
+		return l.method("pop", 0, func(args []interface{}) (interface{}, error) {
+			if len(l.elements) == 0 {
+				return nil, errors.New("Can't pop from an empty list.")
+			}
+			last := l.elements[len(l.elements)-1]
+			l.elements = l.elements[:len(l.elements)-1]
+			return last, nil
+		})
+	case "insert":
+		return l.method("insert", 2, func(args []interface{}) (interface{}, error) {
+			// 可以插入到末尾
+			index, err := listIndex(args[0], len(l.elements)+1)
+			if err != nil {
+				return nil, err
+			}
+			l.elements = append(l.elements, nil)
+			copy(l.elements[index+1:], l.elements[index:])
+			l.elements[index] = args[1]
+			return nil, nil
+		})
+	case "remove":
+		return l.method("remove", 1, func(args []interface{}) (interface{}, error) {
+			index, err := listIndex(args[0], len(l.elements))
+			if err != nil {
+				return nil, err
+			}
+			removed := l.elements[index]
+			l.elements = append(l.elements[:index], l.elements[index+1:]...)
+			return removed, nil
+		})
+	case "slice":
+		return l.method("slice", 2, func(args []interface{}) (interface{}, error) {
+			start, end, err := sliceBounds(args[0], args[1], len(l.elements))
+			if err != nil {
+				return nil, err
+			}
+			elements := make([]interface{}, end-start)
+			copy(elements, l.elements[start:end])
+			return NewLoxList(elements), nil
+		})
+	}
+	panic(NewRuntimeError(token, "Undefined property '"+token.Lexeme+"'."))
+}
+
+func (l *LoxList) method(name string, arity int, function func(args []interface{}) (interface{}, error)) *NativeFunction {
+	return &NativeFunction{name: name, arity: arity,
+		function: func(interpreter *Interpreter, args []interface{}) (interface{}, error) {
+			return function(args)
+		}}
+}
+
+// GetIndex 读取下标对应的元素
+func (l *LoxList) GetIndex(bracket *Token.Token, index interface{}) interface{} {
+	i, err := listIndex(index, len(l.elements))
+	if err != nil {
+		panic(NewRuntimeError(bracket, err.Error()))
+	}
+	return l.elements[i]
+}
+
+// SetIndex 只能修改已经存在的元素, 追加使用 push
+func (l *LoxList) SetIndex(bracket *Token.Token, index, value interface{}) {
+	i, err := listIndex(index, len(l.elements))
+	if err != nil {
+		panic(NewRuntimeError(bracket, err.Error()))
+	}
+	l.elements[i] = value
+}
+
+func (l *LoxList) String() string {
+	return l.format(nil)
+}
+
+func (l *LoxList) format(printing map[interface{}]bool) string {
+	if printing[l] {
+		return "[...]"
+	}
+	if printing == nil {
+		printing = make(map[interface{}]bool)
+	}
+	printing[l] = true
+	defer delete(printing, l)
+
+	items := make([]string, 0, len(l.elements))
+	for _, item := range l.elements {
+		items = append(items, stringify(item, printing))
+	}
+	return "[" + strings.Join(items, ", ") + "]"
+}
+
+// listIndex 检查下标是否为 [0, limit) 之间的整数, 两个后端共用
+func listIndex(index interface{}, limit int) (int, error) {
+	number, ok := index.(float64)
+	if !ok || number != float64(int(number)) {
+		return 0, errors.New("List index must be an integer.")
+	}
+	if number < 0 || int(number) >= limit {
+		return 0, fmt.Errorf("List index %v out of range.", number)
+	}
+	return int(number), nil
+}
+
+// sliceBounds 检查 slice 的范围, 满足 0 <= start <= end <= length
+func sliceBounds(start, end interface{}, length int) (int, int, error) {
+	from, err := listIndex(start, length+1)
+	if err != nil {
+		return 0, 0, err
+	}
+	to, err := listIndex(end, length+1)
+	if err != nil {
+		return 0, 0, err
+	}
+	if from > to {
+		return 0, 0, fmt.Errorf("Slice start %d is greater than end %d.", from, to)
+	}
+	return from, to, nil
+}
@@ -0,0 +1,122 @@
+package Syntax
+
+import (
+	"fmt"
+	"github.com/trueabc/lox/Token"
+	"strings"
+)
+
+// LoxMap 字典, 按照插入顺序保存, keys 和 values 的结果是确定的
+// 键的相等与 isEqual 一致: 数字, 字符串, bool 和 nil 按值比较, 对象按引用比较
+type LoxMap struct {
+	keys   []interface{}
+	values []interface{}
+	index  map[interface{}]int
+}
+
+func NewLoxMap() *LoxMap {
+	return &LoxMap{keys: make([]interface{}, 0), values: make([]interface{}, 0),
+		index: make(map[interface{}]int)}
+}
+
+func (m *LoxMap) Lookup(key interface{}) (interface{}, bool) {
+	if id, ok := m.index[key]; ok {
+		return m.values[id], true
+	}
+	return nil, false
+}
+
+func (m *LoxMap) Put(key, value interface{}) {
+	if id, ok := m.index[key]; ok {
+		m.values[id] = value
+		return
+	}
+	m.index[key] = len(m.keys)
+	m.keys = append(m.keys, key)
+	m.values = append(m.values, value)
+}
+
+// Delete 删除键, 返回键是否存在
+func (m *LoxMap) Delete(key interface{}) bool {
+	id, ok := m.index[key]
+	if !ok {
+		return false
+	}
+	delete(m.index, key)
+	m.keys = append(m.keys[:id], m.keys[id+1:]...)
+	m.values = append(m.values[:id], m.values[id+1:]...)
+	// 后面的元素前移了一位
+	for k := id; k < len(m.keys); k++ {
+		m.index[m.keys[k]] = k
+	}
+	return true
+}
+
+// Get 字典的方法, 返回绑定了字典的 native 函数
+func (m *LoxMap) Get(token *Token.Token) interface{} {
+	switch token.Lexeme {
+	case "len":
+		return m.method("len", 0, func(args []interface{}) interface{} {
+			return float64(len(m.keys))
+		})
+	case "keys":
+		return m.method("keys", 0, func(args []interface{}) interface{} {
+			return NewLoxList(append([]interface{}{}, m.keys...))
+		})
+	case "values":
+		return m.method("values", 0, func(args []interface{}) interface{} {
+			return NewLoxList(append([]interface{}{}, m.values...))
+		})
+	case "has":
+		return m.method("has", 1, func(args []interface{}) interface{} {
+			_, ok := m.index[args[0]]
+			return ok
+		})
+	case "delete":
+		return m.method("delete", 1, func(args []interface{}) interface{} {
+			return m.Delete(args[0])
+		})
+	}
+	panic(NewRuntimeError(token, "Undefined property '"+token.Lexeme+"'."))
+}
+
+func (m *LoxMap) method(name string, arity int, function func(args []interface{}) interface{}) *NativeFunction {
+	return &NativeFunction{name: name, arity: arity,
+		function: func(interpreter *Interpreter, args []interface{}) (interface{}, error) {
+			return function(args), nil
+		}}
+}
+
+// GetIndex 读取键对应的值, 键不存在是运行时错误
+func (m *LoxMap) GetIndex(bracket *Token.Token, key interface{}) interface{} {
+	value, ok := m.Lookup(key)
+	if !ok {
+		panic(NewRuntimeError(bracket, mapKeyError(Stringify(key))))
+	}
+	return value
+}
+
+func (m *LoxMap) String() string {
+	return m.format(nil)
+}
+
+func (m *LoxMap) format(printing map[interface{}]bool) string {
+	if printing[m] {
+		return "{...}"
+	}
+	if printing == nil {
+		printing = make(map[interface{}]bool)
+	}
+	printing[m] = true
+	defer delete(printing, m)
+
+	items := make([]string, 0, len(m.keys))
+	for id := range m.keys {
+		items = append(items, stringify(m.keys[id], printing)+": "+stringify(m.values[id], printing))
+	}
+	return "{" + strings.Join(items, ", ") + "}"
+}
+
+func mapKeyError(key string) string {
+	return fmt.Sprintf("Key '%s' not found in map.", key)
+}
@@ -0,0 +1,179 @@
+package Syntax
+
+import (
+	"fmt"
+	"github.com/trueabc/lox/Errors"
+	"github.com/trueabc/lox/Token"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// moduleLoader import 的公共部分, 两个后端共用
+// 路径相对于正在执行的文件解析, 每个文件只执行一次, 之后的 import 直接使用缓存
+type moduleLoader struct {
+	// 绝对路径 -> *LoxModule 或者 *ObjModule
+	modules map[string]interface{}
+	// 正在加载的文件, 第一个是入口文件, 用于解析相对路径和检测循环 import
+	loading []string
+}
+
+func newModuleLoader() *moduleLoader {
+	return &moduleLoader{modules: make(map[string]interface{}), loading: make([]string, 0)}
+}
+
+// resolve 相对路径基于当前文件所在的目录, 没有文件时 (例如 REPL) 基于工作目录
+func (l *moduleLoader) resolve(path string) string {
+	if !filepath.IsAbs(path) && len(l.loading) != 0 && l.loading[len(l.loading)-1] != "" {
+		path = filepath.Join(filepath.Dir(l.loading[len(l.loading)-1]), path)
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	return abs
+}
+
+// begin 开始加载 path, 如果它已经在加载中说明出现了循环
+func (l *moduleLoader) begin(path string) error {
+	for id, item := range l.loading {
+		if item == path {
+			return fmt.Errorf("Import cycle detected: %s.", l.chain(id, path))
+		}
+	}
+	l.loading = append(l.loading, path)
+	return nil
+}
+
+func (l *moduleLoader) end() {
+	l.loading = l.loading[:len(l.loading)-1]
+}
+
+// chain 从 start 开始的 import 链, 路径相对于入口文件所在的目录
+func (l *moduleLoader) chain(start int, path string) string {
+	root := ""
+	if l.loading[0] != "" {
+		root = filepath.Dir(l.loading[0])
+	}
+	files := make([]string, 0, len(l.loading)-start+1)
+	for _, item := range append(l.loading[start:], path) {
+		if rel, err := filepath.Rel(root, item); root != "" && err == nil {
+			item = rel
+		}
+		files = append(files, filepath.ToSlash(item))
+	}
+	return strings.Join(files, " -> ")
+}
+
+// moduleName 模块对象被所有 import 共用, 以文件名而不是 import 的别名命名
+func moduleName(path string) string {
+	return strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+}
+
+// parseModule 读取并解析模块, 编译错误以 Errors.Diagnostics 返回
+// reporter 用于之后给运行时错误补充源码位置
+func parseModule(host *Interpreter, path string) ([]Stmt, *Errors.Reporter, error) {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	reporter := Errors.NewReporter(path, string(source))
+	tokens := Token.NewScanner(string(source), reporter).ScanTokens()
+	stmts := NewParser(tokens, reporter).Parse()
+	if reporter.HadError() {
+		return nil, nil, reporter.Diagnostics
+	}
+	NewResolver(host, reporter).ResolveStmts(stmts)
+	if reporter.HadError() {
+		return nil, nil, reporter.Diagnostics
+	}
+	return stmts, reporter, nil
+}
+
+// moduleExports 模块顶层声明的名字, 只有这些可以通过模块访问
+func moduleExports(stmts []Stmt) map[string]bool {
+	exports := make(map[string]bool)
+	for _, stmt := range stmts {
+		switch s := stmt.(type) {
+		case *VariableStmt:
+			exports[s.name.Lexeme] = true
+		case *FunctionStmt:
+			exports[s.name.Lexeme] = true
+		case *ClassStmt:
+			exports[s.name.Lexeme] = true
+		case *ImportStmt:
+			exports[s.name.Lexeme] = true
+		}
+	}
+	return exports
+}
+
+// attachDiagnostic 运行时错误使用出错的代码所在的源码生成位置信息, 已经有位置信息时不变
+// 在出错的函数或者模块返回时调用, 这时 reporter 还是出错位置的源码
+func attachDiagnostic(err error, reporter *Errors.Reporter) {
+	if runtimeErr, ok := err.(*RuntimeError); ok && runtimeErr.Diagnostic == nil && reporter != nil {
+		runtimeErr.Diagnostic = reporter.NewDiagnostic(runtimeErr.Token,
+			Errors.SeverityError, "", runtimeErr.Content)
+	}
+}
+
+// importError 读取文件失败时的错误信息
+func importError(path string, err error) string {
+	if os.IsNotExist(err) {
+		return fmt.Sprintf("Can't find module '%s'.", path)
+	}
+	return fmt.Sprintf("Can't read module '%s': %v", path, err)
+}
+
+// SetFile 设置当前执行的入口文件, import 的相对路径基于它所在的目录
+func (i *Interpreter) SetFile(path string) {
+	i.loader.loading = append(i.loader.loading[:0], path)
+}
+
+func (i *Interpreter) VisitImportStmt(importstmt Stmt) interface{} {
+	class := importstmt.(*ImportStmt)
+	i.env.Define(class.name.Lexeme, i.importModule(class))
+	return nil
+}
+
+func (i *Interpreter) importModule(stmt *ImportStmt) *LoxModule {
+	path := i.loader.resolve(stmt.path.Literal.(string))
+	if module, ok := i.loader.modules[path]; ok {
+		return module.(*LoxModule)
+	}
+	if err := i.loader.begin(path); err != nil {
+		panic(NewRuntimeError(stmt.path, err.Error()))
+	}
+	defer i.loader.end()
+
+	stmts, reporter, err := parseModule(i, path)
+	if diagnostics, ok := err.(Errors.Diagnostics); ok {
+		panic(diagnostics)
+	} else if err != nil {
+		panic(NewRuntimeError(stmt.path, importError(stmt.path.Literal.(string), err)))
+	}
+
+	// 模块在自己的全局作用域中执行
+	globals := i.moduleGlobals()
+	previousEnv, previousGlobal, previousReporter := i.env, i.global, i.reporter
+	defer func() {
+		i.env, i.global, i.reporter = previousEnv, previousGlobal, previousReporter
+		if r := recover(); r != nil {
+			if err, ok := r.(error); ok {
+				attachDiagnostic(err, reporter)
+			}
+			panic(r)
+		}
+	}()
+	i.env, i.global, i.reporter = globals, globals, reporter
+	// 和函数调用一样, 出错时不出栈, 调用栈中显示模块的路径
+	i.frames = append(i.frames, CallFrame{Module: stmt.path.Literal.(string), Line: stmt.path.Line})
+	for _, s := range stmts {
+		i.execute(s)
+	}
+	i.popFrame()
+
+	module := &LoxModule{name: moduleName(path), members: globals.VarValues, exports: moduleExports(stmts)}
+	i.loader.modules[path] = module
+	return module
+}
@@ -0,0 +1,175 @@
+package Syntax
+
+import (
+	"fmt"
+	"github.com/trueabc/lox/Token"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Variadic native 函数接受任意个数的参数, 参数个数由函数自己检查
+const Variadic = -1
+
+// NativeFunc go 实现的函数, 返回的 error 会变成调用位置的运行时错误
+type NativeFunc func(interpreter *Interpreter, args []interface{}) (interface{}, error)
+
+// 注册表中的 native 函数和模块, 在新建 Interpreter 和 VM 时定义到全局作用域
+// 注册一般在 init 中完成, 之后创建的解释器才能看到
+// 多个 VM 可以在不同的 goroutine 中创建, 注册表的读写都需要 registryLock
+var (
+	registryLock      sync.RWMutex
+	registeredNatives = make(map[string]*NativeFunction)
+	registeredModules = make(map[string]*LoxModule)
+)
+
+// RegisterNative 注册一个全局的 native 函数, 同名的函数会被覆盖
+func RegisterNative(name string, arity int, function NativeFunc) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	registeredNatives[name] = &NativeFunction{name: name, arity: arity, function: function}
+}
+
+// RegisterModule 注册一个 native 模块, 在 lox 中作为同名的全局变量使用, 例如 math.sqrt(2)
+// 注册之后不应该再向模块添加成员
+func RegisterModule(module *LoxModule) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	registeredModules[module.name] = module
+}
+
+// defineNatives 把注册表中的函数和模块定义到 define 中, 按名字排序保证结果稳定
+// 先复制注册表再调用 define, define 中可以注册新的函数
+func defineNatives(define func(name string, value interface{})) {
+	registryLock.RLock()
+	natives := make(map[string]interface{}, len(registeredNatives))
+	for name, function := range registeredNatives {
+		natives[name] = function
+	}
+	modules := make(map[string]interface{}, len(registeredModules))
+	for name, module := range registeredModules {
+		modules[name] = module
+	}
+	registryLock.RUnlock()
+
+	for _, values := range []map[string]interface{}{natives, modules} {
+		names := make([]string, 0, len(values))
+		for name := range values {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			define(name, values[name])
+		}
+	}
+}
+
+// nativeNames 所有注册的函数和模块的名字, 按名字排序
+func nativeNames() []string {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+	names := make([]string, 0, len(registeredNatives)+len(registeredModules))
+	for name := range registeredNatives {
+		names = append(names, name)
+	}
+	for name := range registeredModules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// isNative name 是否是注册的函数或者模块
+func isNative(name string) bool {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+	_, native := registeredNatives[name]
+	return native || registeredModules[name] != nil
+}
+
+// LoxModule 一组命名的成员, 通过属性访问, 成员不能被修改
+// import 的模块中 members 是模块的全局变量, 只有 exports 中的名字可以访问
+type LoxModule struct {
+	name    string
+	members map[string]interface{}
+	exports map[string]bool
+}
+
+func NewModule(name string) *LoxModule {
+	return &LoxModule{name: name, members: make(map[string]interface{})}
+}
+
+// Function 向模块添加 native 函数, 返回模块本身便于链式调用
+func (m *LoxModule) Function(name string, arity int, function NativeFunc) *LoxModule {
+	m.members[name] = &NativeFunction{name: m.name + "." + name, arity: arity, function: function}
+	return m
+}
+
+// Value 向模块添加一个值, 例如 math.pi
+func (m *LoxModule) Value(name string, value interface{}) *LoxModule {
+	m.members[name] = value
+	return m
+}
+
+func (m *LoxModule) Get(token *Token.Token) interface{} {
+	if v, ok := m.members[token.Lexeme]; ok && (m.exports == nil || m.exports[token.Lexeme]) {
+		return v
+	}
+	panic(NewRuntimeError(token, "Undefined property '"+token.Lexeme+"'."))
+}
+
+func (m *LoxModule) String() string {
+	return "<module " + m.name + ">"
+}
+
+// 下面是 native 函数检查参数用的辅助函数, 错误信息中的参数从 1 开始计数
+
+func numberArg(function string, args []interface{}, index int) (float64, error) {
+	if v, ok := args[index].(float64); ok {
+		return v, nil
+	}
+	return 0, fmt.Errorf("%s() expects a number as argument %d.", function, index+1)
+}
+
+func stringArg(function string, args []interface{}, index int) (string, error) {
+	if v, ok := args[index].(string); ok {
+		return v, nil
+	}
+	return "", fmt.Errorf("%s() expects a string as argument %d.", function, index+1)
+}
+
+// listArg 两个后端的列表都可以作为参数
+func listArg(function string, args []interface{}, index int) ([]interface{}, error) {
+	switch v := args[index].(type) {
+	case *LoxList:
+		return v.elements, nil
+	case *ObjList:
+		elements := make([]interface{}, 0, len(v.elements))
+		for _, item := range v.elements {
+			elements = append(elements, item.Interface())
+		}
+		return elements, nil
+	}
+	return nil, fmt.Errorf("%s() expects a list as argument %d.", function, index+1)
+}
+
+// atLeast 检查 variadic 函数的参数个数
+func atLeast(function string, args []interface{}, count int) error {
+	if len(args) < count {
+		noun := "arguments"
+		if count == 1 {
+			noun = "argument"
+		}
+		return fmt.Errorf("%s() expects at least %d %s but got %d.", function, count, noun, len(args))
+	}
+	return nil
+}
+
+// joinValues 按照 print 的格式拼接多个值
+func joinValues(args []interface{}, sep string) string {
+	items := make([]string, 0, len(args))
+	for _, item := range args {
+		items = append(items, Stringify(item))
+	}
+	return strings.Join(items, sep)
+}
@@ -0,0 +1,36 @@
+package Syntax
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// io 模块, 输出写到解释器的 stdout 和 stderr, 从解释器的 stdin 读取输入
+func init() {
+	module := NewModule("io")
+	module.Function("write", Variadic, func(interpreter *Interpreter, args []interface{}) (interface{}, error) {
+		fmt.Fprint(interpreter.Stdout(), joinValues(args, " "))
+		return nil, nil
+	})
+	module.Function("writeln", Variadic, func(interpreter *Interpreter, args []interface{}) (interface{}, error) {
+		fmt.Fprintln(interpreter.Stdout(), joinValues(args, " "))
+		return nil, nil
+	})
+	module.Function("error", Variadic, func(interpreter *Interpreter, args []interface{}) (interface{}, error) {
+		fmt.Fprintln(interpreter.Stderr(), joinValues(args, " "))
+		return nil, nil
+	})
+	// 读取一行, 不包含换行符, 输入结束时返回 nil
+	module.Function("readLine", 0, func(interpreter *Interpreter, args []interface{}) (interface{}, error) {
+		line, err := interpreter.Stdin().ReadString('\n')
+		if err == io.EOF && line == "" {
+			return nil, nil
+		}
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	})
+	RegisterModule(module)
+}
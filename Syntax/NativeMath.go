@@ -0,0 +1,76 @@
+package Syntax
+
+import (
+	"math"
+	"math/rand"
+)
+
+// math 模块
+func init() {
+	module := NewModule("math").
+		Value("pi", math.Pi).
+		Value("e", math.E).
+		Value("inf", math.Inf(1))
+	for name, function := range map[string]func(float64) float64{
+		"sqrt":  math.Sqrt,
+		"floor": math.Floor,
+		"ceil":  math.Ceil,
+		"round": math.Round,
+		"abs":   math.Abs,
+		"sin":   math.Sin,
+		"cos":   math.Cos,
+		"tan":   math.Tan,
+		"log":   math.Log,
+		"exp":   math.Exp,
+	} {
+		module.Function(name, 1, unaryMath("math."+name, function))
+	}
+	module.Function("pow", 2, func(interpreter *Interpreter, args []interface{}) (interface{}, error) {
+		x, err := numberArg("math.pow", args, 0)
+		if err != nil {
+			return nil, err
+		}
+		y, err := numberArg("math.pow", args, 1)
+		if err != nil {
+			return nil, err
+		}
+		return math.Pow(x, y), nil
+	})
+	module.Function("min", Variadic, extremum("math.min", math.Min))
+	module.Function("max", Variadic, extremum("math.max", math.Max))
+	module.Function("random", 0, func(interpreter *Interpreter, args []interface{}) (interface{}, error) {
+		return rand.Float64(), nil
+	})
+	RegisterModule(module)
+}
+
+func unaryMath(name string, function func(float64) float64) NativeFunc {
+	return func(interpreter *Interpreter, args []interface{}) (interface{}, error) {
+		x, err := numberArg(name, args, 0)
+		if err != nil {
+			return nil, err
+		}
+		return function(x), nil
+	}
+}
+
+// extremum min 和 max, 至少需要一个参数
+func extremum(name string, pick func(float64, float64) float64) NativeFunc {
+	return func(interpreter *Interpreter, args []interface{}) (interface{}, error) {
+		if err := atLeast(name, args, 1); err != nil {
+			return nil, err
+		}
+		result, err := numberArg(name, args, 0)
+		if err != nil {
+			return nil, err
+		}
+		for index := 1; index < len(args); index++ {
+			x, err := numberArg(name, args, index)
+			if err != nil {
+				return nil, err
+			}
+			result = pick(result, x)
+		}
+		return result, nil
+	}
+}
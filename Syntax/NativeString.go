@@ -0,0 +1,128 @@
+package Syntax
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// string 模块, 下标按照 rune 计算
+func init() {
+	module := NewModule("string")
+	module.Function("len", 1, func(interpreter *Interpreter, args []interface{}) (interface{}, error) {
+		s, err := stringArg("string.len", args, 0)
+		if err != nil {
+			return nil, err
+		}
+		return float64(utf8.RuneCountInString(s)), nil
+	})
+	for name, function := range map[string]func(string) string{
+		"upper": strings.ToUpper,
+		"lower": strings.ToLower,
+		"trim":  strings.TrimSpace,
+	} {
+		module.Function(name, 1, unaryString("string."+name, function))
+	}
+	module.Function("substr", 3, func(interpreter *Interpreter, args []interface{}) (interface{}, error) {
+		s, err := stringArg("string.substr", args, 0)
+		if err != nil {
+			return nil, err
+		}
+		runes := []rune(s)
+		start, end, err := sliceBounds(args[1], args[2], len(runes))
+		if err != nil {
+			return nil, err
+		}
+		return string(runes[start:end]), nil
+	})
+	module.Function("index", 2, func(interpreter *Interpreter, args []interface{}) (interface{}, error) {
+		s, sub, err := twoStrings("string.index", args)
+		if err != nil {
+			return nil, err
+		}
+		index := strings.Index(s, sub)
+		if index < 0 {
+			return float64(-1), nil
+		}
+		return float64(utf8.RuneCountInString(s[:index])), nil
+	})
+	module.Function("contains", 2, func(interpreter *Interpreter, args []interface{}) (interface{}, error) {
+		s, sub, err := twoStrings("string.contains", args)
+		if err != nil {
+			return nil, err
+		}
+		return strings.Contains(s, sub), nil
+	})
+	module.Function("split", 2, func(interpreter *Interpreter, args []interface{}) (interface{}, error) {
+		s, sep, err := twoStrings("string.split", args)
+		if err != nil {
+			return nil, err
+		}
+		parts := strings.Split(s, sep)
+		elements := make([]interface{}, 0, len(parts))
+		for _, part := range parts {
+			elements = append(elements, part)
+		}
+		return NewLoxList(elements), nil
+	})
+	module.Function("join", 2, func(interpreter *Interpreter, args []interface{}) (interface{}, error) {
+		elements, err := listArg("string.join", args, 0)
+		if err != nil {
+			return nil, err
+		}
+		sep, err := stringArg("string.join", args, 1)
+		if err != nil {
+			return nil, err
+		}
+		return joinValues(elements, sep), nil
+	})
+	module.Function("replace", 3, func(interpreter *Interpreter, args []interface{}) (interface{}, error) {
+		s, old, err := twoStrings("string.replace", args)
+		if err != nil {
+			return nil, err
+		}
+		replacement, err := stringArg("string.replace", args, 2)
+		if err != nil {
+			return nil, err
+		}
+		return strings.ReplaceAll(s, old, replacement), nil
+	})
+	module.Function("toNumber", 1, func(interpreter *Interpreter, args []interface{}) (interface{}, error) {
+		s, err := stringArg("string.toNumber", args, 0)
+		if err != nil {
+			return nil, err
+		}
+		number, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if err != nil {
+			return nil, fmt.Errorf("Can't convert '%s' to a number.", s)
+		}
+		return number, nil
+	})
+	module.Function("from", 1, func(interpreter *Interpreter, args []interface{}) (interface{}, error) {
+		return Stringify(args[0]), nil
+	})
+	RegisterModule(module)
+}
+
+func unaryString(name string, function func(string) string) NativeFunc {
+	return func(interpreter *Interpreter, args []interface{}) (interface{}, error) {
+		s, err := stringArg(name, args, 0)
+		if err != nil {
+			return nil, err
+		}
+		return function(s), nil
+	}
+}
+
+func twoStrings(name string, args []interface{}) (string, string, error) {
+	first, err := stringArg(name, args, 0)
+	if err != nil {
+		return "", "", err
+	}
+	second, err := stringArg(name, args, 1)
+	if err != nil {
+		return "", "", err
+	}
+	return first, second, nil
+}
@@ -0,0 +1,55 @@
+package Syntax
+
+import (
+	"errors"
+	"math"
+	"time"
+)
+
+// 单调时钟的起点, clock 和 time.monotonic 返回从这里开始经过的秒数
+var monotonicStart = time.Now()
+
+func monotonic(interpreter *Interpreter, args []interface{}) (interface{}, error) {
+	return time.Since(monotonicStart).Seconds(), nil
+}
+
+// clock 以及 time 模块, 时间都是 float64 的秒数
+func init() {
+	RegisterNative("clock", 0, monotonic)
+
+	module := NewModule("time")
+	// 从 1970 年开始的秒数
+	module.Function("now", 0, func(interpreter *Interpreter, args []interface{}) (interface{}, error) {
+		return float64(time.Now().UnixNano()) / float64(time.Second), nil
+	})
+	module.Function("sleep", 1, func(interpreter *Interpreter, args []interface{}) (interface{}, error) {
+		ms, err := numberArg("time.sleep", args, 0)
+		if err != nil {
+			return nil, err
+		}
+		if ms < 0 || math.IsNaN(ms) {
+			return nil, errors.New("time.sleep() expects a non-negative duration.")
+		}
+		// 超过 time.Duration 能表示的范围时转换会溢出
+		if ms > float64(math.MaxInt64/int64(time.Millisecond)) {
+			return nil, errors.New("time.sleep() duration is too long.")
+		}
+		time.Sleep(time.Duration(ms * float64(time.Millisecond)))
+		return nil, nil
+	})
+	module.Function("monotonic", 0, monotonic)
+	// 使用 go 的时间格式, 例如 time.format(time.now(), "2006-01-02 15:04:05")
+	module.Function("format", 2, func(interpreter *Interpreter, args []interface{}) (interface{}, error) {
+		ts, err := numberArg("time.format", args, 0)
+		if err != nil {
+			return nil, err
+		}
+		layout, err := stringArg("time.format", args, 1)
+		if err != nil {
+			return nil, err
+		}
+		sec := math.Floor(ts)
+		return time.Unix(int64(sec), int64((ts-sec)*float64(time.Second))).Format(layout), nil
+	})
+	RegisterModule(module)
+}
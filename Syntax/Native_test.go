@@ -0,0 +1,188 @@
+package Syntax
+
+import (
+	"fmt"
+	"github.com/trueabc/lox/Errors"
+	"github.com/trueabc/lox/Token"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// run 在两个后端上分别执行 source, 返回各自的 stdout 和 stderr, 出错时测试失败
+func run(t *testing.T, source string) map[string][2]string {
+	return runWithInput(t, source, "")
+}
+
+// runWithInput 和 run 相同, 每个后端的解释器都从 stdin 读取输入
+func runWithInput(t *testing.T, source, stdin string) map[string][2]string {
+	results := make(map[string][2]string)
+	for _, bytecode := range []bool{false, true} {
+		var stdout, stderr strings.Builder
+		reporter := Errors.NewReporter("", source)
+		stmts := NewParser(Token.NewScanner(source, reporter).ScanTokens(), reporter).Parse()
+		interpreter := NewInterpreter(&stdout, &stderr)
+		interpreter.SetStdin(strings.NewReader(stdin))
+		interpreter.SetReporter(reporter)
+		NewResolver(interpreter, reporter).ResolveStmts(stmts)
+		if reporter.HadError() {
+			t.Fatalf("%q: %v", source, reporter.Diagnostics)
+		}
+		name, err := "interpreter", error(nil)
+		if bytecode {
+			name, err = "bytecode", NewVM(interpreter).Interpret(NewCompiler(reporter).Compile(stmts))
+		} else {
+			err = interpreter.Interpret(stmts)
+		}
+		if err != nil {
+			t.Fatalf("%s %q: %v", name, source, err)
+		}
+		results[name] = [2]string{stdout.String(), stderr.String()}
+	}
+	return results
+}
+
+// runError 执行 source, 两个后端都应该返回内容为 message 的运行时错误
+func runError(t *testing.T, source, message string) {
+	for _, bytecode := range []bool{false, true} {
+		reporter := Errors.NewReporter("", source)
+		stmts := NewParser(Token.NewScanner(source, reporter).ScanTokens(), reporter).Parse()
+		interpreter := NewInterpreter(&strings.Builder{}, &strings.Builder{})
+		NewResolver(interpreter, reporter).ResolveStmts(stmts)
+		var err error
+		if bytecode {
+			err = NewVM(interpreter).Interpret(NewCompiler(reporter).Compile(stmts))
+		} else {
+			err = interpreter.Interpret(stmts)
+		}
+		if runtimeErr, ok := err.(*RuntimeError); !ok || runtimeErr.Content != message {
+			t.Errorf("bytecode=%v %q: got %v, want %q", bytecode, source, err, message)
+		}
+	}
+}
+
+func expectOutput(t *testing.T, source, stdout string) {
+	for name, result := range run(t, source) {
+		if result[0] != stdout {
+			t.Errorf("%s %q: got %q, want %q", name, source, result[0], stdout)
+		}
+	}
+}
+
+func TestMathModule(t *testing.T) {
+	expectOutput(t, `print math.sqrt(16);
+print math.floor(-1.5);
+print math.ceil(1.2);
+print math.round(2.5);
+print math.abs(-3);
+print math.pow(2, 10);
+print math.min(3, 1, 2);
+print math.max(3, 1, 2);
+print math.pi > 3.14 and math.pi < 3.15;
+print math.inf > 1000000000000;
+print math.exp(0) + math.log(1) + math.sin(0) + math.cos(0) + math.tan(0);
+var r = math.random();
+print r >= 0 and r < 1;
+print math;
+`, "4\n-2\n2\n3\n3\n1024\n1\n3\ntrue\ntrue\n2\ntrue\n<module math>\n")
+
+	runError(t, `math.sqrt("4");`, "math.sqrt() expects a number as argument 1.")
+	runError(t, `math.pow(2, nil);`, "math.pow() expects a number as argument 2.")
+	runError(t, `math.min();`, "math.min() expects at least 1 argument but got 0.")
+	runError(t, `math.tau;`, "Undefined property 'tau'.")
+}
+
+func TestStringModule(t *testing.T) {
+	expectOutput(t, `print string.len("héllo");
+print string.upper("abc") + string.lower("DEF") + string.trim("  x  ");
+print string.substr("你好世界", 1, 3);
+print string.index("你好世界", "世");
+print string.index("abc", "z");
+print string.contains("abc", "bc");
+print string.split("a,b,,c", ",");
+print string.join([1, "b", nil], "-");
+print string.replace("aXbXc", "X", "");
+print string.toNumber(" 2.5 ") * 2;
+print string.from([1, 2]) + string.from(nil);
+`, "5\nABCdefx\n好世\n2\n-1\ntrue\n[a, b, , c]\n1-b-nil\nabc\n5\n[1, 2]nil\n")
+
+	runError(t, `string.len(1);`, "string.len() expects a string as argument 1.")
+	runError(t, `string.substr("abc", 2, 1);`, "Slice start 2 is greater than end 1.")
+	runError(t, `string.toNumber("x");`, "Can't convert 'x' to a number.")
+	runError(t, `string.join("abc", ",");`, "string.join() expects a list as argument 1.")
+}
+
+func TestIOModule(t *testing.T) {
+	for name, result := range run(t, `io.write("a", 1);
+io.writeln(" b", nil);
+io.error("oops", true);
+`) {
+		if result[0] != "a 1 b nil\n" || result[1] != "oops true\n" {
+			t.Errorf("%s: got stdout %q and stderr %q", name, result[0], result[1])
+		}
+	}
+
+	// 每个解释器有自己的输入, 读完之后返回 nil
+	for name, result := range runWithInput(t, `print io.readLine();
+print io.readLine();
+print io.readLine();
+`, "first\r\nsecond") {
+		if result[0] != "first\nsecond\nnil\n" {
+			t.Errorf("%s: got %q", name, result[0])
+		}
+	}
+}
+
+func TestTimeModule(t *testing.T) {
+	layout := "2006-01-02 15:04:05.000"
+	expected := time.Unix(1000000000, 250000000).Format(layout)
+	expectOutput(t, fmt.Sprintf(`print time.format(1000000000.25, "%s");
+var start = time.monotonic();
+time.sleep(5);
+print time.monotonic() - start >= 0.005;
+print clock() >= start;
+var now = time.now();
+print now > 1000000000 and now < 100000000000;
+`, layout), expected+"\ntrue\ntrue\ntrue\n")
+
+	runError(t, `time.sleep(-1);`, "time.sleep() expects a non-negative duration.")
+	runError(t, `time.sleep(10000000000000000000);`, "time.sleep() duration is too long.")
+	runError(t, `time.sleep(10 ** 400);`, "time.sleep() duration is too long.")
+	runError(t, `time.format(0, 1);`, "time.format() expects a string as argument 2.")
+}
+
+// unregister 测试结束之后从注册表中删除 names, 避免影响之后的测试
+func unregister(t *testing.T, names ...string) {
+	t.Cleanup(func() {
+		registryLock.Lock()
+		defer registryLock.Unlock()
+		for _, name := range names {
+			delete(registeredNatives, name)
+			delete(registeredModules, name)
+		}
+	})
+}
+
+// 注册和创建解释器可以在不同的 goroutine 中同时进行, 用 go test -race 检查
+func TestConcurrentRegistration(t *testing.T) {
+	var wait sync.WaitGroup
+	for id := 0; id < 8; id++ {
+		unregister(t, fmt.Sprintf("concurrent%d", id), fmt.Sprintf("concurrentModule%d", id))
+		wait.Add(2)
+		go func(id int) {
+			defer wait.Done()
+			RegisterNative(fmt.Sprintf("concurrent%d", id), 0, func(*Interpreter, []interface{}) (interface{}, error) {
+				return float64(id), nil
+			})
+			RegisterModule(NewModule(fmt.Sprintf("concurrentModule%d", id)))
+		}(id)
+		go func() {
+			defer wait.Done()
+			NewVM(NewInterpreter(&strings.Builder{}, &strings.Builder{}))
+			Analyze("print concurrent0;", "")
+		}()
+	}
+	wait.Wait()
+	expectOutput(t, "print concurrent7();", "7\n")
+}
@@ -1,37 +1,80 @@
 package Syntax
 
 import (
-	"fmt"
 	"github.com/trueabc/lox/Errors"
-	"github.com/trueabc/lox/Logger"
 	"github.com/trueabc/lox/Token"
+	"path/filepath"
+	"strings"
 )
 
 type Parser struct {
 	tokens  []*Token.Token
 	current int // 下一个需要去消费的token
+
+	reporter *Errors.Reporter
+	// 声明语句和方法的第一个和最后一个 token
+	spans map[Stmt]stmtSpan
+}
+
+// stmtSpan 语句在源码中的范围, 格式化时用来放置注释和空行
+type stmtSpan struct {
+	first *Token.Token
+	last  *Token.Token
 }
 
 // 还需要检查错误
 // 标记恢复点, 在出现error语法之后找到一个恢复点可以继续语法解析
-// todo 当前还没有statement的概念, 后面有panic mode, 恢复点以statement分隔
+// panic mode: 出错之后在 declaration 中恢复, 以 statement 为分隔继续解析
 
-func NewParser(tokens []*Token.Token) *Parser {
-	p := &Parser{tokens: tokens, current: 0}
+func NewParser(tokens []*Token.Token, reporter *Errors.Reporter) *Parser {
+	p := &Parser{tokens: tokens, current: 0, reporter: reporter, spans: make(map[Stmt]stmtSpan)}
 	return p
 }
 
+// Parse 解析所有的语句, 语法错误记录在 reporter 中
+// 出错的语句被丢弃, 返回剩下的部分语法树
 func (p *Parser) Parse() []Stmt {
+	stmts := make([]Stmt, 0)
+	for !p.isAtEnd() {
+		if stmt := p.declaration(); stmt != nil {
+			stmts = append(stmts, stmt)
+		}
+	}
+	return stmts
+}
+
+// ParseExpression 把全部 token 解析为一个表达式, 出错时返回 nil
+func (p *Parser) ParseExpression() (expr Expr) {
 	defer func() {
 		if r := recover(); r != nil {
-			Logger.Errorf("%v", r)
+			if _, ok := r.(ParseError); !ok {
+				panic(r)
+			}
+			expr = nil
 		}
 	}()
-	stmts := make([]Stmt, 0)
-	for !p.isAtEnd() {
-		stmts = append(stmts, p.declaration())
+	expr = p.expression()
+	if !p.isAtEnd() {
+		panic(p.error(p.peek(), "Expect end of expression."))
 	}
-	return stmts
+	return expr
+}
+
+// Lines 每个语句第一个 token 所在的行, 用于调试器的断点和单步执行
+func (p *Parser) Lines() map[Stmt]int {
+	lines := make(map[Stmt]int, len(p.spans))
+	for stmt, span := range p.spans {
+		lines[stmt] = span.first.Line
+	}
+	return lines
+}
+
+// ExpressionOf 如果 stmt 是表达式语句, 返回其中的表达式, REPL 用来回显表达式的值
+func ExpressionOf(stmt Stmt) (Expr, bool) {
+	if s, ok := stmt.(*ExpressionStmt); ok {
+		return s.Expression, true
+	}
+	return nil, false
 }
 
 func (p *Parser) isAtEnd() bool {
@@ -74,26 +117,63 @@ func (p *Parser) expression() Expr {
 	return p.assignment()
 }
 
+// compoundOps 复合赋值和自增自减对应的二元运算
+var compoundOps = map[Token.TokenType]Token.TokenType{
+	Token.PLUS_EQUAL:    Token.PLUS,
+	Token.MINUS_EQUAL:   Token.MINUS,
+	Token.STAR_EQUAL:    Token.STAR,
+	Token.SLASH_EQUAL:   Token.SLASH,
+	Token.PERCENT_EQUAL: Token.PERCENT,
+	Token.PLUS_PLUS:     Token.PLUS,
+	Token.MINUS_MINUS:   Token.MINUS,
+}
+
 func (p *Parser) assignment() Expr {
 	//var a = "before";
 	// a = "value";
-	expr := p.or()            // 左侧表达式匹配之后
-	if p.match(Token.EQUAL) { // 如果下一个是equal, 说明左侧不应该求值, 而作为token表示符号
+	expr := p.or() // 左侧表达式匹配之后
+	// 如果下一个是equal, 说明左侧不应该求值, 而作为token表示符号
+	if p.match(Token.EQUAL, Token.PLUS_EQUAL, Token.MINUS_EQUAL, Token.STAR_EQUAL, Token.SLASH_EQUAL,
+		Token.PERCENT_EQUAL) {
 		equals := p.previous()
 		value := p.assignment()
+		// 普通赋值的 operator 为 nil, 复合赋值先读取原来的值再计算
+		var operator *Token.Token
+		if equals.TType != Token.EQUAL {
+			operator = equals
+		}
 		if v, ok := expr.(*VariableExpr); ok {
 			name := v.name
-			return &AssignmentExpr{name: name, value: value}
+			return &AssignmentExpr{name: name, value: value, operator: operator}
 		}
 		if v, ok := expr.(*GetExpr); ok {
-			return &SetExpr{v.object, v.name, value}
+			return &SetExpr{v.object, v.name, value, operator, false}
 		}
-		content := fmt.Sprintf("Invalid assignment target line: %d.", equals.Line)
-		panic(NewParseError(content))
+		if v, ok := expr.(*IndexExpr); ok {
+			return &SetIndexExpr{v.object, v.bracket, v.index, value, operator, false}
+		}
+		// 只报告错误, 不需要同步
+		p.error(equals, "Invalid assignment target.")
 	}
 	return expr
 }
 
+// increment ++ 和 -- 是加上或者减去 1 的复合赋值, 后缀形式的值是修改之前的值
+func (p *Parser) increment(operator *Token.Token, target Expr, postfix bool) Expr {
+	one := &LiteralExpr{value: 1.0}
+	if v, ok := target.(*VariableExpr); ok {
+		return &AssignmentExpr{v.name, one, operator, postfix}
+	}
+	if v, ok := target.(*GetExpr); ok {
+		return &SetExpr{v.object, v.name, one, operator, postfix}
+	}
+	if v, ok := target.(*IndexExpr); ok {
+		return &SetIndexExpr{v.object, v.bracket, v.index, one, operator, postfix}
+	}
+	p.error(operator, "Invalid increment target.")
+	return target
+}
+
 func (p *Parser) or() Expr {
 	expr := p.and()
 	for p.match(Token.OR) {
@@ -114,14 +194,19 @@ func (p *Parser) and() Expr {
 	return expr
 }
 
-func (p *Parser) statement() Stmt {
+// statement 同时记录语句的范围, 调试器需要知道每个语句所在的行
+func (p *Parser) statement() (stmt Stmt) {
+	first := p.peek()
+	defer func() {
+		if stmt != nil {
+			p.spans[stmt] = stmtSpan{first, p.previous()}
+		}
+	}()
 	if p.match(Token.PRINT) {
 		return p.printStatement()
 	}
 	if p.match(Token.LEFT_BRACE) {
-		return &BlockStmt{
-			statements: p.block(),
-		}
+		return p.blockStatement()
 	}
 	if p.match(Token.IF) {
 		return p.ifStatement()
@@ -135,23 +220,74 @@ func (p *Parser) statement() Stmt {
 	if p.match(Token.RETURN) {
 		return p.returnStatement()
 	}
+	if p.match(Token.THROW) {
+		keyword := p.previous()
+		value := p.expression()
+		p.consume(Token.SEMICOLON, "Expect ';' after thrown value.")
+		return &ThrowStmt{keyword: keyword, value: value}
+	}
+	if p.match(Token.TRY) {
+		return p.tryStatement()
+	}
+	if p.match(Token.BREAK) {
+		keyword := p.previous()
+		p.consume(Token.SEMICOLON, "Expect ';' after 'break'.")
+		return &BreakStmt{keyword: keyword}
+	}
+	if p.match(Token.CONTINUE) {
+		keyword := p.previous()
+		p.consume(Token.SEMICOLON, "Expect ';' after 'continue'.")
+		return &ContinueStmt{keyword: keyword}
+	}
 
 	return p.expressionStatement()
 }
 
+// blockStatement '{' 已经匹配, 块的范围从 '{' 到 '}'
+func (p *Parser) blockStatement() *BlockStmt {
+	leftBrace := p.previous()
+	statements := p.block()
+	block := &BlockStmt{statements: statements, rightBrace: p.previous()}
+	p.spans[block] = stmtSpan{leftBrace, block.rightBrace}
+	return block
+}
+
+// tryStatement catch 和 finally 至少有一个, 它们的内容都必须是块
+func (p *Parser) tryStatement() Stmt {
+	stmt := &TryStmt{keyword: p.previous()}
+	p.consume(Token.LEFT_BRACE, "Expect '{' after 'try'.")
+	stmt.body = p.blockStatement()
+	if p.match(Token.CATCH) {
+		p.consume(Token.LEFT_PAREN, "Expect '(' after 'catch'.")
+		stmt.catchName = p.consume(Token.IDENTIFIER, "Expect variable name after '('.")
+		p.consume(Token.RIGHT_PAREN, "Expect ')' after catch variable.")
+		p.consume(Token.LEFT_BRACE, "Expect '{' after catch clause.")
+		stmt.catchBody = p.blockStatement()
+	}
+	if p.match(Token.FINALLY) {
+		p.consume(Token.LEFT_BRACE, "Expect '{' after 'finally'.")
+		stmt.finallyBody = p.blockStatement()
+	}
+	if stmt.catchBody == nil && stmt.finallyBody == nil {
+		panic(p.error(p.peek(), "Expect 'catch' or 'finally' after try block."))
+	}
+	return stmt
+}
+
 func (p *Parser) returnStatement() Stmt {
 	keyword := p.previous()
 	var value Expr
 	if !p.check(Token.SEMICOLON) {
 		value = p.expression()
 	}
-	p.consume(Token.SEMICOLON, "Expect ; after value.")
+	p.consume(Token.SEMICOLON, "Expect ';' after return value.")
 
 	return &ReturnStmt{keyword: keyword, value: value}
 }
 
 func (p *Parser) forStatement() Stmt {
-	p.consume(Token.LEFT_PAREN, "Expected left '(' after 'for'")
+	keyword := p.previous()
+	p.consume(Token.LEFT_PAREN, "Expect '(' after 'for'.")
 	var initializer Stmt
 	if p.match(Token.SEMICOLON) {
 		initializer = nil
@@ -173,31 +309,13 @@ func (p *Parser) forStatement() Stmt {
 	p.consume(Token.RIGHT_PAREN, "Expect ')' after for clauses.")
 	body := p.statement()
 
-	// 合成while
-	if condition == nil {
-		condition = &LiteralExpr{true}
-	}
-	if increment != nil {
-		body = &BlockStmt{[]Stmt{body, &ExpressionStmt{increment}}}
-	}
-
-	body = &WhileStmt{body: body, condition: condition}
-
-	if initializer != nil {
-		body = &BlockStmt{[]Stmt{initializer, body}}
-	}
-	// 	类似这样的语法
-	// {
-	//	var i := 1
-	// 	while i < 10 {
-	//  	print i;
-	// 		i += 1;
-	// }
-	return body
+	// 不再合成 while, 保留原来的结构, 格式化时可以原样输出
+	return &ForStmt{keyword: keyword, initializer: initializer, condition: condition,
+		increment: increment, body: body}
 }
 
 func (p *Parser) whileStatement() Stmt {
-	p.consume(Token.LEFT_PAREN, "Expected left '(' after 'while'.")
+	p.consume(Token.LEFT_PAREN, "Expect '(' after 'while'.")
 	condition := p.expression()
 	p.consume(Token.RIGHT_PAREN, "Expect ')' after condition.")
 	body := p.statement()
@@ -205,7 +323,7 @@ func (p *Parser) whileStatement() Stmt {
 }
 
 func (p *Parser) ifStatement() Stmt {
-	p.consume(Token.LEFT_PAREN, "Expected left '(' after 'if'.")
+	p.consume(Token.LEFT_PAREN, "Expect '(' after 'if'.")
 	condition := p.expression()
 	p.consume(Token.RIGHT_PAREN, "Expect ')' after if condition.")
 	thenBranch := p.statement()
@@ -218,35 +336,95 @@ func (p *Parser) ifStatement() Stmt {
 	return &IfStmt{condition, thenBranch, elseBranch}
 }
 
-func (p *Parser) declaration() Stmt {
+// 出现语法错误之后丢弃当前的语句, 同步到下一个语句继续解析, 出错的语句返回 nil
+func (p *Parser) declaration() (stmt Stmt) {
 	defer func() {
 		if r := recover(); r != nil {
-			switch r.(type) {
-			case *RuntimeError:
-				err := r.(*RuntimeError)
-				Errors.LoxRuntimeError(err.Token, err.Content)
-			}
-			for p.peek().Lexeme != "\n" && !p.isAtEnd() {
-				p.current += 1
+			if _, ok := r.(ParseError); !ok {
+				panic(r)
 			}
-			// todo synchronized to new line 避免后面的解析失败
-			Logger.Errorf("%v", r)
+			p.synchronize()
+			stmt = nil
 		}
 	}()
 
+	first := p.peek()
 	if p.match(Token.VAR) {
-		return p.varDeclaration()
+		stmt = p.varDeclaration()
 	} else if p.match(Token.FUN) {
-		return p.function("function")
+		stmt = p.function("function")
 	} else if p.match(Token.CLASS) {
-		return p.classDeclaration()
+		stmt = p.classDeclaration()
+	} else if p.match(Token.IMPORT) {
+		stmt = p.importDeclaration()
 	} else {
-		return p.statement()
+		stmt = p.statement()
+	}
+	p.spans[stmt] = stmtSpan{first, p.previous()}
+	return stmt
+}
+
+// synchronize 跳过 token 直到语句的边界: 分号之后, 或者下一个语句的关键字之前
+func (p *Parser) synchronize() {
+	p.advance()
+	for !p.isAtEnd() {
+		if p.previous().TType == Token.SEMICOLON {
+			return
+		}
+		switch p.peek().TType {
+		case Token.CLASS, Token.FUN, Token.VAR, Token.FOR, Token.IF,
+			Token.WHILE, Token.PRINT, Token.RETURN, Token.IMPORT,
+			Token.BREAK, Token.CONTINUE, Token.THROW, Token.TRY:
+			return
+		}
+		p.advance()
+	}
+}
+
+// importDeclaration import "path"; 或者 import name from "path";
+// 省略名字时使用文件名 (不含扩展名) 作为模块的名字
+func (p *Parser) importDeclaration() Stmt {
+	keyword := p.previous()
+	var name *Token.Token
+	if p.match(Token.IDENTIFIER) {
+		name = p.previous()
+		from := p.consume(Token.IDENTIFIER, "Expect 'from' after import name.")
+		if from.Lexeme != "from" {
+			panic(p.error(from, "Expect 'from' after import name."))
+		}
+	}
+	path := p.consume(Token.STRING, "Expect module path string.")
+	p.consume(Token.SEMICOLON, "Expect ';' after import.")
+
+	if name == nil {
+		base := filepath.Base(path.Literal.(string))
+		lexeme := strings.TrimSuffix(base, filepath.Ext(base))
+		if !isIdentifier(lexeme) {
+			p.error(path, "Can't use '"+lexeme+"' as a module name, use 'import name from'.")
+		}
+		name = Token.NewToken(Token.IDENTIFIER, lexeme, nil, path.Line, path.Column, path.Offset)
 	}
+	return &ImportStmt{keyword: keyword, path: path, name: name}
+}
+
+func isIdentifier(name string) bool {
+	if name == "" {
+		return false
+	}
+	if _, ok := Token.KEY_WORDS[name]; ok {
+		return false
+	}
+	for id, c := range name {
+		alpha := c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+		if !alpha && (id == 0 || c < '0' || c > '9') {
+			return false
+		}
+	}
+	return true
 }
 
 func (p *Parser) classDeclaration() Stmt {
-	name := p.consume(Token.IDENTIFIER, "Expected class name.")
+	name := p.consume(Token.IDENTIFIER, "Expect class name.")
 
 	var superClass *VariableExpr
 	if p.match(Token.LESS) {
@@ -254,29 +432,32 @@ func (p *Parser) classDeclaration() Stmt {
 		superClass = &VariableExpr{p.previous()}
 	}
 
-	p.consume(Token.LEFT_BRACE, "Expected '{' before class body.")
+	p.consume(Token.LEFT_BRACE, "Expect '{' before class body.")
 
 	// []functionStmt
 	methods := make([]Stmt, 0)
 	for !p.check(Token.RIGHT_BRACE) && !p.isAtEnd() {
-		methods = append(methods, p.function("method"))
+		first := p.peek()
+		method := p.function("method")
+		p.spans[method] = stmtSpan{first, p.previous()}
+		methods = append(methods, method)
 	}
-	p.consume(Token.RIGHT_BRACE, "Expected '}' after class body.")
+	p.consume(Token.RIGHT_BRACE, "Expect '}' after class body.")
 
 	return &ClassStmt{name: name, methods: methods, superClass: superClass}
 }
 
 func (p *Parser) function(kind string) Stmt {
-	name := p.consume(Token.IDENTIFIER, "Expected "+kind+" name.")
+	name := p.consume(Token.IDENTIFIER, "Expect "+kind+" name.")
 	p.consume(Token.LEFT_PAREN, "Expect '(' after "+kind+" name.")
 	params := make([]*Token.Token, 0)
 	if !p.check(Token.RIGHT_PAREN) {
-		params = append(params, p.consume(Token.IDENTIFIER, "Expected parameter name."))
+		params = append(params, p.consume(Token.IDENTIFIER, "Expect parameter name."))
 		for p.match(Token.COMMA) {
 			if len(params) >= 255 {
 				p.error(p.peek(), "Can't have more than 255 parameters.")
 			}
-			params = append(params, p.consume(Token.IDENTIFIER, "Expected parameter name."))
+			params = append(params, p.consume(Token.IDENTIFIER, "Expect parameter name."))
 		}
 	}
 	p.consume(Token.RIGHT_PAREN, "Expect ')' after parameters.")
@@ -287,7 +468,7 @@ func (p *Parser) function(kind string) Stmt {
 }
 
 func (p *Parser) varDeclaration() Stmt {
-	name := p.consume(Token.IDENTIFIER, "Expected variable name here.")
+	name := p.consume(Token.IDENTIFIER, "Expect variable name.")
 	var initializer Expr
 	if p.match(Token.EQUAL) {
 		initializer = p.expression()
@@ -305,7 +486,9 @@ func (p *Parser) printStatement() Stmt {
 func (p *Parser) block() []Stmt {
 	statements := make([]Stmt, 0)
 	for !p.check(Token.RIGHT_BRACE) && !p.isAtEnd() {
-		statements = append(statements, p.declaration())
+		if stmt := p.declaration(); stmt != nil {
+			statements = append(statements, stmt)
+		}
 	}
 
 	p.consume(Token.RIGHT_BRACE, "Expect '}' after block.")
@@ -314,7 +497,7 @@ func (p *Parser) block() []Stmt {
 
 func (p *Parser) expressionStatement() Stmt {
 	value := p.expression()
-	p.consume(Token.SEMICOLON, "Expect ';' after value.")
+	p.consume(Token.SEMICOLON, "Expect ';' after expression.")
 	return &ExpressionStmt{value}
 }
 
@@ -329,15 +512,56 @@ func (p *Parser) equality() Expr {
 }
 
 func (p *Parser) comparison() Expr {
-	expr := p.term()
+	expr := p.bitOr()
 	for p.match(Token.GREATER, Token.GREATER_EQUAL, Token.LESS, Token.LESS_EQUAL) {
 		op := p.previous()
-		right := p.term()
+		right := p.bitOr()
 		expr = &BinaryExpr{left: expr, operator: op, right: right}
 	}
 	return expr
 }
 
+// bitOr 位运算的优先级低于算术运算, 高于比较运算, 和 Python 一致
+func (p *Parser) bitOr() Expr {
+	expr := p.bitXor()
+	for p.match(Token.PIPE) {
+		op := p.previous()
+		right := p.bitXor()
+		expr = &BinaryExpr{expr, op, right}
+	}
+	return expr
+}
+
+func (p *Parser) bitXor() Expr {
+	expr := p.bitAnd()
+	for p.match(Token.CARET) {
+		op := p.previous()
+		right := p.bitAnd()
+		expr = &BinaryExpr{expr, op, right}
+	}
+	return expr
+}
+
+func (p *Parser) bitAnd() Expr {
+	expr := p.shift()
+	for p.match(Token.AMPERSAND) {
+		op := p.previous()
+		right := p.shift()
+		expr = &BinaryExpr{expr, op, right}
+	}
+	return expr
+}
+
+func (p *Parser) shift() Expr {
+	expr := p.term()
+	for p.match(Token.LESS_LESS, Token.GREATER_GREATER) {
+		op := p.previous()
+		right := p.term()
+		expr = &BinaryExpr{expr, op, right}
+	}
+	return expr
+}
+
 func (p *Parser) term() Expr {
 	expr := p.factor()
 	for p.match(Token.MINUS, Token.PLUS) {
@@ -350,7 +574,7 @@ func (p *Parser) term() Expr {
 
 func (p *Parser) factor() Expr {
 	expr := p.unary()
-	for p.match(Token.SLASH, Token.STAR) {
+	for p.match(Token.SLASH, Token.STAR, Token.PERCENT, Token.TILDE_SLASH) {
 		op := p.previous()
 		right := p.unary()
 		expr = &BinaryExpr{expr, op, right}
@@ -359,13 +583,37 @@ func (p *Parser) factor() Expr {
 }
 
 func (p *Parser) unary() Expr {
-	if p.match(Token.BANG, Token.MINUS) {
+	if p.match(Token.BANG, Token.MINUS, Token.TILDE) {
 		op := p.previous()
 		right := p.unary()
 		return &UnaryExpr{op, right}
 	}
+	if p.match(Token.PLUS_PLUS, Token.MINUS_MINUS) {
+		op := p.previous()
+		return p.increment(op, p.unary(), false)
+	}
+
+	return p.power()
+}
+
+// power ** 的优先级高于一元运算, -2 ** 2 为 -4
+// 右边仍然是 unary, 所以 2 ** -1 合法, 并且 2 ** 3 ** 2 是右结合的
+func (p *Parser) power() Expr {
+	expr := p.postfix()
+	if p.match(Token.STAR_STAR) {
+		op := p.previous()
+		right := p.unary()
+		expr = &BinaryExpr{expr, op, right}
+	}
+	return expr
+}
 
-	return p.call()
+func (p *Parser) postfix() Expr {
+	expr := p.call()
+	if p.match(Token.PLUS_PLUS, Token.MINUS_MINUS) {
+		return p.increment(p.previous(), expr, true)
+	}
+	return expr
 }
 
 func (p *Parser) call() Expr {
@@ -377,6 +625,11 @@ func (p *Parser) call() Expr {
 			name := p.consume(Token.IDENTIFIER,
 				"Expect property name after '.'.")
 			expr = &GetExpr{expr, name}
+		} else if p.match(Token.LEFT_BRACKET) {
+			bracket := p.previous()
+			index := p.expression()
+			p.consume(Token.RIGHT_BRACKET, "Expect ']' after index.")
+			expr = &IndexExpr{expr, bracket, index}
 		} else {
 			break
 		}
@@ -391,7 +644,7 @@ func (p *Parser) finishCall(callee Expr) Expr {
 	if !p.check(Token.RIGHT_PAREN) {
 		arguments = append(arguments, p.expression())
 		for p.match(Token.COMMA) {
-			if len(arguments) > 255 {
+			if len(arguments) >= 255 {
 				p.error(p.peek(), "Can't have more than 255 arguments.")
 			}
 			arguments = append(arguments, p.expression())
@@ -404,27 +657,76 @@ func (p *Parser) finishCall(callee Expr) Expr {
 	return &CallExpr{callee: callee, arguments: arguments, paren: paren}
 }
 
+// list 列表字面量 [a, b, c], 左括号已经被消费
+func (p *Parser) list() Expr {
+	bracket := p.previous()
+	elements := make([]Expr, 0)
+	if !p.check(Token.RIGHT_BRACKET) {
+		elements = append(elements, p.expression())
+		for p.match(Token.COMMA) {
+			if len(elements) >= 255 {
+				p.error(p.peek(), "Can't have more than 255 elements in a list literal.")
+			}
+			elements = append(elements, p.expression())
+		}
+	}
+	p.consume(Token.RIGHT_BRACKET, "Expect ']' after list elements.")
+	return &ListExpr{bracket: bracket, elements: elements}
+}
+
+// mapLiteral 字典字面量 {key: value, ...}, 只出现在表达式中, 语句开头的 { 仍然是 block
+func (p *Parser) mapLiteral() Expr {
+	brace := p.previous()
+	keys := make([]Expr, 0)
+	values := make([]Expr, 0)
+	if !p.check(Token.RIGHT_BRACE) {
+		for {
+			if len(keys) >= 255 {
+				p.error(p.peek(), "Can't have more than 255 entries in a map literal.")
+			}
+			keys = append(keys, p.expression())
+			p.consume(Token.COLON, "Expect ':' after map key.")
+			values = append(values, p.expression())
+			if !p.match(Token.COMMA) {
+				break
+			}
+		}
+	}
+	p.consume(Token.RIGHT_BRACE, "Expect '}' after map entries.")
+	return &MapExpr{brace: brace, keys: keys, values: values}
+}
+
 func (p *Parser) primary() Expr {
 	if p.match(Token.FALSE) {
-		return &LiteralExpr{false}
+		return &LiteralExpr{false, p.previous()}
 	}
 	if p.match(Token.TRUE) {
-		return &LiteralExpr{true}
+		return &LiteralExpr{true, p.previous()}
 	}
 	if p.match(Token.NIL) {
-		return &LiteralExpr{nil}
+		return &LiteralExpr{nil, p.previous()}
 	}
 
 	if p.match(Token.NUMBER, Token.STRING) {
-		return &LiteralExpr{p.previous().Literal}
+		return &LiteralExpr{p.previous().Literal, p.previous()}
+	}
+	// 插值字符串的第一部分以 " 开始, 后面的部分以 } 开始
+	if p.check(Token.INTERPOLATION) && strings.HasPrefix(p.peek().Lexeme, "\"") {
+		return p.interpolation()
 	}
 	if p.match(Token.LEFT_PAREN) {
 		expr := p.expression()
 
-		p.consume(Token.RIGHT_PAREN, "Expect ')' after Expression")
+		p.consume(Token.RIGHT_PAREN, "Expect ')' after expression.")
 
 		return &GroupingExpr{expression: expr}
 	}
+	if p.match(Token.LEFT_BRACKET) {
+		return p.list()
+	}
+	if p.match(Token.LEFT_BRACE) {
+		return p.mapLiteral()
+	}
 	if p.match(Token.IDENTIFIER) {
 		return &VariableExpr{name: p.previous()}
 	}
@@ -439,7 +741,24 @@ func (p *Parser) primary() Expr {
 		return &SuperExpr{keyword, method}
 	}
 	// 最终匹配到terminal符号, 失败说明当前不是合法的表达式
-	panic(p.error(p.peek(), "Expect Expression"))
+	panic(p.error(p.peek(), "Expect expression."))
+}
+
+// interpolation "a${x}b" 转换为 "a", x 和 "b" 的拼接, 拼接时两边都转换为 print 输出的字符串
+// 每一部分都保留在 LiteralExpr 中, 格式化时用它们的 lexeme 还原源码
+func (p *Parser) interpolation() Expr {
+	part := p.advance()
+	var expr Expr = &LiteralExpr{part.Literal, part}
+	for strings.HasSuffix(part.Lexeme, "${") {
+		operator := Token.NewToken(Token.INTERPOLATION, "${}", nil, part.Line, part.Column, part.Offset)
+		expr = &BinaryExpr{expr, operator, p.expression()}
+		if !p.check(Token.INTERPOLATION) || !strings.HasPrefix(p.peek().Lexeme, "}") {
+			panic(p.error(p.peek(), "Expect '}' after interpolation."))
+		}
+		part = p.advance()
+		expr = &BinaryExpr{expr, operator, &LiteralExpr{part.Literal, part}}
+	}
+	return expr
 }
 
 func (p *Parser) consume(tokenType Token.TokenType, mess string) *Token.Token {
@@ -451,8 +770,8 @@ func (p *Parser) consume(tokenType Token.TokenType, mess string) *Token.Token {
 }
 
 func (p *Parser) error(token *Token.Token, mess string) interface{} {
-	data := Errors.LoxError(token, mess)
-	return NewParseError(data)
+	err := p.reporter.LoxError(token, mess)
+	return NewParseError(err.Error())
 }
 
 type ParseError struct {
@@ -14,14 +14,20 @@ type Resolver struct {
 	scopes          []map[string]bool
 	currentFunction FunctionType
 	currentClass    ClassType
+	// 当前函数中包围着的循环层数, break 和 continue 只能出现在循环中
+	loopDepth int
+
+	reporter *Errors.Reporter
+	// 非 nil 时记录声明和引用, 用于编辑器和静态检查, 见 Analyze
+	symbols *symbolRecorder
 }
 
 func (r *Resolver) VisitSuperExpr(superexpr Expr) interface{} {
 	class := superexpr.(*SuperExpr)
 	if r.currentClass == NoneClass {
-		Errors.LoxError(class.keyword, "Can't use 'super' outside of a class.")
+		r.reporter.LoxError(class.keyword, "Can't use 'super' outside of a class.")
 	} else if r.currentClass != SUBCLASS {
-		Errors.LoxError(class.keyword, "Can't use 'super' in a class with no superclass.")
+		r.reporter.LoxError(class.keyword, "Can't use 'super' in a class with no superclass.")
 	}
 	r.resolveLocal(class, class.keyword)
 	return nil
@@ -30,7 +36,7 @@ func (r *Resolver) VisitSuperExpr(superexpr Expr) interface{} {
 func (r *Resolver) VisitThisExpr(thisexpr Expr) interface{} {
 	class := thisexpr.(*ThisExpr)
 	if r.currentClass == NoneClass {
-		Errors.LoxError(class.keyword, ""+
+		r.reporter.LoxError(class.keyword, ""+
 			"Can't use 'this' outside of a class.")
 		return nil
 	}
@@ -58,11 +64,15 @@ func (r *Resolver) VisitClassStmt(classstmt Stmt) interface{} {
 
 	r.declare(class.name)
 	r.define(class.name)
+	symbol := r.record(class.name, SymbolClass)
+	if symbol != nil && class.superClass != nil {
+		symbol.SuperClass = class.superClass.name
+	}
 
 	// 循环依赖可以最后添加图检测环的算法
 	if class.superClass != nil &&
 		class.name.Lexeme == class.superClass.name.Lexeme {
-		Errors.LoxError(class.superClass.name,
+		r.reporter.LoxError(class.superClass.name,
 			"A class can't inherit from itself.")
 	}
 
@@ -70,11 +80,11 @@ func (r *Resolver) VisitClassStmt(classstmt Stmt) interface{} {
 		r.currentClass = SUBCLASS
 		r.resolveExpr(class.superClass)
 
-		r.beginScope()
+		r.beginScope(class)
 		r.peek()["super"] = true
 	}
 	// for this pointer and methods
-	r.beginScope()
+	r.beginScope(class)
 	r.peek()["this"] = true
 
 	for _, item := range class.methods {
@@ -82,6 +92,9 @@ func (r *Resolver) VisitClassStmt(classstmt Stmt) interface{} {
 		if item.(*FunctionStmt).name.Lexeme == "init" {
 			declaration = ISINITIALIZER
 		}
+		if symbol != nil {
+			r.symbols.method(symbol, item.(*FunctionStmt))
+		}
 		r.resolveFunction(item, declaration)
 	}
 	r.endScope()
@@ -100,18 +113,33 @@ func (r *Resolver) VisitFunctionStmt(stmt Stmt) interface{} {
 	class := stmt.(*FunctionStmt)
 	r.declare(class.name)
 	r.define(class.name)
+	if symbol := r.record(class.name, SymbolFunction); symbol != nil {
+		symbol.Params = class.params
+	}
 
 	r.resolveFunction(stmt, FUNCTION)
 	return nil
 }
 
+// import 只能出现在顶层, 模块在 import 执行时加载, 绑定的名字是全局变量
+func (r *Resolver) VisitImportStmt(stmt Stmt) interface{} {
+	class := stmt.(*ImportStmt)
+	if len(r.scopes) != 0 {
+		r.reporter.LoxError(class.keyword, "Can't import inside a block or function.")
+	}
+	if symbol := r.record(class.name, SymbolImport); symbol != nil {
+		symbol.Path = class.path.Literal.(string)
+	}
+	return nil
+}
+
 func (r *Resolver) VisitVariableExpr(expr Expr) interface{} {
 	class := expr.(*VariableExpr)
 	if len(r.scopes) != 0 {
 		if v, ok := r.peek()[class.name.Lexeme]; ok && !v {
 			// var is initialized in its own initializer
-			Errors.LoxError(class.name, ""+
-				"Can't read local var in its own initializer.")
+			r.reporter.LoxError(class.name, ""+
+				"Can't read local variable in its own initializer.")
 		}
 	}
 	r.resolveLocal(class, class.name)
@@ -128,7 +156,7 @@ func (r *Resolver) VisitAssignmentExpr(expr Expr) interface{} {
 
 func (r *Resolver) VisitBlockStmt(stmt Stmt) interface{} {
 	class := stmt.(*BlockStmt)
-	r.beginScope()
+	r.beginScope(class)
 	r.ResolveStmts(class.statements)
 	r.endScope()
 	return nil
@@ -141,6 +169,7 @@ func (r *Resolver) VisitVariableStmt(stmt Stmt) interface{} {
 		r.resolveExpr(class.initializer)
 	}
 	r.define(class.name)
+	r.record(class.name, SymbolVariable)
 	// 将声明和定义分开的原因
 	//var a = "outer";
 	//{
@@ -156,7 +185,7 @@ func (r *Resolver) declare(name *Token.Token) {
 	scope := r.peek()
 	// 只是声明, 没有赋值
 	if _, ok := scope[name.Lexeme]; ok {
-		Errors.LoxError(name, ""+
+		r.reporter.LoxError(name, ""+
 			"Already a variable with this name in this scope.")
 	} else {
 		scope[name.Lexeme] = false
@@ -171,12 +200,27 @@ func (r *Resolver) define(name *Token.Token) {
 	scope[name.Lexeme] = true
 }
 
-func (r *Resolver) beginScope() {
+// beginScope owner 是创建作用域的语句, 分析模式下用来确定作用域在源码中的范围
+func (r *Resolver) beginScope(owner Stmt) {
 	r.scopes = append(r.scopes, make(map[string]bool))
+	if r.symbols != nil {
+		r.symbols.push(owner)
+	}
 }
 
 func (r *Resolver) endScope() {
 	r.scopes = r.scopes[:len(r.scopes)-1]
+	if r.symbols != nil {
+		r.symbols.pop()
+	}
+}
+
+// record 分析模式下记录一个声明, 否则返回 nil
+func (r *Resolver) record(name *Token.Token, kind SymbolKind) *Symbol {
+	if r.symbols == nil {
+		return nil
+	}
+	return r.symbols.declare(name, kind)
 }
 
 func (r *Resolver) ResolveStmts(stmts []Stmt) {
@@ -205,29 +249,39 @@ func (r *Resolver) resolveLocal(expr Expr, token *Token.Token) {
 	// [0, 1, 2, ..., n-1]
 	// find in i
 	// n - 1 - i
+	// 从内向外查找, 最近的作用域遮蔽外层的同名变量
 	// if resolve all but not found, it's in global.
+	depth := -1
 	for i := len(r.scopes) - 1; i >= 0; i-- {
 		if _, ok := r.scopes[i][token.Lexeme]; ok {
-			r.resolveDeep(expr, len(r.scopes)-1-i)
+			depth = len(r.scopes) - 1 - i
+			r.resolveDeep(expr, depth)
+			break
 		}
 	}
+	// this 和 super 不是符号, 复合赋值在写入之前读取变量
+	if r.symbols != nil && token.TType == Token.IDENTIFIER {
+		assignment, ok := expr.(*AssignmentExpr)
+		r.symbols.use(token, depth, ok && assignment.operator == nil)
+	}
 }
 
 func (r *Resolver) resolveFunction(stmt Stmt, functionType FunctionType) {
 	class := stmt.(*FunctionStmt)
-	enclosingFunction := r.currentFunction
-	r.currentFunction = functionType
+	enclosingFunction, enclosingLoop := r.currentFunction, r.loopDepth
+	r.currentFunction, r.loopDepth = functionType, 0
 
-	r.beginScope()
+	r.beginScope(stmt)
 	for _, token := range class.params {
 		r.declare(token)
 		r.define(token)
+		r.record(token, SymbolParameter)
 	}
 	r.ResolveStmts(class.body)
 
 	r.endScope()
 
-	r.currentFunction = enclosingFunction
+	r.currentFunction, r.loopDepth = enclosingFunction, enclosingLoop
 }
 
 // 下面不涉及变量和作用域的操作, 但是需要重写进行遍历
@@ -257,13 +311,13 @@ func (r *Resolver) VisitPrintStmt(stmt Stmt) interface{} {
 func (r *Resolver) VisitReturnStmt(stmt Stmt) interface{} {
 	class := stmt.(*ReturnStmt)
 	if r.currentFunction == None {
-		Errors.LoxError(class.keyword, "Can't return from top-level code.")
+		r.reporter.LoxError(class.keyword, "Can't return from top-level code.")
 	}
 
 	if class.value != nil {
 		if r.currentFunction == ISINITIALIZER {
-			Errors.LoxError(class.keyword, "Can't return a value"+
-				" from an initializer")
+			r.reporter.LoxError(class.keyword, "Can't return a value"+
+				" from an initializer.")
 		}
 		r.resolveExpr(class.value)
 	}
@@ -273,7 +327,68 @@ func (r *Resolver) VisitReturnStmt(stmt Stmt) interface{} {
 func (r *Resolver) VisitWhileStmt(stmt Stmt) interface{} {
 	class := stmt.(*WhileStmt)
 	r.resolveExpr(class.condition)
+	r.loopDepth++
+	r.resolveStmt(class.body)
+	r.loopDepth--
+	return nil
+}
+
+func (r *Resolver) VisitForStmt(stmt Stmt) interface{} {
+	class := stmt.(*ForStmt)
+	r.beginScope(class)
+	if class.initializer != nil {
+		r.resolveStmt(class.initializer)
+	}
+	if class.condition != nil {
+		r.resolveExpr(class.condition)
+	}
+	if class.increment != nil {
+		r.resolveExpr(class.increment)
+	}
+	r.loopDepth++
+	r.resolveStmt(class.body)
+	r.loopDepth--
+	r.endScope()
+	return nil
+}
+
+func (r *Resolver) VisitThrowStmt(stmt Stmt) interface{} {
+	class := stmt.(*ThrowStmt)
+	r.resolveExpr(class.value)
+	return nil
+}
+
+// VisitTryStmt catch 的变量在自己的作用域中, catch 的块在它里面
+func (r *Resolver) VisitTryStmt(stmt Stmt) interface{} {
+	class := stmt.(*TryStmt)
 	r.resolveStmt(class.body)
+	if class.catchBody != nil {
+		r.beginScope(class.catchBody)
+		r.declare(class.catchName)
+		r.define(class.catchName)
+		r.record(class.catchName, SymbolVariable)
+		r.resolveStmt(class.catchBody)
+		r.endScope()
+	}
+	if class.finallyBody != nil {
+		r.resolveStmt(class.finallyBody)
+	}
+	return nil
+}
+
+func (r *Resolver) VisitBreakStmt(stmt Stmt) interface{} {
+	class := stmt.(*BreakStmt)
+	if r.loopDepth == 0 {
+		r.reporter.LoxError(class.keyword, "Can't use 'break' outside of a loop.")
+	}
+	return nil
+}
+
+func (r *Resolver) VisitContinueStmt(stmt Stmt) interface{} {
+	class := stmt.(*ContinueStmt)
+	if r.loopDepth == 0 {
+		r.reporter.LoxError(class.keyword, "Can't use 'continue' outside of a loop.")
+	}
 	return nil
 }
 
@@ -287,9 +402,48 @@ func (r *Resolver) VisitCallExpr(expr Expr) interface{} {
 	return nil
 }
 
+func (r *Resolver) VisitListExpr(expr Expr) interface{} {
+	class := expr.(*ListExpr)
+	for _, item := range class.elements {
+		r.resolveExpr(item)
+	}
+	return nil
+}
+
+func (r *Resolver) VisitMapExpr(expr Expr) interface{} {
+	class := expr.(*MapExpr)
+	for id := range class.keys {
+		r.resolveExpr(class.keys[id])
+		r.resolveExpr(class.values[id])
+	}
+	return nil
+}
+
+func (r *Resolver) VisitIndexExpr(expr Expr) interface{} {
+	class := expr.(*IndexExpr)
+	r.resolveExpr(class.object)
+	r.resolveExpr(class.index)
+	return nil
+}
+
+func (r *Resolver) VisitSetIndexExpr(expr Expr) interface{} {
+	class := expr.(*SetIndexExpr)
+	r.resolveExpr(class.object)
+	r.resolveExpr(class.index)
+	r.resolveExpr(class.value)
+	return nil
+}
+
+func (r *Resolver) VisitBinaryExpr(expr Expr) interface{} {
+	class := expr.(*BinaryExpr)
+	r.resolveExpr(class.left)
+	r.resolveExpr(class.right)
+	return nil
+}
+
 func (r *Resolver) VisitGroupingExpr(expr Expr) interface{} {
 	class := expr.(*GroupingExpr)
-	r.resolveExpr(class)
+	r.resolveExpr(class.expression)
 	return nil
 }
 
@@ -310,12 +464,12 @@ func (r *Resolver) VisitUnaryExpr(expr Expr) interface{} {
 	return nil
 }
 
-func NewResolver(i *Interpreter) *Resolver {
+func NewResolver(i *Interpreter, reporter *Errors.Reporter) *Resolver {
 	scopes := make([]map[string]bool, 0)
 	//scopes[0] = make(map[string]bool) // 代表全局?
 	// 用于检测return语句在当前情况是否可行
 	return &Resolver{i, scopes,
-		None, NoneClass}
+		None, NoneClass, 0, reporter, nil}
 }
 
 type FunctionType int32
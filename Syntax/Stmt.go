@@ -14,9 +14,15 @@ type VisitorStmt interface {
 	VisitBlockStmt(blockstmt Stmt) interface{}
 	VisitClassStmt(classstmt Stmt) interface{}
 	VisitWhileStmt(whilestmt Stmt) interface{}
+	VisitForStmt(forstmt Stmt) interface{}
 	VisitIfStmt(ifstmt Stmt) interface{}
 	VisitReturnStmt(returnstmt Stmt) interface{}
+	VisitBreakStmt(breakstmt Stmt) interface{}
+	VisitContinueStmt(continuestmt Stmt) interface{}
+	VisitThrowStmt(throwstmt Stmt) interface{}
+	VisitTryStmt(trystmt Stmt) interface{}
 	VisitFunctionStmt(functionstmt Stmt) interface{}
+	VisitImportStmt(importstmt Stmt) interface{}
 }
 type ExpressionStmt struct {
 	Expression Expr
@@ -45,6 +51,7 @@ func (variablestmt *VariableStmt) Accept(visitor VisitorStmt) interface{} {
 
 type BlockStmt struct {
 	statements []Stmt
+	rightBrace *Token.Token
 }
 
 func (blockstmt *BlockStmt) Accept(visitor VisitorStmt) interface{} {
@@ -70,6 +77,18 @@ func (whilestmt *WhileStmt) Accept(visitor VisitorStmt) interface{} {
 	return visitor.VisitWhileStmt(whilestmt)
 }
 
+type ForStmt struct {
+	keyword     *Token.Token
+	initializer Stmt
+	condition   Expr
+	increment   Expr
+	body        Stmt
+}
+
+func (forstmt *ForStmt) Accept(visitor VisitorStmt) interface{} {
+	return visitor.VisitForStmt(forstmt)
+}
+
 type IfStmt struct {
 	condition  Expr
 	thenBranch Stmt
@@ -89,6 +108,43 @@ func (returnstmt *ReturnStmt) Accept(visitor VisitorStmt) interface{} {
 	return visitor.VisitReturnStmt(returnstmt)
 }
 
+type BreakStmt struct {
+	keyword *Token.Token
+}
+
+func (breakstmt *BreakStmt) Accept(visitor VisitorStmt) interface{} {
+	return visitor.VisitBreakStmt(breakstmt)
+}
+
+type ContinueStmt struct {
+	keyword *Token.Token
+}
+
+func (continuestmt *ContinueStmt) Accept(visitor VisitorStmt) interface{} {
+	return visitor.VisitContinueStmt(continuestmt)
+}
+
+type ThrowStmt struct {
+	keyword *Token.Token
+	value   Expr
+}
+
+func (throwstmt *ThrowStmt) Accept(visitor VisitorStmt) interface{} {
+	return visitor.VisitThrowStmt(throwstmt)
+}
+
+type TryStmt struct {
+	keyword     *Token.Token
+	body        *BlockStmt
+	catchName   *Token.Token
+	catchBody   *BlockStmt
+	finallyBody *BlockStmt
+}
+
+func (trystmt *TryStmt) Accept(visitor VisitorStmt) interface{} {
+	return visitor.VisitTryStmt(trystmt)
+}
+
 type FunctionStmt struct {
 	name   *Token.Token
 	params []*Token.Token
@@ -98,3 +154,13 @@ type FunctionStmt struct {
 func (functionstmt *FunctionStmt) Accept(visitor VisitorStmt) interface{} {
 	return visitor.VisitFunctionStmt(functionstmt)
 }
+
+type ImportStmt struct {
+	keyword *Token.Token
+	path    *Token.Token
+	name    *Token.Token
+}
+
+func (importstmt *ImportStmt) Accept(visitor VisitorStmt) interface{} {
+	return visitor.VisitImportStmt(importstmt)
+}
@@ -0,0 +1,232 @@
+package Syntax
+
+import (
+	"github.com/trueabc/lox/Errors"
+	"github.com/trueabc/lox/Token"
+	"io"
+	"sort"
+)
+
+// SymbolKind 声明的种类
+type SymbolKind int
+
+const (
+	SymbolVariable SymbolKind = iota
+	SymbolParameter
+	SymbolFunction
+	SymbolClass
+	SymbolMethod
+	SymbolImport
+	SymbolNative // native 函数和模块, 没有源码中的位置
+)
+
+func (k SymbolKind) String() string {
+	return [...]string{"variable", "parameter", "function", "class", "method", "import", "native"}[k]
+}
+
+// Symbol 源码中的一个声明, 以及所有读取和赋值它的 token
+type Symbol struct {
+	Name *Token.Token
+	Kind SymbolKind
+	// 函数和方法的参数
+	Params []*Token.Token
+	// 类的父类和方法, 方法所在的类
+	SuperClass *Token.Token
+	Methods    []*Symbol
+	Class      *Symbol
+	// 导入的模块路径
+	Path string
+	// 读取它的 token, 复合赋值和自增自减也会读取; Writes 是普通赋值的目标
+	References []*Token.Token
+	Writes     []*Token.Token
+	Global     bool
+}
+
+// Scope 一个作用域在源码中的范围, 根作用域是全局作用域
+type Scope struct {
+	Start, End int
+	Parent     *Scope
+	Children   []*Scope
+	Symbols    []*Symbol
+	names      map[string]*Symbol
+}
+
+// Analysis 编辑器和静态检查使用的分析结果, 源码有语法错误时仍然分析能解析的部分
+type Analysis struct {
+	Stmts       []Stmt
+	Tokens      []*Token.Token
+	Comments    []*Token.Token
+	Diagnostics Errors.Diagnostics
+	// 所有声明, 按 Resolver 访问的顺序
+	Symbols []*Symbol
+	Root    *Scope
+	// 找不到声明的全局变量引用
+	Unresolved []*Token.Token
+
+	uses     map[*Token.Token]*Symbol
+	spans    map[Stmt]stmtSpan
+	reporter *Errors.Reporter
+}
+
+// Analyze 词法分析, 语法分析和 Resolver 的检查, 同时记录声明, 引用和作用域
+func Analyze(source, file string) *Analysis {
+	reporter := Errors.NewReporter(file, source)
+	scanner := Token.NewScanner(source, reporter)
+	tokens := scanner.ScanTokens()
+	parser := NewParser(tokens, reporter)
+	stmts := parser.Parse()
+
+	recorder := newSymbolRecorder(parser.spans, len(source))
+	resolver := NewResolver(NewInterpreter(io.Discard, io.Discard), reporter)
+	resolver.symbols = recorder
+	resolver.ResolveStmts(stmts)
+	recorder.bindGlobals()
+
+	return &Analysis{Stmts: stmts, Tokens: tokens, Comments: scanner.Comments(),
+		Diagnostics: reporter.Diagnostics, Symbols: recorder.symbols, Root: recorder.root,
+		Unresolved: recorder.unresolved, uses: recorder.uses, spans: parser.spans, reporter: reporter}
+}
+
+// TokenAt offset 所在的 token, 光标在 token 末尾时也算在其中
+func (a *Analysis) TokenAt(offset int) *Token.Token {
+	index := sort.Search(len(a.Tokens), func(id int) bool {
+		return a.Tokens[id].End() >= offset
+	})
+	if index == len(a.Tokens) || a.Tokens[index].Offset > offset || a.Tokens[index].TType == Token.EOF {
+		return nil
+	}
+	return a.Tokens[index]
+}
+
+// SymbolOf token 声明或者引用的符号
+func (a *Analysis) SymbolOf(token *Token.Token) *Symbol {
+	return a.uses[token]
+}
+
+// Visible offset 处可以使用的符号, 内层的声明覆盖外层的同名声明
+// 局部变量只有在声明之后才可见, 全局变量在函数中可以先使用后声明
+func (a *Analysis) Visible(offset int) []*Symbol {
+	scope := a.Root
+	for found := true; found; {
+		found = false
+		for _, child := range scope.Children {
+			if child.Start <= offset && offset <= child.End {
+				scope, found = child, true
+				break
+			}
+		}
+	}
+	seen := make(map[string]bool)
+	symbols := make([]*Symbol, 0)
+	for ; scope != nil; scope = scope.Parent {
+		for _, symbol := range scope.Symbols {
+			if seen[symbol.Name.Lexeme] || (!symbol.Global && symbol.Name.Offset > offset) {
+				continue
+			}
+			seen[symbol.Name.Lexeme] = true
+			symbols = append(symbols, symbol)
+		}
+	}
+	for _, name := range nativeNames() {
+		if !seen[name] {
+			symbols = append(symbols, &Symbol{Name: Token.NewToken(Token.IDENTIFIER, name, nil, 0, 0, 0),
+				Kind: SymbolNative, Global: true})
+		}
+	}
+	return symbols
+}
+
+// symbolRecorder Resolver 在分析模式下记录符号, 作用域栈与 Resolver.scopes 一一对应
+type symbolRecorder struct {
+	spans      map[Stmt]stmtSpan
+	root       *Scope
+	stack      []*Scope
+	symbols    []*Symbol
+	uses       map[*Token.Token]*Symbol
+	globals    []symbolUse // 等待在最后绑定的全局变量引用
+	unresolved []*Token.Token
+}
+
+type symbolUse struct {
+	name  *Token.Token
+	write bool
+}
+
+func newSymbolRecorder(spans map[Stmt]stmtSpan, length int) *symbolRecorder {
+	root := &Scope{Start: 0, End: length, names: make(map[string]*Symbol)}
+	return &symbolRecorder{spans: spans, root: root, stack: []*Scope{root},
+		uses: make(map[*Token.Token]*Symbol)}
+}
+
+func (s *symbolRecorder) current() *Scope {
+	return s.stack[len(s.stack)-1]
+}
+
+// push 进入新的作用域, owner 的范围来自解析器, 没有记录范围的语句使用外层的范围
+func (s *symbolRecorder) push(owner Stmt) {
+	parent := s.current()
+	scope := &Scope{Start: parent.Start, End: parent.End, Parent: parent, names: make(map[string]*Symbol)}
+	if span, ok := s.spans[owner]; ok {
+		scope.Start, scope.End = span.first.Offset, span.last.End()
+	}
+	parent.Children = append(parent.Children, scope)
+	s.stack = append(s.stack, scope)
+}
+
+func (s *symbolRecorder) pop() {
+	s.stack = s.stack[:len(s.stack)-1]
+}
+
+// method 方法不是变量, 只记录在类中, 用于 hover 和补全
+func (s *symbolRecorder) method(class *Symbol, stmt *FunctionStmt) {
+	symbol := &Symbol{Name: stmt.name, Kind: SymbolMethod, Params: stmt.params, Class: class}
+	class.Methods = append(class.Methods, symbol)
+	s.symbols = append(s.symbols, symbol)
+	s.uses[stmt.name] = symbol
+}
+
+func (s *symbolRecorder) declare(name *Token.Token, kind SymbolKind) *Symbol {
+	scope := s.current()
+	symbol := &Symbol{Name: name, Kind: kind, Global: scope == s.root}
+	scope.Symbols = append(scope.Symbols, symbol)
+	// 全局变量可以重复声明, 引用绑定到第一个声明
+	if _, ok := scope.names[name.Lexeme]; !ok {
+		scope.names[name.Lexeme] = symbol
+	}
+	s.symbols = append(s.symbols, symbol)
+	s.uses[name] = symbol
+	return symbol
+}
+
+// use 记录对变量的引用, depth 是 Resolver 找到的作用域深度, -1 表示全局变量
+// write 表示 name 是普通赋值的目标, 不读取变量的值
+func (s *symbolRecorder) use(name *Token.Token, depth int, write bool) {
+	if depth < 0 {
+		s.globals = append(s.globals, symbolUse{name: name, write: write})
+		return
+	}
+	scope := s.stack[len(s.stack)-1-depth]
+	if symbol, ok := scope.names[name.Lexeme]; ok {
+		s.bind(symbol, name, write)
+	}
+}
+
+func (s *symbolRecorder) bind(symbol *Symbol, name *Token.Token, write bool) {
+	if write {
+		symbol.Writes = append(symbol.Writes, name)
+	} else {
+		symbol.References = append(symbol.References, name)
+	}
+	s.uses[name] = symbol
+}
+
+// bindGlobals 全局变量的引用在整个文件分析完之后绑定, 函数可以引用在它之后声明的全局变量
+func (s *symbolRecorder) bindGlobals() {
+	for _, use := range s.globals {
+		if symbol, ok := s.root.names[use.name.Lexeme]; ok {
+			s.bind(symbol, use.name, use.write)
+		} else if !isNative(use.name.Lexeme) {
+			s.unresolved = append(s.unresolved, use.name)
+		}
+	}
+}
@@ -191,3 +191,43 @@ operator       → "==" | "!=" | "<" | "<=" | ">" | ">="
 // 包括继承关系的类声明
 // classDecl      → "class" IDENTIFIER ( "<" IDENTIFIER )?
 //                 "{" function* "}" ;
+
+// 提前结束循环, 只能出现在 while 和 for 的循环体中, 由 Resolver 检查
+//statement      → exprStmt | forStmt | ifStmt | printStmt | returnStmt
+//| breakStmt | continueStmt
+//| whileStmt
+//| block ;
+//
+//breakStmt      → "break" ";" ;
+//continueStmt   → "continue" ";" ;
+
+// 异常, catch 得到 throw 的值, 运行时错误转换为带有 message, line 和 stack 的错误对象
+//statement      → ... | throwStmt | tryStmt ;
+//
+//throwStmt      → "throw" expression ";" ;
+//tryStmt        → "try" block ( "catch" "(" IDENTIFIER ")" block )?
+//                 ( "finally" block )? ;
+
+// 取模, 乘方和位运算, 位运算的操作数必须是整数, 除以 0 和对 0 取模是运行时错误
+// // 是注释, 所以向下取整的除法使用运算符 ~/, 优先级和 / 相同
+//comparison     → bitOr ( ( ">" | ">=" | "<" | "<=" ) bitOr )* ;
+//bitOr          → bitXor ( "|" bitXor )* ;
+//bitXor         → bitAnd ( "^" bitAnd )* ;
+//bitAnd         → shift ( "&" shift )* ;
+//shift          → term ( ( "<<" | ">>" ) term )* ;
+//factor         → unary ( ( "/" | "*" | "%" | "~/" ) unary )* ;
+//unary          → ( "!" | "-" | "~" ) unary | power ;
+//power          → call ( "**" unary )? ;
+
+// 复合赋值和自增自减, 目标可以是变量, 属性或者下标, 对象和下标只求值一次
+//assignment     → ( ( call "." )? IDENTIFIER | call "[" expression "]" )
+//                 ( "=" | "+=" | "-=" | "*=" | "/=" | "%=" ) assignment
+//| logic_or ;
+//unary          → ( "!" | "-" | "~" ) unary | ( "++" | "--" ) unary | power ;
+//power          → postfix ( "**" unary )? ;
+//postfix        → call ( "++" | "--" )? ;
+
+// 字符串中的转义 \n \t \r \0 \" \\ \$ 和 \u{...}, 以及插值 "a${x}b"
+// 插值由 Parser 转换为 "a", x 和 "b" 的拼接, 值的格式和 print 一致
+//primary        → ... | interpolation ;
+//interpolation  → INTERPOLATION expression ( INTERPOLATION expression )* INTERPOLATION ;
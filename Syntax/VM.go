@@ -0,0 +1,892 @@
+package Syntax
+
+import (
+	"errors"
+	"fmt"
+	"github.com/trueabc/lox/Errors"
+	"io"
+)
+
+// VM 执行 Compiler 生成的字节码, 基于栈的虚拟机
+// 局部变量保存在栈上, 闭包通过 upvalue 捕获, 与 clox 的实现一致
+
+type vmFrame struct {
+	closure *ObjClosure
+	ip      int
+	slots   int // 该帧在栈上的起始位置
+}
+
+// vmHandler OP_TRY 注册的异常处理器, 出错时回到 frame 帧的 ip, 栈恢复到 sp
+type vmHandler struct {
+	frame int
+	sp    int
+	ip    int
+}
+
+type VM struct {
+	frames []vmFrame
+	stack  []Value
+	sp     int
+	// 异常处理器, 最内层在最后
+	handlers []vmHandler
+
+	globals map[string]Value
+	// 宿主程序通过 RegisterNative 和 Define 添加的全局变量, import 的模块中同样可见
+	hosted       map[string]Value
+	openUpvalues *ObjUpvalue // 按照栈上的位置从高到低排列
+
+	stdout io.Writer
+	stderr io.Writer
+	// 注册表中的 native 函数以 Interpreter 为参数, 输出也使用 host 的 stdout 和 stderr
+	host *Interpreter
+}
+
+func NewVM(host *Interpreter) *VM {
+	vm := &VM{
+		frames: make([]vmFrame, 0, 64),
+		stack:  make([]Value, 256),
+		stdout: host.Stdout(),
+		stderr: host.Stderr(),
+		host:   host,
+	}
+	vm.globals = vm.moduleGlobals()
+	return vm
+}
+
+// DefineNative 注册一个 native 函数到全局作用域
+func (vm *VM) DefineNative(name string, arity int, function NativeFn) {
+	vm.globals[name] = ObjValue(&ObjNative{name: name, arity: arity, function: function})
+}
+
+// RegisterNative 只在这个虚拟机中定义 native 函数
+func (vm *VM) RegisterNative(name string, arity int, function NativeFunc) {
+	vm.Define(name, &NativeFunction{name: name, arity: arity, function: function})
+}
+
+// Define 在全局作用域定义变量, 用于宿主程序注入值
+func (vm *VM) Define(name string, value interface{}) {
+	if vm.hosted == nil {
+		vm.hosted = make(map[string]Value)
+	}
+	vm.hosted[name] = vm.valueOf(value)
+	vm.globals[name] = vm.hosted[name]
+}
+
+// moduleGlobals 一个模块的全局变量, 包括注册表中的 native 和宿主程序添加的变量
+// 入口文件和 import 的模块都从这里开始
+func (vm *VM) moduleGlobals() map[string]Value {
+	globals := make(map[string]Value)
+	defineNatives(func(name string, value interface{}) {
+		globals[name] = vm.valueOf(value)
+	})
+	for name, value := range vm.hosted {
+		globals[name] = value
+	}
+	return globals
+}
+
+// valueOf 在 ValueOf 的基础上转换树遍历解释器的 native 函数和模块
+func (vm *VM) valueOf(value interface{}) Value {
+	switch v := value.(type) {
+	case *NativeFunction:
+		return ObjValue(vm.wrapNative(v))
+	case *LoxModule:
+		module := &ObjModule{name: v.name, members: make(map[string]Value, len(v.members))}
+		for name, member := range v.members {
+			module.members[name] = vm.valueOf(member)
+		}
+		return ObjValue(module)
+	}
+	return ValueOf(value)
+}
+
+// wrapNative 参数转换为 interface{} 之后调用, 返回值再转换回 Value
+func (vm *VM) wrapNative(native *NativeFunction) *ObjNative {
+	return &ObjNative{name: native.name, arity: native.arity, function: func(args []Value) (Value, error) {
+		values := make([]interface{}, len(args))
+		for k, arg := range args {
+			values[k] = arg.Interface()
+		}
+		result, err := native.function(vm.host, values)
+		if err != nil {
+			return NilValue, err
+		}
+		return vm.valueOf(result), nil
+	}}
+}
+
+// Global 读取全局变量
+func (vm *VM) Global(name string) (interface{}, bool) {
+	value, ok := vm.globals[name]
+	return value.Interface(), ok
+}
+
+// Globals 所有全局变量的副本
+func (vm *VM) Globals() map[string]interface{} {
+	globals := make(map[string]interface{}, len(vm.globals))
+	for name, value := range vm.globals {
+		globals[name] = value.Interface()
+	}
+	return globals
+}
+
+// Evaluate 执行 CompileExpression 编译的函数, 返回表达式的值
+func (vm *VM) Evaluate(function *ObjFunction) (interface{}, error) {
+	if err := vm.Interpret(function); err != nil {
+		return nil, err
+	}
+	// 最外层的 script 返回之后, 返回值留在栈底
+	return vm.stack[0].Interface(), nil
+}
+
+// Interpret 执行编译好的 script 函数, 运行时错误返回 *RuntimeError
+func (vm *VM) Interpret(function *ObjFunction) error {
+	vm.sp = 0
+	vm.frames = vm.frames[:0]
+	vm.handlers = vm.handlers[:0]
+	vm.openUpvalues = nil
+
+	closure := &ObjClosure{function: function, globals: vm.globals}
+	vm.push(ObjValue(closure))
+	if err := vm.call(closure, 0); err != nil {
+		return err
+	}
+	return vm.run(0)
+}
+
+// importModule 编译并执行模块, 模块使用自己的全局变量, 执行结束后缓存
+func (vm *VM) importModule(path string) (*ObjModule, error) {
+	loader := vm.host.loader
+	abs := loader.resolve(path)
+	if module, ok := loader.modules[abs]; ok {
+		return module.(*ObjModule), nil
+	}
+	if err := loader.begin(abs); err != nil {
+		return nil, vm.runtimeError("%v", err)
+	}
+	defer loader.end()
+
+	stmts, reporter, err := parseModule(vm.host, abs)
+	if diagnostics, ok := err.(Errors.Diagnostics); ok {
+		return nil, diagnostics
+	} else if err != nil {
+		return nil, vm.runtimeError("%s", importError(path, err))
+	}
+	function := NewCompiler(reporter).Compile(stmts)
+	if reporter.HadError() {
+		return nil, reporter.Diagnostics
+	}
+
+	function.module = path
+	globals := vm.moduleGlobals()
+	closure := &ObjClosure{function: function, globals: globals}
+	vm.push(ObjValue(closure))
+	if err := vm.call(closure, 0); err != nil {
+		return nil, err
+	}
+	// 在当前的调用栈上执行模块, 返回到 import 的位置时结束
+	if err := vm.run(len(vm.frames) - 1); err != nil {
+		attachDiagnostic(err, reporter)
+		return nil, err
+	}
+	vm.pop()
+
+	module := &ObjModule{name: moduleName(abs), members: globals, exports: moduleExports(stmts)}
+	loader.modules[abs] = module
+	return module, nil
+}
+
+func (vm *VM) push(value Value) {
+	if vm.sp == len(vm.stack) {
+		grown := make([]Value, len(vm.stack)*2)
+		copy(grown, vm.stack)
+		vm.stack = grown
+	}
+	vm.stack[vm.sp] = value
+	vm.sp++
+}
+
+func (vm *VM) pop() Value {
+	vm.sp--
+	return vm.stack[vm.sp]
+}
+
+func (vm *VM) peek(distance int) Value {
+	return vm.stack[vm.sp-1-distance]
+}
+
+// runtimeError 使用当前指令对应的 token, 调用栈从最内层开始
+func (vm *VM) runtimeError(format string, args ...interface{}) error {
+	frame := &vm.frames[len(vm.frames)-1]
+	chunk := frame.closure.function.chunk
+	err := NewRuntimeError(chunk.Tokens[frame.ip-1], fmt.Sprintf(format, args...))
+	err.Trace = vm.stackTrace()
+	attachDiagnostic(err, frame.closure.function.reporter)
+	return err
+}
+
+// throw OP_THROW 抛出 value, 位置是当前指令对应的 token
+func (vm *VM) throw(value Value) error {
+	frame := &vm.frames[len(vm.frames)-1]
+	token := frame.closure.function.chunk.Tokens[frame.ip-1]
+	err := newThrowError(token, value.Interface(), func(int) []TraceLine {
+		return vm.stackTrace()
+	})
+	attachDiagnostic(err, frame.closure.function.reporter)
+	return err
+}
+
+// catch 把运行时错误交给 base 层以内最近的处理器, 栈回到 OP_TRY 时的状态, 再压入 catch 的值
+// 没有可用的处理器时返回 false, 错误继续向上传递
+func (vm *VM) catch(err error, base int) bool {
+	runtimeErr, ok := err.(*RuntimeError)
+	if !ok || len(vm.handlers) == 0 || vm.handlers[len(vm.handlers)-1].frame < base {
+		return false
+	}
+	handler := vm.handlers[len(vm.handlers)-1]
+	vm.handlers = vm.handlers[:len(vm.handlers)-1]
+	vm.closeUpvalues(handler.sp)
+	vm.frames = vm.frames[:handler.frame+1]
+	vm.frames[handler.frame].ip = handler.ip
+	vm.sp = handler.sp
+	vm.push(ValueOf(runtimeErr.Caught()))
+	return true
+}
+
+// stackTrace 当前的调用栈, 最内层在前
+func (vm *VM) stackTrace() []TraceLine {
+	trace := make([]TraceLine, 0, len(vm.frames))
+	for i := len(vm.frames) - 1; i >= 0; i-- {
+		f := &vm.frames[i]
+		function := f.closure.function
+		line := function.chunk.Tokens[f.ip-1].Line
+		name := "script"
+		if function.module != "" {
+			name = function.module
+		} else if function.name != "" {
+			name = CallFrame{Function: function.name, Class: function.className}.Name()
+		}
+		trace = append(trace, TraceLine{line, name})
+	}
+	return trace
+}
+
+func (vm *VM) call(closure *ObjClosure, argCount int) error {
+	if argCount != closure.function.arity {
+		return vm.runtimeError("Expected %d arguments but got %d.", closure.function.arity, argCount)
+	}
+	if len(vm.frames) == maxCallDepth {
+		return vm.runtimeError("Stack overflow.")
+	}
+	vm.frames = append(vm.frames, vmFrame{closure: closure, ip: 0, slots: vm.sp - argCount - 1})
+	return nil
+}
+
+func (vm *VM) callValue(callee Value, argCount int) error {
+	switch object := callee.obj.(type) {
+	case *ObjClosure:
+		return vm.call(object, argCount)
+	case *ObjBoundMethod:
+		vm.stack[vm.sp-argCount-1] = object.receiver
+		return vm.call(object.method, argCount)
+	case *ObjClass:
+		vm.stack[vm.sp-argCount-1] = ObjValue(&ObjInstance{class: object, fields: make(map[string]Value)})
+		if initializer, ok := object.methods["init"]; ok {
+			return vm.call(initializer, argCount)
+		} else if argCount != 0 {
+			return vm.runtimeError("Expected 0 arguments but got %d.", argCount)
+		}
+		return nil
+	case *ObjNative:
+		if object.arity != Variadic && object.arity != argCount {
+			return vm.runtimeError("Expected %d arguments but got %d.", object.arity, argCount)
+		}
+		args := make([]Value, argCount)
+		copy(args, vm.stack[vm.sp-argCount:vm.sp])
+		result, err := object.function(args)
+		if err != nil {
+			return vm.runtimeError("%v", err)
+		}
+		vm.sp -= argCount + 1
+		vm.push(result)
+		return nil
+	}
+	return vm.runtimeError("Can only call functions and classes.")
+}
+
+func (vm *VM) invokeFromClass(class *ObjClass, name string, argCount int) error {
+	method, ok := class.methods[name]
+	if !ok {
+		return vm.runtimeError("Undefined property '%s'.", name)
+	}
+	return vm.call(method, argCount)
+}
+
+func (vm *VM) invoke(name string, argCount int) error {
+	receiver := vm.peek(argCount)
+	if list, ok := receiver.obj.(*ObjList); ok {
+		method, ok := vm.listMethod(list, name)
+		if !ok {
+			return vm.runtimeError("Undefined property '%s'.", name)
+		}
+		return vm.callValue(ObjValue(method), argCount)
+	}
+	if module, ok := receiver.obj.(*ObjModule); ok {
+		value, ok := module.member(name)
+		if !ok {
+			return vm.runtimeError("Undefined property '%s'.", name)
+		}
+		vm.stack[vm.sp-argCount-1] = value
+		return vm.callValue(value, argCount)
+	}
+	if m, ok := receiver.obj.(*ObjMap); ok {
+		method, ok := vm.mapMethod(m, name)
+		if !ok {
+			return vm.runtimeError("Undefined property '%s'.", name)
+		}
+		return vm.callValue(ObjValue(method), argCount)
+	}
+	if e, ok := receiver.obj.(*LoxError); ok {
+		value, ok := e.member(name)
+		if !ok {
+			return vm.runtimeError("Undefined property '%s'.", name)
+		}
+		vm.stack[vm.sp-argCount-1] = ValueOf(value)
+		return vm.callValue(ValueOf(value), argCount)
+	}
+	instance, ok := receiver.obj.(*ObjInstance)
+	if !ok {
+		return vm.runtimeError("Only instances have methods.")
+	}
+	// 字段中保存的可能是函数
+	if value, ok := instance.fields[name]; ok {
+		vm.stack[vm.sp-argCount-1] = value
+		return vm.callValue(value, argCount)
+	}
+	return vm.invokeFromClass(instance.class, name, argCount)
+}
+
+func (vm *VM) bindMethod(class *ObjClass, name string) error {
+	method, ok := class.methods[name]
+	if !ok {
+		return vm.runtimeError("Undefined property '%s'.", name)
+	}
+	bound := &ObjBoundMethod{receiver: vm.peek(0), method: method}
+	vm.pop()
+	vm.push(ObjValue(bound))
+	return nil
+}
+
+// listMethod 列表的方法, 返回绑定了列表的 native 函数
+func (vm *VM) listMethod(list *ObjList, name string) (*ObjNative, bool) {
+	var arity int
+	var function NativeFn
+	switch name {
+	case "len":
+		function = func(args []Value) (Value, error) {
+			return NumberValue(float64(len(list.elements))), nil
+		}
+	case "push":
+		arity = 1
+		function = func(args []Value) (Value, error) {
+			list.elements = append(list.elements, args[0])
+			return NilValue, nil
+		}
+	case "pop":
+		function = func(args []Value) (Value, error) {
+			if len(list.elements) == 0 {
+				return NilValue, errors.New("Can't pop from an empty list.")
+			}
+			last := list.elements[len(list.elements)-1]
+			list.elements = list.elements[:len(list.elements)-1]
+			return last, nil
+		}
+	case "insert":
+		arity = 2
+		function = func(args []Value) (Value, error) {
+			index, err := listIndex(args[0].Interface(), len(list.elements)+1)
+			if err != nil {
+				return NilValue, err
+			}
+			list.elements = append(list.elements, NilValue)
+			copy(list.elements[index+1:], list.elements[index:])
+			list.elements[index] = args[1]
+			return NilValue, nil
+		}
+	case "remove":
+		arity = 1
+		function = func(args []Value) (Value, error) {
+			index, err := listIndex(args[0].Interface(), len(list.elements))
+			if err != nil {
+				return NilValue, err
+			}
+			removed := list.elements[index]
+			list.elements = append(list.elements[:index], list.elements[index+1:]...)
+			return removed, nil
+		}
+	case "slice":
+		arity = 2
+		function = func(args []Value) (Value, error) {
+			start, end, err := sliceBounds(args[0].Interface(), args[1].Interface(), len(list.elements))
+			if err != nil {
+				return NilValue, err
+			}
+			elements := make([]Value, end-start)
+			copy(elements, list.elements[start:end])
+			return ObjValue(&ObjList{elements: elements}), nil
+		}
+	default:
+		return nil, false
+	}
+	return &ObjNative{name: name, arity: arity, function: function}, true
+}
+
+// mapMethod 字典的方法, 返回绑定了字典的 native 函数
+func (vm *VM) mapMethod(m *ObjMap, name string) (*ObjNative, bool) {
+	var arity int
+	var function NativeFn
+	switch name {
+	case "len":
+		function = func(args []Value) (Value, error) {
+			return NumberValue(float64(len(m.keys))), nil
+		}
+	case "keys":
+		function = func(args []Value) (Value, error) {
+			return ObjValue(&ObjList{elements: append([]Value{}, m.keys...)}), nil
+		}
+	case "values":
+		function = func(args []Value) (Value, error) {
+			return ObjValue(&ObjList{elements: append([]Value{}, m.values...)}), nil
+		}
+	case "has":
+		arity = 1
+		function = func(args []Value) (Value, error) {
+			_, ok := m.index[args[0]]
+			return BoolValue(ok), nil
+		}
+	case "delete":
+		arity = 1
+		function = func(args []Value) (Value, error) {
+			return BoolValue(m.Delete(args[0])), nil
+		}
+	default:
+		return nil, false
+	}
+	return &ObjNative{name: name, arity: arity, function: function}, true
+}
+
+func (vm *VM) captureUpvalue(location int) *ObjUpvalue {
+	var prev *ObjUpvalue
+	upvalue := vm.openUpvalues
+	for upvalue != nil && upvalue.location > location {
+		prev = upvalue
+		upvalue = upvalue.next
+	}
+	if upvalue != nil && upvalue.location == location {
+		return upvalue
+	}
+	created := &ObjUpvalue{location: location, isOpen: true, next: upvalue}
+	if prev == nil {
+		vm.openUpvalues = created
+	} else {
+		prev.next = created
+	}
+	return created
+}
+
+// 关闭 last 及以上位置的 upvalue, 值从栈上复制到 upvalue 中
+func (vm *VM) closeUpvalues(last int) {
+	for vm.openUpvalues != nil && vm.openUpvalues.location >= last {
+		upvalue := vm.openUpvalues
+		upvalue.closed = vm.stack[upvalue.location]
+		upvalue.isOpen = false
+		vm.openUpvalues = upvalue.next
+	}
+}
+
+func (vm *VM) getUpvalue(upvalue *ObjUpvalue) Value {
+	if upvalue.isOpen {
+		return vm.stack[upvalue.location]
+	}
+	return upvalue.closed
+}
+
+func (vm *VM) setUpvalue(upvalue *ObjUpvalue, value Value) {
+	if upvalue.isOpen {
+		vm.stack[upvalue.location] = value
+	} else {
+		upvalue.closed = value
+	}
+}
+
+// run 执行到调用栈回到 base 层为止, 最外层的 script 为 0, import 的模块为 import 时的深度
+// 运行时错误交给 base 层以内的异常处理器, 处理之后继续执行
+func (vm *VM) run(base int) error {
+	for {
+		err := vm.dispatch(base)
+		if err == nil || !vm.catch(err, base) {
+			return err
+		}
+	}
+}
+
+// dispatch 解释执行字节码, 直到返回到 base 层或者出错
+func (vm *VM) dispatch(base int) error {
+	frame := &vm.frames[len(vm.frames)-1]
+	code := frame.closure.function.chunk.Code
+	constants := frame.closure.function.chunk.Constants
+	globals := frame.closure.globals
+
+	readByte := func() byte {
+		frame.ip++
+		return code[frame.ip-1]
+	}
+	readShort := func() int {
+		frame.ip += 2
+		return int(code[frame.ip-2])<<8 | int(code[frame.ip-1])
+	}
+	readString := func() string {
+		return constants[readByte()].obj.(string)
+	}
+	// 调用和返回之后切换当前帧
+	loadFrame := func() {
+		frame = &vm.frames[len(vm.frames)-1]
+		code = frame.closure.function.chunk.Code
+		constants = frame.closure.function.chunk.Constants
+		globals = frame.closure.globals
+	}
+	numberOperands := func() (float64, float64, bool) {
+		b, a := vm.peek(0), vm.peek(1)
+		if a.Type != VAL_NUMBER || b.Type != VAL_NUMBER {
+			return 0, 0, false
+		}
+		vm.sp -= 2
+		return a.number, b.number, true
+	}
+
+	for {
+		switch op := OpCode(readByte()); op {
+		case OP_CONSTANT:
+			vm.push(constants[readByte()])
+		case OP_NIL:
+			vm.push(NilValue)
+		case OP_TRUE:
+			vm.push(BoolValue(true))
+		case OP_FALSE:
+			vm.push(BoolValue(false))
+		case OP_DUP:
+			vm.push(vm.peek(int(readByte())))
+		case OP_SWAP:
+			vm.stack[vm.sp-1], vm.stack[vm.sp-2] = vm.stack[vm.sp-2], vm.stack[vm.sp-1]
+		case OP_POP:
+			vm.sp--
+		case OP_GET_LOCAL:
+			vm.push(vm.stack[frame.slots+int(readByte())])
+		case OP_SET_LOCAL:
+			vm.stack[frame.slots+int(readByte())] = vm.peek(0)
+		case OP_GET_GLOBAL:
+			name := readString()
+			value, ok := globals[name]
+			if !ok {
+				return vm.runtimeError("Undefined variable '%s'.", name)
+			}
+			vm.push(value)
+		case OP_DEFINE_GLOBAL:
+			globals[readString()] = vm.pop()
+		case OP_SET_GLOBAL:
+			name := readString()
+			if _, ok := globals[name]; !ok {
+				return vm.runtimeError("Undefined variable '%s'.", name)
+			}
+			globals[name] = vm.peek(0)
+		case OP_GET_UPVALUE:
+			vm.push(vm.getUpvalue(frame.closure.upvalues[readByte()]))
+		case OP_SET_UPVALUE:
+			vm.setUpvalue(frame.closure.upvalues[readByte()], vm.peek(0))
+		case OP_GET_PROPERTY:
+			if list, ok := vm.peek(0).obj.(*ObjList); ok {
+				name := readString()
+				method, ok := vm.listMethod(list, name)
+				if !ok {
+					return vm.runtimeError("Undefined property '%s'.", name)
+				}
+				vm.stack[vm.sp-1] = ObjValue(method)
+				break
+			}
+			if module, ok := vm.peek(0).obj.(*ObjModule); ok {
+				name := readString()
+				value, ok := module.member(name)
+				if !ok {
+					return vm.runtimeError("Undefined property '%s'.", name)
+				}
+				vm.stack[vm.sp-1] = value
+				break
+			}
+			if m, ok := vm.peek(0).obj.(*ObjMap); ok {
+				name := readString()
+				method, ok := vm.mapMethod(m, name)
+				if !ok {
+					return vm.runtimeError("Undefined property '%s'.", name)
+				}
+				vm.stack[vm.sp-1] = ObjValue(method)
+				break
+			}
+			if e, ok := vm.peek(0).obj.(*LoxError); ok {
+				name := readString()
+				value, ok := e.member(name)
+				if !ok {
+					return vm.runtimeError("Undefined property '%s'.", name)
+				}
+				vm.stack[vm.sp-1] = ValueOf(value)
+				break
+			}
+			instance, ok := vm.peek(0).obj.(*ObjInstance)
+			if !ok {
+				return vm.runtimeError("Only instances have properties.")
+			}
+			name := readString()
+			if value, ok := instance.fields[name]; ok {
+				vm.pop()
+				vm.push(value)
+				break
+			}
+			if err := vm.bindMethod(instance.class, name); err != nil {
+				return err
+			}
+		case OP_SET_PROPERTY:
+			instance, ok := vm.peek(1).obj.(*ObjInstance)
+			if !ok {
+				return vm.runtimeError("Only instances have fields.")
+			}
+			instance.fields[readString()] = vm.peek(0)
+			value := vm.pop()
+			vm.pop()
+			vm.push(value)
+		case OP_GET_SUPER:
+			name := readString()
+			superclass := vm.pop().obj.(*ObjClass)
+			if err := vm.bindMethod(superclass, name); err != nil {
+				return err
+			}
+		case OP_EQUAL:
+			b := vm.pop()
+			a := vm.pop()
+			vm.push(BoolValue(valuesEqual(a, b)))
+		case OP_GREATER:
+			a, b, ok := numberOperands()
+			if !ok {
+				return vm.runtimeError("Operands must be numbers.")
+			}
+			vm.push(BoolValue(a > b))
+		case OP_LESS:
+			a, b, ok := numberOperands()
+			if !ok {
+				return vm.runtimeError("Operands must be numbers.")
+			}
+			vm.push(BoolValue(a < b))
+		case OP_ADD:
+			if vm.peek(0).isString() && vm.peek(1).isString() {
+				b := vm.pop().obj.(string)
+				a := vm.pop().obj.(string)
+				vm.push(ObjValue(a + b))
+				break
+			}
+			a, b, ok := numberOperands()
+			if !ok {
+				return vm.runtimeError("Operands must be two numbers or two strings.")
+			}
+			vm.push(NumberValue(a + b))
+		case OP_SUBTRACT:
+			a, b, ok := numberOperands()
+			if !ok {
+				return vm.runtimeError("Operands must be numbers.")
+			}
+			vm.push(NumberValue(a - b))
+		case OP_MULTIPLY:
+			a, b, ok := numberOperands()
+			if !ok {
+				return vm.runtimeError("Operands must be numbers.")
+			}
+			vm.push(NumberValue(a * b))
+		case OP_DIVIDE, OP_FLOOR_DIVIDE, OP_MODULO, OP_POWER, OP_BIT_AND, OP_BIT_OR, OP_BIT_XOR, OP_SHIFT_LEFT, OP_SHIFT_RIGHT:
+			a, b, ok := numberOperands()
+			if !ok {
+				return vm.runtimeError("Operands must be numbers.")
+			}
+			result, message := arithmetic(op, a, b)
+			if message != "" {
+				return vm.runtimeError(message)
+			}
+			vm.push(NumberValue(result))
+		case OP_CONCAT:
+			// 格式和 OP_PRINT 一致
+			b := vm.pop()
+			a := vm.pop()
+			vm.push(ObjValue(a.String() + b.String()))
+		case OP_NOT:
+			vm.push(BoolValue(vm.pop().isFalsey()))
+		case OP_NEGATE:
+			if vm.peek(0).Type != VAL_NUMBER {
+				return vm.runtimeError("Operand must be a number.")
+			}
+			vm.stack[vm.sp-1].number = -vm.stack[vm.sp-1].number
+		case OP_BIT_NOT:
+			if vm.peek(0).Type != VAL_NUMBER {
+				return vm.runtimeError("Operand must be a number.")
+			}
+			n, ok := toInteger(vm.peek(0).number)
+			if !ok {
+				return vm.runtimeError(errIntegerOperand)
+			}
+			vm.stack[vm.sp-1].number = float64(^n)
+		case OP_PRINT:
+			fmt.Fprintln(vm.stdout, vm.pop())
+		case OP_JUMP:
+			offset := readShort()
+			frame.ip += offset
+		case OP_JUMP_IF_FALSE:
+			offset := readShort()
+			if vm.peek(0).isFalsey() {
+				frame.ip += offset
+			}
+		case OP_LOOP:
+			offset := readShort()
+			frame.ip -= offset
+		case OP_CALL:
+			argCount := int(readByte())
+			if err := vm.callValue(vm.peek(argCount), argCount); err != nil {
+				return err
+			}
+			loadFrame()
+		case OP_INVOKE:
+			name := readString()
+			argCount := int(readByte())
+			if err := vm.invoke(name, argCount); err != nil {
+				return err
+			}
+			loadFrame()
+		case OP_SUPER_INVOKE:
+			name := readString()
+			argCount := int(readByte())
+			superclass := vm.pop().obj.(*ObjClass)
+			if err := vm.invokeFromClass(superclass, name, argCount); err != nil {
+				return err
+			}
+			loadFrame()
+		case OP_CLOSURE:
+			function := constants[readByte()].obj.(*ObjFunction)
+			closure := &ObjClosure{function: function, upvalues: make([]*ObjUpvalue, function.upvalueCount),
+				globals: frame.closure.globals}
+			vm.push(ObjValue(closure))
+			for i := range closure.upvalues {
+				isLocal := readByte()
+				index := int(readByte())
+				if isLocal == 1 {
+					closure.upvalues[i] = vm.captureUpvalue(frame.slots + index)
+				} else {
+					closure.upvalues[i] = frame.closure.upvalues[index]
+				}
+			}
+		case OP_CLOSE_UPVALUE:
+			vm.closeUpvalues(vm.sp - 1)
+			vm.sp--
+		case OP_RETURN:
+			result := vm.pop()
+			vm.closeUpvalues(frame.slots)
+			vm.frames = vm.frames[:len(vm.frames)-1]
+			vm.sp = frame.slots
+			vm.push(result)
+			if len(vm.frames) == base {
+				return nil
+			}
+			loadFrame()
+		case OP_CLASS:
+			vm.push(ObjValue(&ObjClass{name: readString(), methods: make(map[string]*ObjClosure)}))
+		case OP_INHERIT:
+			superclass, ok := vm.peek(1).obj.(*ObjClass)
+			if !ok {
+				return vm.runtimeError("Superclass must be a class.")
+			}
+			subclass := vm.peek(0).obj.(*ObjClass)
+			// 方法在继承时复制, 子类定义的方法在之后覆盖
+			for name, method := range superclass.methods {
+				subclass.methods[name] = method
+			}
+			vm.pop()
+		case OP_LIST:
+			count := int(readByte())
+			elements := make([]Value, count)
+			copy(elements, vm.stack[vm.sp-count:vm.sp])
+			vm.sp -= count
+			vm.push(ObjValue(&ObjList{elements: elements}))
+		case OP_MAP:
+			count := int(readByte())
+			m := NewObjMap()
+			for k := vm.sp - 2*count; k < vm.sp; k += 2 {
+				m.Put(vm.stack[k], vm.stack[k+1])
+			}
+			vm.sp -= 2 * count
+			vm.push(ObjValue(m))
+		case OP_GET_INDEX:
+			var value Value
+			switch object := vm.peek(1).obj.(type) {
+			case *ObjList:
+				index, err := listIndex(vm.peek(0).Interface(), len(object.elements))
+				if err != nil {
+					return vm.runtimeError("%v", err)
+				}
+				value = object.elements[index]
+			case *ObjMap:
+				found, ok := object.Lookup(vm.peek(0))
+				if !ok {
+					return vm.runtimeError("%s", mapKeyError(vm.peek(0).String()))
+				}
+				value = found
+			default:
+				return vm.runtimeError("Only lists and maps can be indexed.")
+			}
+			vm.sp -= 2
+			vm.push(value)
+		case OP_SET_INDEX:
+			value := vm.peek(0)
+			switch object := vm.peek(2).obj.(type) {
+			case *ObjList:
+				index, err := listIndex(vm.peek(1).Interface(), len(object.elements))
+				if err != nil {
+					return vm.runtimeError("%v", err)
+				}
+				object.elements[index] = value
+			case *ObjMap:
+				object.Put(vm.peek(1), value)
+			default:
+				return vm.runtimeError("Only lists and maps can be indexed.")
+			}
+			vm.sp -= 3
+			vm.push(value)
+		case OP_IMPORT:
+			path := readString()
+			// 变量名只用于反汇编, 模块对象被缓存, 不能使用第一次 import 时的名字
+			readByte()
+			module, err := vm.importModule(path)
+			if err != nil {
+				return err
+			}
+			vm.push(ObjValue(module))
+			// 模块执行时调用栈可能重新分配
+			loadFrame()
+		case OP_TRY:
+			offset := readShort()
+			vm.handlers = append(vm.handlers, vmHandler{frame: len(vm.frames) - 1, sp: vm.sp, ip: frame.ip + offset})
+		case OP_END_TRY:
+			vm.handlers = vm.handlers[:len(vm.handlers)-1]
+		case OP_THROW:
+			return vm.throw(vm.pop())
+		case OP_METHOD:
+			name := readString()
+			method := vm.peek(0).obj.(*ObjClosure)
+			class := vm.peek(1).obj.(*ObjClass)
+			class.methods[name] = method
+			vm.pop()
+		}
+	}
+}
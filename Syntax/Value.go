@@ -0,0 +1,315 @@
+package Syntax
+
+import (
+	"fmt"
+	"github.com/trueabc/lox/Errors"
+	"strings"
+)
+
+// 字节码虚拟机使用的值, 数字和 bool 不需要装箱成 interface{}
+
+type ValueType uint8
+
+const (
+	VAL_NIL ValueType = iota
+	VAL_BOOL
+	VAL_NUMBER
+	VAL_OBJ // string 以及下面的 Obj* 对象
+)
+
+type Value struct {
+	Type   ValueType
+	number float64 // bool 用 0 和 1 表示
+	obj    interface{}
+}
+
+var NilValue = Value{Type: VAL_NIL}
+
+func BoolValue(b bool) Value {
+	if b {
+		return Value{Type: VAL_BOOL, number: 1}
+	}
+	return Value{Type: VAL_BOOL}
+}
+
+func NumberValue(n float64) Value {
+	return Value{Type: VAL_NUMBER, number: n}
+}
+
+func ObjValue(obj interface{}) Value {
+	return Value{Type: VAL_OBJ, obj: obj}
+}
+
+// ValueOf 把宿主程序的值转换为虚拟机的值
+func ValueOf(v interface{}) Value {
+	switch value := v.(type) {
+	case nil:
+		return NilValue
+	case bool:
+		return BoolValue(value)
+	case float64:
+		return NumberValue(value)
+	case int:
+		return NumberValue(float64(value))
+	case Value:
+		return value
+	case *LoxList:
+		// native 函数返回的列表转换为虚拟机的列表
+		elements := make([]Value, 0, len(value.elements))
+		for _, item := range value.elements {
+			elements = append(elements, ValueOf(item))
+		}
+		return ObjValue(&ObjList{elements: elements})
+	default:
+		return ObjValue(value)
+	}
+}
+
+// Interface 转换为 interface{}, 与树遍历解释器使用的表示一致
+func (v Value) Interface() interface{} {
+	switch v.Type {
+	case VAL_BOOL:
+		return v.number != 0
+	case VAL_NUMBER:
+		return v.number
+	case VAL_OBJ:
+		return v.obj
+	}
+	return nil
+}
+
+func (v Value) isFalsey() bool {
+	return v.Type == VAL_NIL || (v.Type == VAL_BOOL && v.number == 0)
+}
+
+func (v Value) isString() bool {
+	_, ok := v.obj.(string)
+	return ok
+}
+
+func valuesEqual(a, b Value) bool {
+	if a.Type != b.Type {
+		return false
+	}
+	switch a.Type {
+	case VAL_NIL:
+		return true
+	case VAL_BOOL, VAL_NUMBER:
+		return a.number == b.number
+	}
+	return a.obj == b.obj
+}
+
+func (v Value) String() string {
+	return v.format(nil)
+}
+
+// format printing 记录正在输出的列表和字典, 与树遍历解释器的 stringify 一致
+func (v Value) format(printing map[interface{}]bool) string {
+	switch obj := v.obj.(type) {
+	case *ObjList:
+		return obj.format(printing)
+	case *ObjMap:
+		return obj.format(printing)
+	}
+	switch v.Type {
+	case VAL_NIL:
+		return "nil"
+	case VAL_BOOL:
+		if v.number != 0 {
+			return "true"
+		}
+		return "false"
+	case VAL_NUMBER:
+		return fmt.Sprint(v.number)
+	}
+	return fmt.Sprint(v.obj)
+}
+
+// ObjFunction 编译后的函数
+type ObjFunction struct {
+	arity        int
+	upvalueCount int
+	chunk        *Chunk
+	name         string
+	className    string // 方法所属的类, 用于调用栈
+	module       string // import 的模块的顶层代码, 调用栈中显示模块的路径
+	// 编译函数的源码, 函数中的运行时错误在这里生成位置信息
+	reporter *Errors.Reporter
+}
+
+func (f *ObjFunction) String() string {
+	if f.name == "" {
+		return "<script>"
+	}
+	return "<fn " + f.name + ">"
+}
+
+// ObjUpvalue 被闭包捕获的变量, open 时指向栈上的位置, 离开作用域后保存在 closed 中
+type ObjUpvalue struct {
+	location int
+	closed   Value
+	isOpen   bool
+	next     *ObjUpvalue
+}
+
+type ObjClosure struct {
+	function *ObjFunction
+	upvalues []*ObjUpvalue
+	// 定义闭包的模块的全局变量
+	globals map[string]Value
+}
+
+func (c *ObjClosure) String() string {
+	return c.function.String()
+}
+
+// NativeFn 虚拟机中的 native 函数
+type NativeFn func(args []Value) (Value, error)
+
+type ObjNative struct {
+	name     string
+	arity    int
+	function NativeFn
+}
+
+func (n *ObjNative) String() string {
+	return "<native fn>"
+}
+
+// ObjModule 模块, native 模块的成员在创建虚拟机时从 LoxModule 转换
+// import 的模块中 members 是模块的全局变量, 只有 exports 中的名字可以访问
+type ObjModule struct {
+	name    string
+	members map[string]Value
+	exports map[string]bool
+}
+
+func (m *ObjModule) member(name string) (Value, bool) {
+	value, ok := m.members[name]
+	if !ok || (m.exports != nil && !m.exports[name]) {
+		return NilValue, false
+	}
+	return value, true
+}
+
+func (m *ObjModule) String() string {
+	return "<module " + m.name + ">"
+}
+
+type ObjClass struct {
+	name    string
+	methods map[string]*ObjClosure
+}
+
+func (c *ObjClass) String() string {
+	return c.name
+}
+
+type ObjInstance struct {
+	class  *ObjClass
+	fields map[string]Value
+}
+
+func (i *ObjInstance) String() string {
+	return i.class.name + " instance"
+}
+
+type ObjBoundMethod struct {
+	receiver Value
+	method   *ObjClosure
+}
+
+func (b *ObjBoundMethod) String() string {
+	return b.method.String()
+}
+
+// ObjList 虚拟机中的列表
+type ObjList struct {
+	elements []Value
+}
+
+func (l *ObjList) String() string {
+	return l.format(nil)
+}
+
+func (l *ObjList) format(printing map[interface{}]bool) string {
+	if printing[l] {
+		return "[...]"
+	}
+	if printing == nil {
+		printing = make(map[interface{}]bool)
+	}
+	printing[l] = true
+	defer delete(printing, l)
+
+	items := make([]string, 0, len(l.elements))
+	for _, item := range l.elements {
+		items = append(items, item.format(printing))
+	}
+	return "[" + strings.Join(items, ", ") + "]"
+}
+
+// ObjMap 虚拟机中的字典, 与 LoxMap 一样保持插入顺序
+// Value 可以直接作为 go map 的键, 比较的结果与 valuesEqual 一致
+type ObjMap struct {
+	keys   []Value
+	values []Value
+	index  map[Value]int
+}
+
+func NewObjMap() *ObjMap {
+	return &ObjMap{keys: make([]Value, 0), values: make([]Value, 0), index: make(map[Value]int)}
+}
+
+func (m *ObjMap) Lookup(key Value) (Value, bool) {
+	if id, ok := m.index[key]; ok {
+		return m.values[id], true
+	}
+	return NilValue, false
+}
+
+func (m *ObjMap) Put(key, value Value) {
+	if id, ok := m.index[key]; ok {
+		m.values[id] = value
+		return
+	}
+	m.index[key] = len(m.keys)
+	m.keys = append(m.keys, key)
+	m.values = append(m.values, value)
+}
+
+func (m *ObjMap) Delete(key Value) bool {
+	id, ok := m.index[key]
+	if !ok {
+		return false
+	}
+	delete(m.index, key)
+	m.keys = append(m.keys[:id], m.keys[id+1:]...)
+	m.values = append(m.values[:id], m.values[id+1:]...)
+	for k := id; k < len(m.keys); k++ {
+		m.index[m.keys[k]] = k
+	}
+	return true
+}
+
+func (m *ObjMap) String() string {
+	return m.format(nil)
+}
+
+func (m *ObjMap) format(printing map[interface{}]bool) string {
+	if printing[m] {
+		return "{...}"
+	}
+	if printing == nil {
+		printing = make(map[interface{}]bool)
+	}
+	printing[m] = true
+	defer delete(printing, m)
+
+	items := make([]string, 0, len(m.keys))
+	for id := range m.keys {
+		items = append(items, m.keys[id].format(printing)+": "+m.values[id].format(printing))
+	}
+	return "{" + strings.Join(items, ", ") + "}"
+}
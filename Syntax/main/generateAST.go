@@ -20,30 +20,41 @@ func main() {
 	defineAst(outDir, "Expr", []string{
 		"Binary   : Expr left, *Token.Token operator, Expr right",
 		"Grouping : Expr expression",
-		"Literal  : interface{} value",
+		"Literal  : interface{} value, *Token.Token token",
 		"Unary    : *Token.Token operator, Expr right",
 		"Variable : *Token.Token name",
 		"This : *Token.Token keyword",
 		"Super    : *Token.Token keyword, *Token.Token method",
 		"Get      : Expr object, *Token.Token name",
-		"Set      : Expr object, *Token.Token name, Expr value",
+		"Set      : Expr object, *Token.Token name, Expr value, *Token.Token operator, bool postfix",
 		"Logic : Expr left, *Token.Token operator, Expr right",
-		"Assignment : *Token.Token name, Expr value",
+		"Assignment : *Token.Token name, Expr value, *Token.Token operator, bool postfix",
 		"Call     : Expr callee, *Token.Token paren, []Expr arguments",
+		"List     : *Token.Token bracket, []Expr elements",
+		"Map      : *Token.Token brace, []Expr keys, []Expr values",
+		"Index    : Expr object, *Token.Token bracket, Expr index",
+		"SetIndex : Expr object, *Token.Token bracket, Expr index, Expr value, *Token.Token operator, bool postfix",
 	})
 
 	defineAst(outDir, "Stmt", []string{
 		"Expression : Expr Expression",
 		"Print : Expr Expression",
 		"Variable : *Token.Token name, Expr initializer",
-		"Block : []Stmt statements",
+		"Block : []Stmt statements, *Token.Token rightBrace",
 		"Class      : *Token.Token name, *VariableExpr superClass,  []Stmt methods",
 		"While : Expr condition, Stmt body",
+		"For : *Token.Token keyword, Stmt initializer, Expr condition, Expr increment, Stmt body",
 		"If : Expr condition, Stmt thenBranch," +
 			" Stmt elseBranch",
 		"Return     : *Token.Token keyword, Expr value",
+		"Break      : *Token.Token keyword",
+		"Continue   : *Token.Token keyword",
+		"Throw      : *Token.Token keyword, Expr value",
+		"Try        : *Token.Token keyword, *BlockStmt body, *Token.Token catchName," +
+			" *BlockStmt catchBody, *BlockStmt finallyBody",
 		"Function   : *Token.Token name, []*Token.Token params," +
 			" []Stmt body",
+		"Import     : *Token.Token keyword, *Token.Token path, *Token.Token name",
 	})
 }
 
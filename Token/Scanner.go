@@ -1,27 +1,41 @@
 package Token
 
 import (
-	"github.com/trueabc/lox/Logger"
 	"strconv"
+	"strings"
+	"unicode/utf8"
 )
 
 var KEY_WORDS = map[string]TokenType{
-	"and":    AND,
-	"class":  CLASS,
-	"else":   ELSE,
-	"false":  FALSE,
-	"for":    FOR,
-	"fun":    FUN,
-	"if":     IF,
-	"nil":    NIL,
-	"or":     OR,
-	"print":  PRINT,
-	"return": RETURN,
-	"super":  SUPER,
-	"this":   THIS,
-	"true":   TRUE,
-	"var":    VAR,
-	"while":  WHILE,
+	"and":      AND,
+	"break":    BREAK,
+	"catch":    CATCH,
+	"class":    CLASS,
+	"continue": CONTINUE,
+	"else":     ELSE,
+	"false":    FALSE,
+	"finally":  FINALLY,
+	"for":      FOR,
+	"fun":      FUN,
+	"if":       IF,
+	"import":   IMPORT,
+	"nil":      NIL,
+	"or":       OR,
+	"print":    PRINT,
+	"return":   RETURN,
+	"super":    SUPER,
+	"this":     THIS,
+	"throw":    THROW,
+	"true":     TRUE,
+	"try":      TRY,
+	"var":      VAR,
+	"while":    WHILE,
+}
+
+// ErrorReporter 接收词法错误, 由 Errors.Reporter 实现
+// 定义在这里是为了避免 Token 和 Errors 的循环引用
+type ErrorReporter interface {
+	ScanError(line, column, offset, length int, message string)
 }
 
 type Scanner struct {
@@ -30,11 +44,20 @@ type Scanner struct {
 	start   int
 	current int
 	line    int
+
+	col         int // 当前行已经消费的字符数, 多字节的字符只算一个
+	startLine   int // 当前 token 开始的行和列, 多行字符串以开始位置为准
+	startColumn int
+
+	reporter ErrorReporter
+	comments []*Token
+	// 每一层没有结束的字符串插值中, 还没有匹配的 { 的个数
+	interpolations []int
 }
 
-// NewScanner 读取source分割为token
-func NewScanner(source string) *Scanner {
-	s := &Scanner{source: source, tokens: make([]*Token, 0)}
+// NewScanner 读取source分割为token, 词法错误交给 reporter
+func NewScanner(source string, reporter ErrorReporter) *Scanner {
+	s := &Scanner{source: source, tokens: make([]*Token, 0), reporter: reporter}
 	s.start = 0
 	s.current = 0
 	s.line = 1
@@ -48,9 +71,12 @@ func (s *Scanner) isAtEnd() bool {
 func (s *Scanner) ScanTokens() []*Token {
 	for !s.isAtEnd() {
 		s.start = s.current
+		s.startLine = s.line
+		s.startColumn = s.column()
 		s.scanToken()
 	}
-	s.tokens = append(s.tokens, NewToken(EOF, "", nil, s.line))
+	s.tokens = append(s.tokens, NewToken(EOF, "", nil, s.line,
+		s.column(), s.current))
 	return s.tokens
 }
 
@@ -62,21 +88,69 @@ func (s *Scanner) scanToken() {
 	case ')':
 		s.addTokenDefault(RIGHT_PAREN)
 	case '{':
+		if n := len(s.interpolations); n > 0 {
+			s.interpolations[n-1]++
+		}
 		s.addTokenDefault(LEFT_BRACE)
 	case '}':
+		// 和 ${ 匹配的 } 之后继续扫描字符串
+		if n := len(s.interpolations); n > 0 {
+			if s.interpolations[n-1] == 0 {
+				s.interpolations = s.interpolations[:n-1]
+				s.string()
+				return
+			}
+			s.interpolations[n-1]--
+		}
 		s.addTokenDefault(RIGHT_BRACE)
+	case '[':
+		s.addTokenDefault(LEFT_BRACKET)
+	case ']':
+		s.addTokenDefault(RIGHT_BRACKET)
 	case ',':
 		s.addTokenDefault(COMMA)
+	case ':':
+		s.addTokenDefault(COLON)
 	case '.':
 		s.addTokenDefault(DOT)
 	case '-':
-		s.addTokenDefault(MINUS)
+		if s.match('-') {
+			s.addTokenDefault(MINUS_MINUS)
+		} else if s.match('=') {
+			s.addTokenDefault(MINUS_EQUAL)
+		} else {
+			s.addTokenDefault(MINUS)
+		}
 	case '+':
-		s.addTokenDefault(PLUS)
+		if s.match('+') {
+			s.addTokenDefault(PLUS_PLUS)
+		} else if s.match('=') {
+			s.addTokenDefault(PLUS_EQUAL)
+		} else {
+			s.addTokenDefault(PLUS)
+		}
 	case ';':
 		s.addTokenDefault(SEMICOLON)
-	case '*':
-		s.addTokenDefault(STAR)
+	case '%':
+		if s.match('=') {
+			s.addTokenDefault(PERCENT_EQUAL)
+		} else {
+			s.addTokenDefault(PERCENT)
+		}
+	case '&':
+		s.addTokenDefault(AMPERSAND)
+	case '|':
+		s.addTokenDefault(PIPE)
+	case '^':
+		s.addTokenDefault(CARET)
+	case '~':
+		// ~// 仍然是 ~ 之后跟着注释
+		if s.peek() == '/' && s.peekNext() != '/' {
+			s.advance()
+			s.addTokenDefault(TILDE_SLASH)
+		} else {
+			s.addTokenDefault(TILDE)
+		}
 
 	// 两个阶段的关键字
 	case '!':
@@ -91,14 +165,26 @@ func (s *Scanner) scanToken() {
 		} else {
 			s.addTokenDefault(EQUAL)
 		}
+	case '*':
+		if s.match('*') {
+			s.addTokenDefault(STAR_STAR)
+		} else if s.match('=') {
+			s.addTokenDefault(STAR_EQUAL)
+		} else {
+			s.addTokenDefault(STAR)
+		}
 	case '<':
-		if s.match('=') {
+		if s.match('<') {
+			s.addTokenDefault(LESS_LESS)
+		} else if s.match('=') {
 			s.addTokenDefault(LESS_EQUAL)
 		} else {
 			s.addTokenDefault(LESS)
 		}
 	case '>':
-		if s.match('=') {
+		if s.match('>') {
+			s.addTokenDefault(GREATER_GREATER)
+		} else if s.match('=') {
 			s.addTokenDefault(GREATER_EQUAL)
 		} else {
 			s.addTokenDefault(GREATER)
@@ -109,6 +195,9 @@ func (s *Scanner) scanToken() {
 			for s.peek() != '\n' && !s.isAtEnd() {
 				s.advance()
 			}
+			s.comment()
+		} else if s.match('=') {
+			s.addTokenDefault(SLASH_EQUAL)
 		} else {
 			s.addTokenDefault(SLASH)
 		}
@@ -117,7 +206,7 @@ func (s *Scanner) scanToken() {
 		break
 		// Ignore whitespace.
 	case '\n':
-		s.line++
+		s.newLine()
 
 	case '"':
 		// string 字面量匹配
@@ -132,11 +221,30 @@ func (s *Scanner) scanToken() {
 		} else if s.isAlpha(n) {
 			s.identifier()
 		} else {
-			Logger.Errorf("%d Unexpected character.", s.line)
+			// 多字节的字符整个跳过, 只报告一次
+			_, size := utf8.DecodeRuneInString(s.source[s.start:])
+			s.current = s.start + size
+			s.col = s.startColumn
+			s.reporter.ScanError(s.startLine, s.startColumn, s.start, size, "Unexpected character.")
 		}
 	}
 }
 
+// Comments ScanTokens 之后调用, 按出现顺序返回所有的注释, 格式化时需要保留它们
+func (s *Scanner) Comments() []*Token {
+	return s.comments
+}
+
+func (s *Scanner) comment() {
+	text := strings.TrimRight(s.source[s.start:s.current], "\r")
+	s.comments = append(s.comments, NewToken(COMMENT, text, nil,
+		s.startLine, s.startColumn, s.start))
+}
+
+func (s *Scanner) error(line, column, offset int, message string) {
+	s.reporter.ScanError(line, column, offset, 1, message)
+}
+
 func (s *Scanner) peek() byte {
 	if s.isAtEnd() {
 		// cpp的字符串结束 '\0', ascii 为0
@@ -159,46 +267,127 @@ func (s *Scanner) match(expected byte) bool {
 	if s.source[s.current] != expected {
 		return false
 	}
-	s.current += 1
+	s.advance()
 	return true
 }
 
 // 访问单个字符, 增加current下标
+// UTF-8 的后续字节不计入列, 这样列按字符计数
 func (s *Scanner) advance() byte {
-	defer func() {
-		s.current += 1
-	}()
-	return s.source[s.current]
+	c := s.source[s.current]
+	s.current += 1
+	if !utf8.RuneStart(c) {
+		return c
+	}
+	s.col++
+	return c
 }
 
 func (s *Scanner) addToken(tokenType TokenType, literal interface{}) {
 	text := s.source[s.start:s.current]
 
-	s.tokens = append(s.tokens, NewToken(tokenType, text, literal, s.line))
+	s.tokens = append(s.tokens, NewToken(tokenType, text, literal,
+		s.startLine, s.startColumn, s.start))
+}
+
+// 换行符已经被消费, 从新一行的第一列开始
+func (s *Scanner) newLine() {
+	s.line++
+	s.col = 0
+}
+
+// column 当前位置的列, 按字符计数, 多字节的字符只算一列
+func (s *Scanner) column() int {
+	return s.col + 1
 }
 
 func (s *Scanner) addTokenDefault(tokenType TokenType) {
 	s.addToken(tokenType, nil)
 }
 
+// string 扫描字符串, 从 " 或者结束插值的 } 之后开始, 到 " 或者 ${ 为止
+// 遇到 ${ 时生成 INTERPOLATION, 之后按照普通的 token 扫描插值中的表达式
 func (s *Scanner) string() {
+	var value strings.Builder
 	for s.peek() != '"' && !s.isAtEnd() {
-		// 这种模式可以支持多行的string, 但是单行string无法添加分隔符
-		if s.peek() == '\n' {
-			s.line += 1
+		switch c := s.peek(); {
+		case c == '\n':
+			// 这种模式可以支持多行的string
+			s.advance()
+			s.newLine()
+			value.WriteByte(c)
+		case c == '$' && s.peekNext() == '{':
+			s.advance()
+			s.advance()
+			s.interpolations = append(s.interpolations, 0)
+			s.addToken(INTERPOLATION, value.String())
+			return
+		case c == '\\':
+			s.escape(&value)
+		default:
+			value.WriteByte(s.advance())
 		}
-		s.advance()
 	}
 
 	if s.isAtEnd() {
-		Logger.Errorf("%d unterminated string", s.line)
+		// 指向字符串开始的引号
+		s.error(s.startLine, s.startColumn, s.start, "Unterminated string.")
 		return
 	}
 
 	// 消费最后一个 '"'
 	s.advance()
-	value := s.source[s.start+1 : s.current-1]
-	s.addToken(STRING, value)
+	if s.source[s.start] == '}' {
+		s.addToken(INTERPOLATION, value.String())
+		return
+	}
+	s.addToken(STRING, value.String())
+}
+
+// escapes 转义字符对应的值, \u{...} 单独处理
+var escapes = map[byte]string{'n': "\n", 't': "\t", 'r': "\r", '0': "\x00", '"': "\"", '\\': "\\", '$': "$"}
+
+// escape 处理 \ 开始的转义, 错误指向 \ 的位置, 之后继续扫描
+func (s *Scanner) escape(value *strings.Builder) {
+	line, column, offset := s.line, s.column(), s.current
+	s.advance()
+	if s.isAtEnd() {
+		// 由 string 报告没有结束的字符串
+		return
+	}
+	if s.peek() == '\n' {
+		s.error(line, column, offset, "Invalid escape sequence.")
+		return
+	}
+	c := s.advance()
+	if text, ok := escapes[c]; ok {
+		value.WriteString(text)
+		return
+	}
+	if c != 'u' {
+		s.error(line, column, offset, "Invalid escape sequence.")
+		return
+	}
+	// \u{1F600}, 1 到 6 位十六进制数字
+	if !s.match('{') {
+		s.error(line, column, offset, "Invalid Unicode escape sequence.")
+		return
+	}
+	begin := s.current
+	for isHexDigit(s.peek()) {
+		s.advance()
+	}
+	digits := s.source[begin:s.current]
+	code, err := strconv.ParseUint(digits, 16, 32)
+	if !s.match('}') || len(digits) > 6 || err != nil || !utf8.ValidRune(rune(code)) {
+		s.error(line, column, offset, "Invalid Unicode escape sequence.")
+		return
+	}
+	value.WriteRune(rune(code))
+}
+
+func isHexDigit(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
 }
 
 func (s *Scanner) number() {
@@ -0,0 +1,77 @@
+package Token
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// scanErrors 记录词法错误的位置
+type scanErrors struct {
+	columns []int
+}
+
+func (e *scanErrors) ScanError(line, column, offset, length int, message string) {
+	e.columns = append(e.columns, column)
+}
+
+func TestColumns(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  string
+		columns []int // 除了 EOF 之外每个 token 的列
+	}{
+		{"ascii", "var a = 1;", []int{1, 5, 7, 9, 10}},
+		{"after newline", "a;\n  b;", []int{1, 2, 3, 4}},
+		{"wide characters", "\"你好\" + x", []int{1, 6, 8}},
+		{"multi-line string", "\"a\nbc\" x", []int{1, 5}},
+		{"interpolation", "\"a${b}c\" d", []int{1, 5, 6, 10}},
+	}
+	for _, test := range tests {
+		tokens := NewScanner(test.source, &scanErrors{}).ScanTokens()
+		var columns []int
+		for _, token := range tokens[:len(tokens)-1] {
+			columns = append(columns, token.Column)
+		}
+		if len(columns) != len(test.columns) {
+			t.Errorf("%s: got columns %v, want %v", test.name, columns, test.columns)
+			continue
+		}
+		for k := range columns {
+			if columns[k] != test.columns[k] {
+				t.Errorf("%s: got columns %v, want %v", test.name, columns, test.columns)
+				break
+			}
+		}
+	}
+}
+
+// 无法识别的多字节字符只算一列, 之后的 token 位置不受影响
+func TestColumnAfterUnexpectedCharacter(t *testing.T) {
+	reporter := &scanErrors{}
+	tokens := NewScanner("a € b", reporter).ScanTokens()
+	if len(reporter.columns) != 1 || reporter.columns[0] != 3 {
+		t.Fatalf("got error columns %v, want [3]", reporter.columns)
+	}
+	if tokens[1].Lexeme != "b" || tokens[1].Column != 5 {
+		t.Errorf("got %q at column %d, want \"b\" at column 5", tokens[1].Lexeme, tokens[1].Column)
+	}
+}
+
+// 列是增量计算的, 扫描时间和行的长度成线性关系
+func TestLongLine(t *testing.T) {
+	const count = 200000
+	source := strings.Repeat("a+", count) + "a;"
+	start := time.Now()
+	tokens := NewScanner(source, &scanErrors{}).ScanTokens()
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Fatalf("scanning a %d byte line took %v", len(source), elapsed)
+	}
+	if len(tokens) != 2*count+3 {
+		t.Fatalf("got %d tokens, want %d", len(tokens), 2*count+3)
+	}
+	last := tokens[len(tokens)-2]
+	if last.TType != SEMICOLON || last.Column != len(source) {
+		t.Errorf("got %v at column %d, want ';' at column %d", last.TType, last.Column, len(source))
+	}
+}
@@ -9,19 +9,28 @@ type Token struct {
 	Lexeme  string      // 词位
 	Literal interface{} // 字面量
 	Line    int         // token 所在的行
+	Column  int         // token 起始位置所在的列, 从1开始
+	Offset  int         // token 起始位置在源码中的字节偏移
 }
 
 func (t *Token) String() string {
-	return fmt.Sprintf("type is: %v, lexeme value: %s,  Literal is: %v, Line number: %d",
-		t.TType, t.Lexeme, t.Literal, t.Line)
+	return fmt.Sprintf("type is: %v, lexeme value: %s,  Literal is: %v, Line number: %d, Column: %d",
+		t.TType, t.Lexeme, t.Literal, t.Line, t.Column)
 }
 
-func NewToken(tType TokenType, lexeme string, literal interface{}, line int) *Token {
+// End token 结束位置的字节偏移
+func (t *Token) End() int {
+	return t.Offset + len(t.Lexeme)
+}
+
+func NewToken(tType TokenType, lexeme string, literal interface{}, line, column, offset int) *Token {
 	t := &Token{
 		TType:   tType,
 		Lexeme:  lexeme,
 		Literal: literal,
 		Line:    line,
+		Column:  column,
+		Offset:  offset,
 	}
 	return t
 }
@@ -5,17 +5,25 @@ package Token
 type TokenType int
 
 const (
-	LEFT_PAREN  = iota + 1 // (
-	RIGHT_PAREN            // )
-	LEFT_BRACE             // {
-	RIGHT_BRACE            // }
-	COMMA                  // ,
-	DOT                    // .
-	MINUS                  // -
-	PLUS                   // +
-	SEMICOLON              // ;
-	SLASH                  // 反斜线
-	STAR                   // *
+	LEFT_PAREN    = iota + 1 // (
+	RIGHT_PAREN              // )
+	LEFT_BRACE               // {
+	RIGHT_BRACE              // }
+	LEFT_BRACKET             // [
+	RIGHT_BRACKET            // ]
+	COMMA                    // ,
+	COLON                    // :
+	DOT                      // .
+	MINUS                    // -
+	PLUS                     // +
+	SEMICOLON                // ;
+	SLASH                    // 反斜线
+	STAR                     // *
+	PERCENT                  // %
+	AMPERSAND                // &
+	PIPE                     // |
+	CARET                    // ^
+	TILDE                    // ~
 
 	// todo 部分关键字含义不清楚
 
@@ -27,6 +35,19 @@ const (
 	GREATER_EQUAL
 	LESS
 	LESS_EQUAL
+	STAR_STAR
+	LESS_LESS
+	GREATER_GREATER
+	TILDE_SLASH // 向下取整的除法
+
+	// 复合赋值和自增自减
+	PLUS_EQUAL
+	MINUS_EQUAL
+	STAR_EQUAL
+	SLASH_EQUAL
+	PERCENT_EQUAL
+	PLUS_PLUS
+	MINUS_MINUS
 
 	/*
 	  literals 字面量
@@ -34,25 +55,37 @@ const (
 	IDENTIFIER
 	STRING
 	NUMBER
+	// 插值字符串中 ${ 之前或者 } 之后的部分, 例如 "a${, }b${ 和 }c"
+	INTERPOLATION
+
+	// 注释不会出现在 ScanTokens 的结果中, 由 Scanner.Comments 单独返回
+	COMMENT
 
 	/*
 		keywords for lox language
 	*/
 
 	AND
+	BREAK
+	CATCH
 	CLASS
+	CONTINUE
 	ELSE
 	FALSE
+	FINALLY
 	FUN
 	FOR
 	IF
+	IMPORT
 	NIL
 	OR
 	PRINT
 	RETURN
 	SUPER
 	THIS
+	THROW
 	TRUE
+	TRY
 	VAR
 	WHILE
 
@@ -61,17 +94,25 @@ const (
 
 // 单纯用于打印
 var TokenTypeMap = map[TokenType]string{
-	LEFT_PAREN:  "(", // (
-	RIGHT_PAREN: ")", // )
-	LEFT_BRACE:  "{", // {
-	RIGHT_BRACE: "}", // }
-	COMMA:       ",", // ,
-	DOT:         ".", // .
-	MINUS:       "-", // -
-	PLUS:        "+", // +
-	SEMICOLON:   ";", // ;
-	SLASH:       "/", // 反斜线
-	STAR:        "*", // *
+	LEFT_PAREN:    "(", // (
+	RIGHT_PAREN:   ")", // )
+	LEFT_BRACE:    "{", // {
+	RIGHT_BRACE:   "}", // }
+	LEFT_BRACKET:  "[", // [
+	RIGHT_BRACKET: "]", // ]
+	COMMA:         ",", // ,
+	COLON:         ":", // :
+	DOT:           ".", // .
+	MINUS:         "-", // -
+	PLUS:          "+", // +
+	SEMICOLON:     ";", // ;
+	SLASH:         "/", // 反斜线
+	STAR:          "*", // *
+	PERCENT:       "%", // %
+	AMPERSAND:     "&", // &
+	PIPE:          "|", // |
+	CARET:         "^", // ^
+	TILDE:         "~", // ~
 	// todo 部分关键字含义不清楚
 
 	BANG:          "!",
@@ -83,33 +124,55 @@ var TokenTypeMap = map[TokenType]string{
 	LESS:          "<",
 	LESS_EQUAL:    "<=",
 
+	STAR_STAR:       "**",
+	LESS_LESS:       "<<",
+	GREATER_GREATER: ">>",
+	TILDE_SLASH:     "~/",
+
+	PLUS_EQUAL:    "+=",
+	MINUS_EQUAL:   "-=",
+	STAR_EQUAL:    "*=",
+	SLASH_EQUAL:   "/=",
+	PERCENT_EQUAL: "%=",
+	PLUS_PLUS:     "++",
+	MINUS_MINUS:   "--",
+
 	/*
 	  literals 字面量
 	*/
-	IDENTIFIER: "identifier",
-	STRING:     "str",
-	NUMBER:     "num",
+	IDENTIFIER:    "identifier",
+	STRING:        "str",
+	NUMBER:        "num",
+	INTERPOLATION: "interpolation",
+	COMMENT:       "comment",
 
 	/*
 		keywords for lox language
 	*/
 
-	AND:    "and",
-	CLASS:  "class",
-	ELSE:   "else",
-	FALSE:  "false",
-	FUN:    "fun",
-	FOR:    "for",
-	IF:     "if",
-	NIL:    "nil",
-	OR:     "or",
-	PRINT:  "print",
-	RETURN: "return",
-	SUPER:  "super",
-	THIS:   "this",
-	TRUE:   "true",
-	VAR:    "var",
-	WHILE:  "while",
+	AND:      "and",
+	BREAK:    "break",
+	CATCH:    "catch",
+	CLASS:    "class",
+	CONTINUE: "continue",
+	ELSE:     "else",
+	FALSE:    "false",
+	FINALLY:  "finally",
+	FUN:      "fun",
+	FOR:      "for",
+	IF:       "if",
+	IMPORT:   "import",
+	NIL:      "nil",
+	OR:       "or",
+	PRINT:    "print",
+	RETURN:   "return",
+	SUPER:    "super",
+	THIS:     "this",
+	THROW:    "throw",
+	TRUE:     "true",
+	TRY:      "try",
+	VAR:      "var",
+	WHILE:    "while",
 
 	EOF: "eof",
 }
@@ -117,3 +180,13 @@ var TokenTypeMap = map[TokenType]string{
 func (t TokenType) String() string {
 	return TokenTypeMap[t]
 }
+
+// TokenTypeOf String 的逆运算, 用于从语法树的 JSON 中恢复 token
+func TokenTypeOf(name string) (TokenType, bool) {
+	for t, item := range TokenTypeMap {
+		if item == name {
+			return t, true
+		}
+	}
+	return 0, false
+}
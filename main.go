@@ -1,84 +1,390 @@
 package main
 
 import (
-	"bufio"
+	"flag"
 	"fmt"
+	"github.com/trueabc/lox/Bench"
+	"github.com/trueabc/lox/Conformance"
+	"github.com/trueabc/lox/Debug"
+	"github.com/trueabc/lox/Diff"
 	"github.com/trueabc/lox/Errors"
+	"github.com/trueabc/lox/Lox"
+	"github.com/trueabc/lox/Lsp"
+	"github.com/trueabc/lox/Repl"
 	"github.com/trueabc/lox/Syntax"
-	"github.com/trueabc/lox/Token"
+	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 )
 
-var hadError = false
+func main() {
+	if len(os.Args) >= 2 && os.Args[1] == "test" {
+		runTests(os.Args[2:])
+		return
+	}
+	if len(os.Args) >= 2 && os.Args[1] == "bench" {
+		runBench(os.Args[2:])
+		return
+	}
+	if len(os.Args) >= 2 && os.Args[1] == "fmt" {
+		runFmt(os.Args[2:])
+		return
+	}
+	if len(os.Args) >= 2 && os.Args[1] == "lint" {
+		runLint(os.Args[2:])
+		return
+	}
+	if len(os.Args) >= 2 && os.Args[1] == "debug" {
+		runDebug(os.Args[2:])
+		return
+	}
+	if len(os.Args) >= 2 && os.Args[1] == "lsp" {
+		// 标准输出用于协议消息, 错误只能写到标准错误
+		if err := Lsp.NewServer(os.Stdin, os.Stdout).Serve(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
 
-var interpreter *Syntax.Interpreter = Syntax.NewInterpreter()
+	useVM := flag.Bool("vm", false, "run with the bytecode compiler and stack VM")
+	dumpAST := flag.Bool("dump-ast", false, "print the syntax tree of the script instead of running it")
+	astStyle := flag.String("ast-style", "sexpr", "format used by --dump-ast: sexpr or tree")
+	emitAST := flag.String("emit-ast", "", "print the syntax tree of the script in the given format (json) instead of running it")
+	loadAST := flag.Bool("load-ast", false, "run a syntax tree written by --emit-ast=json instead of lox source")
+	flag.Usage = usage
+	flag.Parse()
+	newVM := func() *Lox.VM {
+		if *useVM {
+			return Lox.NewBytecodeVM(os.Stdout, os.Stderr)
+		}
+		return Lox.NewVM(os.Stdout, os.Stderr)
+	}
 
-func main() {
-	args := os.Args
-	if len(args) > 2 {
-		fmt.Println("Usage: go-lox [script]")
+	args := flag.Args()
+	if len(args) > 1 {
+		usage()
 		// sysexits.h 的一个错误码, 错误使用command
 		os.Exit(64)
-	} else if len(args) == 2 {
-		runFile(args[1])
+	} else if (*dumpAST || *emitAST != "" || *loadAST) && len(args) == 0 {
+		usage()
+		os.Exit(64)
+	} else if *dumpAST {
+		dumpFile(args[0], *astStyle)
+	} else if *emitAST != "" {
+		emitFile(args[0], *emitAST)
+	} else if *loadAST {
+		runASTFile(newVM(), args[0])
+	} else if len(args) == 1 {
+		runFile(newVM(), args[0])
 	} else {
 		// 交互式的运行
-		runPrompt()
+		runPrompt(newVM)
 	}
 }
 
-func runFile(path string) {
+func runFile(vm *Lox.VM, path string) {
 	abs, err := filepath.Abs(path)
 	if err != nil {
 		return
 	}
-	file, err := os.ReadFile(abs)
+	err = vm.RunFile(abs)
+	if err != nil {
+		os.Exit(reportError(err))
+	}
+}
+
+// dumpFile 只解析不执行, 输出语法树, 用于检查解析器的优先级等问题
+func dumpFile(path, style string) {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		os.Exit(reportError(err))
+	}
+	stmts, err := Lox.Parse(string(source), path)
+	if err != nil {
+		os.Exit(reportError(err))
+	}
+	printer := Syntax.NewAstPrinter()
+	switch style {
+	case "sexpr":
+		fmt.Print(printer.PrintStmts(stmts))
+	case "tree":
+		fmt.Print(printer.Tree(stmts))
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown AST style '%s', expect sexpr or tree.\n", style)
+		os.Exit(64)
+	}
+}
+
+// emitFile 输出语法树的 JSON, 供其他语言编写的工具使用
+func emitFile(path, format string) {
+	if format != "json" {
+		fmt.Fprintf(os.Stderr, "Unknown AST format '%s', expect json.\n", format)
+		os.Exit(64)
+	}
+	source, err := os.ReadFile(path)
+	if err != nil {
+		os.Exit(reportError(err))
+	}
+	stmts, err := Lox.Parse(string(source), path)
+	if err != nil {
+		os.Exit(reportError(err))
+	}
+	data, err := Syntax.MarshalAST(stmts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(70)
+	}
+	fmt.Println(string(data))
+}
+
+// runASTFile 执行 --emit-ast=json 输出的语法树, 语法树可以被其他工具修改过
+func runASTFile(vm *Lox.VM, path string) {
+	abs, err := filepath.Abs(path)
 	if err != nil {
 		return
 	}
-	run(string(file))
-	if hadError {
+	data, err := os.ReadFile(abs)
+	if err != nil {
+		os.Exit(reportError(err))
+	}
+	stmts, err := Syntax.UnmarshalAST(data)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
 		os.Exit(65)
 	}
+	if err := vm.RunAST(stmts, abs); err != nil {
+		os.Exit(reportError(err))
+	}
 }
 
-func runPrompt() {
-	reader := bufio.NewScanner(os.Stdin)
-	fmt.Print("> ")
-	for reader.Scan() {
-		// scan a line and text get result
-		text := reader.Text()
-
-		if len(text) != 0 {
-			run(text)
-			hadError = false
-		} else {
-			break
-		}
-		fmt.Print("> ")
+func usage() {
+	fmt.Println("Usage: go-lox [--vm] [script]")
+	fmt.Println("       go-lox --dump-ast [--ast-style sexpr|tree] script")
+	fmt.Println("       go-lox --emit-ast=json script")
+	fmt.Println("       go-lox [--vm] --load-ast ast.json")
+	fmt.Println("       go-lox test [-vm] [-v] [dir]")
+	fmt.Println("       go-lox bench [-vm] [-n runs] [dir]")
+	fmt.Println("       go-lox fmt [-w] [-d] [path ...]")
+	fmt.Println("       go-lox lint path ...")
+	fmt.Println("       go-lox debug script")
+	fmt.Println("       go-lox lsp")
+}
+
+// 运行一致性测试, 每个文件交给当前的可执行文件在子进程中执行
+func runTests(args []string) {
+	flags := flag.NewFlagSet("test", flag.ExitOnError)
+	verbose := flags.Bool("v", false, "print the reason of every failed case")
+	useVM := flags.Bool("vm", false, "test the bytecode VM backend")
+	flags.Parse(args)
+	dir := "lox-sample/test"
+	if flags.NArg() > 0 {
+		dir = flags.Arg(0)
+	}
+
+	self, err := os.Executable()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	runner := Conformance.NewRunner(self)
+	if *useVM {
+		runner = Conformance.NewVMRunner(self)
+	}
+	report, err := runner.Run(dir)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	report.Print(os.Stdout, *verbose)
+	if len(report.Failed()) != 0 {
+		os.Exit(1)
 	}
 }
 
-// 读取source内容并执行
-func run(source string) {
-	scanner := Token.NewScanner(source)
-	tokens := scanner.ScanTokens()
+// 在当前进程中运行 benchmark 脚本, 以 JSON 输出每个文件的耗时、分配和 GC 暂停
+func runBench(args []string) {
+	flags := flag.NewFlagSet("bench", flag.ExitOnError)
+	runs := flags.Int("n", 5, "number of runs per file")
+	useVM := flags.Bool("vm", false, "benchmark the bytecode VM backend")
+	flags.Parse(args)
+	dir := "lox-sample/test/benchmark"
+	if flags.NArg() > 0 {
+		dir = flags.Arg(0)
+	}
 
-	parser := Syntax.NewParser(tokens)
-	// res is an ast
-	res := parser.Parse()
+	report, err := Bench.NewRunner(*runs, *useVM).Run(dir)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if err := report.WriteJSON(os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
 
-	resolver := Syntax.NewResolver(interpreter)
-	resolver.ResolveStmts(res)
+// runFmt 格式化 lox 源码, 没有参数时从标准输入读取, 目录中的 .lox 文件都会被格式化
+func runFmt(args []string) {
+	flags := flag.NewFlagSet("fmt", flag.ExitOnError)
+	write := flags.Bool("w", false, "write the result back to the source file instead of stdout")
+	diff := flags.Bool("d", false, "print a diff instead of the formatted source")
+	flags.Parse(args)
 
-	if Errors.HadError {
+	if flags.NArg() == 0 {
+		source, err := io.ReadAll(os.Stdin)
+		if err == nil {
+			err = formatFile("<stdin>", source, false, *diff)
+		}
+		if err != nil {
+			os.Exit(reportError(err))
+		}
 		return
 	}
 
-	interpreter.Interpret(res)
-	if Errors.HadRunTimeError {
+	code := 0
+	for _, arg := range flags.Args() {
+		err := filepath.WalkDir(arg, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if entry.IsDir() || (path != arg && filepath.Ext(path) != ".lox") {
+				return nil
+			}
+			source, err := os.ReadFile(path)
+			if err == nil {
+				err = formatFile(path, source, *write, *diff)
+			}
+			// 一个文件出错时继续格式化其他文件
+			if err != nil {
+				code = reportError(err)
+			}
+			return nil
+		})
+		if err != nil {
+			code = reportError(err)
+		}
+	}
+	os.Exit(code)
+}
+
+func formatFile(path string, source []byte, write, diff bool) error {
+	formatted, err := Syntax.Format(string(source), path)
+	if err != nil {
+		return err
+	}
+	if diff {
+		fmt.Print(Diff.Unified(path+".orig", path, string(source), formatted))
+	}
+	if write {
+		if formatted == string(source) {
+			return nil
+		}
+		return os.WriteFile(path, []byte(formatted), 0644)
+	}
+	if !diff {
+		fmt.Print(formatted)
+	}
+	return nil
+}
+
+// runLint 静态检查 lox 源码, 有编译错误返回 65, 只有警告返回 1
+func runLint(args []string) {
+	flags := flag.NewFlagSet("lint", flag.ExitOnError)
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		usage()
+		os.Exit(64)
+	}
+
+	code := 0
+	for _, arg := range flags.Args() {
+		err := filepath.WalkDir(arg, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if entry.IsDir() || (path != arg && filepath.Ext(path) != ".lox") {
+				return nil
+			}
+			source, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			analysis := Syntax.Analyze(string(source), path)
+			if len(analysis.Diagnostics) != 0 {
+				code = reportError(analysis.Diagnostics)
+				return nil
+			}
+			if warnings := analysis.Lint(); len(warnings) != 0 {
+				reportError(warnings)
+				if code == 0 {
+					code = 1
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			code = reportError(err)
+		}
+	}
+	os.Exit(code)
+}
+
+// runPrompt 交互式的运行, 历史记录保存在 LOX_HISTORY 或者 ~/.lox_history
+func runPrompt(newVM func() *Lox.VM) {
+	history := Repl.LoadHistory(Repl.DefaultHistoryPath())
+	repl := Repl.New(newVM, func(err error) { reportError(err) }, history)
+	if err := repl.Run(os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(74)
+	}
+}
+
+// 输出错误信息, 返回 sysexits.h 中对应的退出码
+func reportError(err error) int {
+	switch e := err.(type) {
+	case Errors.Diagnostics:
+		for _, item := range e {
+			fmt.Fprint(os.Stderr, item.Render())
+		}
+		return 65
+	case *Syntax.RuntimeError:
+		fmt.Fprintf(os.Stderr, "%v\n%v\n", e.Error(), e.StackTrace())
+		if e.Diagnostic != nil {
+			fmt.Fprint(os.Stderr, e.Diagnostic.Excerpt())
+		}
+		return 70
+	default:
+		fmt.Fprintln(os.Stderr, err)
+		// 读取文件失败
+		return 66
+	}
+}
+
+// runDebug 在调试器中运行脚本, 调试命令从标准输入读取, 只支持树遍历解释器
+func runDebug(args []string) {
+	flags := flag.NewFlagSet("debug", flag.ExitOnError)
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		usage()
+		os.Exit(64)
+	}
+	abs, err := filepath.Abs(flags.Arg(0))
+	if err != nil {
+		os.Exit(reportError(err))
+	}
+	source, err := os.ReadFile(abs)
+	if err != nil {
+		os.Exit(reportError(err))
+	}
+	debugger := Debug.New(string(source), os.Stdin, os.Stdout)
+	err = Lox.NewVM(os.Stdout, os.Stderr).DebugFile(abs, debugger.Hook)
+	if err == Syntax.ErrDebugStopped {
 		return
 	}
-	//fmt.Println(Syntax.AstPrinter{}.Print(res))
+	if err != nil {
+		os.Exit(reportError(err))
+	}
+	fmt.Println("Program finished.")
 }